@@ -18,7 +18,8 @@
 // To get started, enable the Google+ API service at
 // https://code.google.com/apis/console/ > Services. Then, simply fill in the
 // app/api/config.json with your values from the API Access section of the same
-// site.
+// site, or replace it with the client secrets file ("client_secret.json") of a
+// web application client downloaded from there, adding your "APIKey" to it.
 //
 // Since the Google App Engine URL Fetch API requires a per-request context,
 // you must use the *plus.Service from within an HTTP handler. This package
@@ -32,6 +33,10 @@
 // any HTTP handlers that require the use of an authenticated (OAuth)
 // *plus.Service. This is automatically enforced by the WithOAuthPlus wrapper
 // function.
+//
+// The config file, the transports and the handling of OAuth tokens are shared
+// with the command-line tool through the core package; this package supplies
+// the App Engine parts: URL Fetch, memcache, the datastore and the Users API.
 package api
 
 import (
@@ -41,69 +46,255 @@ import (
 	"appengine/user"
 	"fmt"
 	"http"
-	"json"
+	"io/ioutil"
+	"log"
 	"os"
 	"url"
 
 	"goauth2.googlecode.com/hg/oauth"
 	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/clientsecrets"
+	"google-plus-go-starter.googlecode.com/hg/configcheck"
+	"google-plus-go-starter.googlecode.com/hg/core"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+	"google-plus-go-starter.googlecode.com/hg/httpcache"
 	"google-plus-go-starter.googlecode.com/hg/noauth"
 )
 
 // config contains configuration values used to access the Google+ Platform
 // APIs. These values are automatically loaded by this module from
-// "app/api/config.json".
-var config = struct {
-	// Your unique Google API Key for simple API Access.
-	APIKey string
-	// Your OAuth configuration information for protected user data access.
-	OAuthConfig oauth.Config
-	// The path in your application to which users will be redirected after they
-	// allow or deny permission for your application to access their data.
-	OAuthRedirectPath string
-	// The scheme, hostname and port at which your application can be accessed
-	// when running on the local development server.
-	DevRootURL string
-	// The scheme, hostname and port at which your application can be accessed
-	// when running on App Engine.
-	ProdRootURL string
-}{}
+// "app/api/config.json". See core.Config for the meaning of the values; the
+// App Engine specific ones are OAuthRedirectPath, DevRootURL, ProdRootURL and
+// Cache.Memcache, which caches responses in memcache, shared by all instances.
+var config *core.Config
 
 const configPath = "app/api/config.json"
 
+// client builds the transports of config. Its key pool, rate limiter and
+// in-memory cache are shared by all requests served by this instance.
+var client *core.Client
+
+// configErr is the error which kept init from loading "app/api/config.json".
+// The handlers wrapped by this package serve it as an internal server error
+// instead of calling the API.
+var configErr os.Error
+
+// CacheStats returns how many API requests made by this instance were served
+// from the response cache.
+func CacheStats() httpcache.Stats {
+	if client == nil {
+		return httpcache.Stats{}
+	}
+	return client.CacheStats()
+}
+
+// KeyStats returns the usage counters of each key in the APIKeys pool of this
+// instance, or nil if the config file doesn't list any.
+func KeyStats() []noauth.KeyStats {
+	if client == nil {
+		return nil
+	}
+	return client.KeyStats()
+}
+
 // init loads the "app/api/config.json" file into the "config" struct and registers
 // an HTTP request handler function to handle OAuth redirect requests.
 //
 // The handler function is registered at the path defined by the
-// OAuthRedirectPath" attribute declared in "app/api/config.json".
+// OAuthRedirectPath" attribute declared in "app/api/config.json". If the file
+// can't be loaded, every problem is logged and nothing is registered.
 func init() {
-	// Open, parse and load "app/api/config.json" into the "config" struct.
-	configFile, err := os.Open(configPath)
-	if err != nil {
-		panic(fmt.Sprintf("Could not open %s: %s", configPath, err.String()))
+	if configErr = loadConfig(); configErr != nil {
+		logConfigError(configErr)
+		return
 	}
-	defer configFile.Close()
 
-	if err = json.NewDecoder(configFile).Decode(&config); err != nil {
-		panic(fmt.Sprintf("Could not parse %s: %s", configPath, err.String()))
+	// Register the OAuth redirect URL handler.
+	http.HandleFunc(config.OAuthRedirectPath, requireUser(oauthHandler))
+}
+
+// loadConfig opens, parses, validates and loads "app/api/config.json" into the
+// "config" struct, and builds the client.
+func loadConfig() os.Error {
+	data, err := ioutil.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("Could not open %s: %s", configPath, err.String())
+	}
+	// The config file may also be a client secrets file downloaded from the
+	// API console, or hold its "web" client.
+	var secrets *clientsecrets.Client
+	if config, secrets, err = core.Parse(data); err != nil {
+		return fmt.Errorf("Could not parse %s: %s", configPath, err.String())
+	}
+	if len(config.OAuthConfig.Scope) == 0 {
+		config.OAuthConfig.Scope = core.PlusMeScope
+	}
+	if len(config.OAuthConfig.AuthURL) == 0 {
+		config.OAuthConfig.AuthURL = endpoint.GoogleAuthURL
+	}
+	if len(config.OAuthConfig.TokenURL) == 0 {
+		config.OAuthConfig.TokenURL = endpoint.GoogleTokenURL
 	}
 
 	// Set the OAuth redirect URL depending on whether the application is running
-	// on the local development server or on App Engine.
+	// on the local development server or on App Engine. Without a root URL,
+	// the redirect URI of the client secrets for that environment is used.
+	rootURLName, clientRedirectURL := "ProdRootURL", ""
 	if appengine.IsDevAppServer() {
+		rootURLName = "DevRootURL"
 		config.OAuthConfig.RedirectURL = config.DevRootURL
+		if secrets != nil {
+			clientRedirectURL = secrets.LocalRedirectURI()
+		}
 	} else {
 		config.OAuthConfig.RedirectURL = config.ProdRootURL
+		if secrets != nil {
+			clientRedirectURL = secrets.RemoteRedirectURI()
+		}
 	}
-	redirectURL, err := url.Parse(config.OAuthConfig.RedirectURL)
-	if err != nil {
-		panic(fmt.Sprintf("Could not parse RootURL in %s: %s", configPath, err.String()))
+	if len(config.OAuthConfig.RedirectURL) == 0 {
+		config.OAuthConfig.RedirectURL = clientRedirectURL
+	}
+
+	// Report every problem of the config file at once.
+	if err := validate(config, rootURLName); err != nil {
+		return err
+	}
+
+	redirectURL, _ := url.Parse(config.OAuthConfig.RedirectURL)
+	if len(config.OAuthRedirectPath) == 0 {
+		config.OAuthRedirectPath = redirectURL.Path
 	}
 	redirectURL.Path = config.OAuthRedirectPath
 	config.OAuthConfig.RedirectURL = redirectURL.String()
 
-	// Register the OAuth redirect URL handler.
-	http.HandleFunc(config.OAuthRedirectPath, requireUser(oauthHandler))
+	client, err = core.NewClient(config)
+	return err
+}
+
+// logConfigError logs err, with one line for each problem of the config file.
+func logConfigError(err os.Error) {
+	e, ok := err.(*configcheck.Error)
+	if !ok {
+		log.Print(err.String())
+		return
+	}
+	for _, problem := range e.Problems {
+		log.Printf("invalid config %s: %s", e.Path, problem)
+	}
+}
+
+// configFailed serves configErr as an internal server error and returns true
+// if the config file couldn't be loaded.
+func configFailed(w http.ResponseWriter) bool {
+	if configErr == nil {
+		return false
+	}
+	http.Error(w, configErr.String(), http.StatusInternalServerError)
+	return true
+}
+
+// validate returns an error listing every problem of config, or nil if there
+// are none. rootURLName is the name of the root URL setting of the current
+// environment, which the redirect URL comes from.
+func validate(config *core.Config, rootURLName string) os.Error {
+	var p configcheck.Problems
+	config.Check(&p)
+	config.RequireAPIKey(&p)
+
+	// Users are always authorized with OAuth, so the client is required.
+	c := &config.OAuthConfig
+	p.Required("OAuthConfig.ClientId", c.ClientId)
+	p.Required("OAuthConfig.ClientSecret", c.ClientSecret)
+	p.Scopes("OAuthConfig.Scope", c.Scope)
+	p.URL("OAuthConfig.AuthURL", c.AuthURL)
+	p.URL("OAuthConfig.TokenURL", c.TokenURL)
+
+	p.URL("DevRootURL", config.DevRootURL)
+	p.URL("ProdRootURL", config.ProdRootURL)
+	// Only the root URL of the current environment has to be set.
+	p.NotPlaceholder(rootURLName, c.RedirectURL)
+	if len(c.RedirectURL) == 0 {
+		p.Add("%s is missing, and there is no redirect URI for this environment", rootURLName)
+	} else if u, err := url.Parse(c.RedirectURL); err == nil && len(config.OAuthRedirectPath) == 0 && len(u.Path) == 0 {
+		p.Add("OAuthRedirectPath is missing")
+	}
+	if len(config.OAuthRedirectPath) > 0 && config.OAuthRedirectPath[0] != '/' {
+		p.Add("OAuthRedirectPath %q must start with /", config.OAuthRedirectPath)
+	}
+	if len(config.Cache.Dir) > 0 {
+		p.Add("Cache.Dir isn't supported on App Engine, use Cache.Memcache")
+	}
+	return p.Err(configPath)
+}
+
+// requestTransports is the core.TransportFactory of the request with context
+// c: requests are sent with URL Fetch, and cached in memcache if
+// Cache.Memcache is set.
+type requestTransports struct {
+	c appengine.Context
+}
+
+func (r requestTransports) NewTransport() http.RoundTripper {
+	return &urlfetch.Transport{Context: r.c}
+}
+
+func (r requestTransports) NewCache() httpcache.Cache {
+	if config.Cache.Memcache {
+		return memcacheCache{r.c}
+	}
+	return nil
+}
+
+// baseTransport returns the HTTP transport underlying the noauth and oauth
+// transports for the request with context c.
+func baseTransport(c appengine.Context) http.RoundTripper {
+	return client.Transport(requestTransports{c})
+}
+
+// currentUser is the core.Identity of the Google account signed in for the
+// request with context c.
+type currentUser struct {
+	c appengine.Context
+}
+
+func (u currentUser) UserId() string {
+	if cu := user.Current(u.c); cu != nil {
+		return cu.Id
+	}
+	return ""
+}
+
+// datastoreTokenStore is a core.TokenStore which keeps the OAuth tokens of a
+// user in the datastore, as an "oauth.Token" entity keyed by the user's ID.
+type datastoreTokenStore struct {
+	c      appengine.Context
+	userId string
+}
+
+func (s *datastoreTokenStore) key() *datastore.Key {
+	return datastore.NewKey(s.c, "oauth.Token", s.userId, 0, nil)
+}
+
+func (s *datastoreTokenStore) ReadToken() (*oauth.Token, os.Error) {
+	token := &oauth.Token{}
+	err := datastore.Get(s.c, s.key(), token)
+	if err == datastore.ErrNoSuchEntity {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return token, nil
+}
+
+func (s *datastoreTokenStore) WriteToken(token *oauth.Token) os.Error {
+	_, err := datastore.Put(s.c, s.key(), token)
+	return err
+}
+
+func (s *datastoreTokenStore) DeleteToken() os.Error {
+	return datastore.Delete(s.c, s.key())
 }
 
 // requireUser is used to wrap HTTP request handlers to ensure that the user
@@ -146,15 +337,13 @@ type HandlerFunc func(http.ResponseWriter, *http.Request, *plus.Service)
 // 	}
 func WithNoAuthPlus(handler HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		if configFailed(w) {
+			return
+		}
 		c := appengine.NewContext(r)
 
 		// Initialize the *plus.Service.
-		t := &noauth.Transport{
-			APIKey:    config.APIKey,
-			Transport: &urlfetch.Transport{Context: c},
-		}
-
-		p, err := plus.New(t.Client())
+		p, err := client.NoAuthPlus(baseTransport(c))
 		if err != nil {
 			http.Error(w, err.String(), http.StatusInternalServerError)
 			return
@@ -181,47 +370,33 @@ func WithNoAuthPlus(handler HandlerFunc) http.HandlerFunc {
 // 	}
 func WithOAuthPlus(handler HandlerFunc) http.HandlerFunc {
 	return requireUser(func(w http.ResponseWriter, r *http.Request) {
-		c := appengine.NewContext(r)
-
-		// Get the OAuth tokens for the current user from the datastore.
-		token := &oauth.Token{}
-		key := datastore.NewKey(c, "oauth.Token", user.Current(c).Id, 0, nil)
-		err := datastore.Get(c, key, token)
-		if err != nil && err != datastore.ErrNoSuchEntity {
-			http.Error(w, err.String(), http.StatusInternalServerError)
+		if configFailed(w) {
 			return
 		}
+		c := appengine.NewContext(r)
+
+		// Initialize the *plus.Service with the OAuth tokens of the current
+		// user from the datastore. Refreshed tokens are saved back to the
+		// datastore.
+		u := currentUser{c}
+		store := &datastoreTokenStore{c, u.UserId()}
+		p, err := client.OAuthPlus(baseTransport(c), u, store, c.Warningf)
 
 		// If the user does not have OAuth tokens, make them do the OAuth dance.
-		if err == datastore.ErrNoSuchEntity {
+		if err == core.ErrNoToken {
 			// Redirect to the Google OAuth permissions page. Use the state to
 			// remember where the user originally wanted to go.
 			url := config.OAuthConfig.AuthCodeURL(r.URL.RawPath)
 			http.Redirect(w, r, url, http.StatusFound)
-		} else {
-			// Initialize the *plus.Service.
-			t := &oauth.Transport{
-				Config:    &config.OAuthConfig,
-				Token:     token,
-				Transport: &urlfetch.Transport{Context: c},
-			}
-
-			p, err := plus.New(t.Client())
-			if err != nil {
-				http.Error(w, err.String(), http.StatusInternalServerError)
-				return
-			}
-
-			// Execute the wrapped handler, providing the *plus.Service.
-			handler(w, r, p)
-
-			// Save the OAuth tokens back to the datastore, in case they have been
-			// updated.
-			if _, err = datastore.Put(c, key, token); err != nil {
-				http.Error(w, err.String(), http.StatusInternalServerError)
-				return
-			}
+			return
+		}
+		if err != nil {
+			http.Error(w, err.String(), http.StatusInternalServerError)
+			return
 		}
+
+		// Execute the wrapped handler, providing the *plus.Service.
+		handler(w, r, p)
 	})
 }
 
@@ -238,10 +413,7 @@ func WithOAuthPlus(handler HandlerFunc) http.HandlerFunc {
 func oauthHandler(w http.ResponseWriter, r *http.Request) {
 	c := appengine.NewContext(r)
 
-	trans := &oauth.Transport{
-		Config:    &config.OAuthConfig,
-		Transport: &urlfetch.Transport{Context: c},
-	}
+	trans := client.OAuthTransport(baseTransport(c), "")
 
 	if error := r.FormValue("error"); len(error) > 0 {
 		http.Error(w, error, http.StatusInternalServerError)
@@ -262,8 +434,8 @@ func oauthHandler(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Save the tokens for this user in the datastore.
-	key := datastore.NewKey(c, "oauth.Token", user.Current(c).Id, 0, nil)
-	if _, err = datastore.Put(c, key, token); err != nil {
+	store := &datastoreTokenStore{c, currentUser{c}.UserId()}
+	if err = store.WriteToken(token); err != nil {
 		http.Error(w, err.String(), http.StatusInternalServerError)
 		return
 	}
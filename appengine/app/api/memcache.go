@@ -0,0 +1,51 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"appengine"
+	"appengine/memcache"
+)
+
+// memcachePrefix namespaces the cached API responses in memcache.
+const memcachePrefix = "httpcache:"
+
+// memcacheCache implements httpcache.Cache using the App Engine memcache
+// service. It is bound to the context of a single request.
+type memcacheCache struct {
+	c appengine.Context
+}
+
+func (m memcacheCache) Get(key string) ([]byte, bool) {
+	item, err := memcache.Get(m.c, memcachePrefix+key)
+	if err != nil {
+		if err != memcache.ErrCacheMiss {
+			m.c.Warningf("memcache.Get: %s", err.String())
+		}
+		return nil, false
+	}
+	return item.Value, true
+}
+
+func (m memcacheCache) Set(key string, value []byte) {
+	item := &memcache.Item{Key: memcachePrefix + key, Value: value}
+	if err := memcache.Set(m.c, item); err != nil {
+		m.c.Warningf("memcache.Set: %s", err.String())
+	}
+}
+
+func (m memcacheCache) Delete(key string) {
+	memcache.Delete(m.c, memcachePrefix+key)
+}
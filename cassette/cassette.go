@@ -0,0 +1,160 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The cassette package records HTTP interactions with Google APIs to a file
+// (a "cassette") and replays them later, so that programs can run offline and
+// deterministically, e.g. in continuous integration.
+//
+// Record a run:
+// 	r := &cassette.Recorder{}
+// 	t := &noauth.Transport{APIKey: YOUR_API_KEY, Transport: r}
+// 	... make requests with t.Client() ...
+// 	r.Cassette().Save("people_search.json")
+//
+// Replay it:
+// 	c, err := cassette.Load("people_search.json")
+// 	t := &noauth.Transport{APIKey: "any", Transport: &cassette.Replayer{Cassette: c}}
+//
+// Secrets are redacted before they are recorded: the "key" and "access_token"
+// querystring parameters, the Authorization header, cookies, and the tokens in
+// OAuth token endpoint responses. Request bodies are never recorded.
+package cassette
+
+import (
+	"http"
+	"io/ioutil"
+	"json"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"url"
+)
+
+// Redacted replaces secrets in recorded interactions.
+const Redacted = "REDACTED"
+
+// Cassette is a list of recorded HTTP interactions.
+type Cassette struct {
+	Interactions []*Interaction
+}
+
+// Interaction is a request and the response it received.
+type Interaction struct {
+	Request  Request
+	Response Response
+}
+
+// Request is the recorded form of an *http.Request.
+type Request struct {
+	Method string
+	URL    string
+	Header http.Header
+}
+
+// Response is the recorded form of an *http.Response.
+type Response struct {
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       string
+}
+
+// Load reads a cassette from the file at path.
+func Load(path string) (*Cassette, os.Error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := &Cassette{}
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Save writes the cassette to the file at path. The file is only readable by
+// its owner since it may contain personal data.
+func (c *Cassette) Save(path string) os.Error {
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, data, 0600)
+}
+
+// secretParams are the querystring parameters that are redacted.
+var secretParams = []string{"key", "access_token"}
+
+// secretHeaders are the headers that are redacted.
+var secretHeaders = []string{"Authorization", "Cookie", "Set-Cookie"}
+
+// secretFields matches the tokens in OAuth token endpoint responses.
+var secretFields = regexp.MustCompile(`"(access_token|refresh_token|id_token)"\s*:\s*"[^"]*"`)
+
+func redactURL(u *url.URL) string {
+	redacted := *u
+	q := redacted.Query()
+	for _, p := range secretParams {
+		if _, ok := q[p]; ok {
+			q.Set(p, Redacted)
+		}
+	}
+	redacted.RawQuery = q.Encode()
+	return redacted.String()
+}
+
+func redactHeader(h http.Header) http.Header {
+	redacted := make(http.Header)
+	for k, v := range h {
+		redacted[k] = v
+	}
+	for _, k := range secretHeaders {
+		if len(redacted.Get(k)) > 0 {
+			redacted.Set(k, Redacted)
+		}
+	}
+	return redacted
+}
+
+func redactBody(body string) string {
+	return secretFields.ReplaceAllStringFunc(body, func(field string) string {
+		name := field[:strings.Index(field, ":")]
+		return name + `: "` + Redacted + `"`
+	})
+}
+
+// matchKey returns the string on which requests are matched: the method, the
+// path and the querystring, sorted and without the redacted parameters.
+func matchKey(method string, u *url.URL) string {
+	q := u.Query()
+	for _, p := range secretParams {
+		q.Del(p)
+	}
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		values := q[k]
+		sort.Strings(values)
+		for _, v := range values {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.ToUpper(method) + " " + u.Path + "?" + strings.Join(parts, "&")
+}
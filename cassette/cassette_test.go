@@ -0,0 +1,118 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cassette
+
+import (
+	"http"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// echoRoundTripper answers each request with a body naming its URL path, or
+// with a token response for the token endpoint.
+type echoRoundTripper struct{ n int }
+
+func (t *echoRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	t.n++
+	body := req.URL.Path + " #" + strconv.Itoa(t.n)
+	if req.URL.Path == "/o/oauth2/token" {
+		body = `{"access_token": "ya29.secret", "refresh_token":"1/secret", "expires_in": 3600}`
+	}
+	return &http.Response{
+		Status:     "200 OK",
+		StatusCode: 200,
+		Header:     http.Header{"Set-Cookie": []string{"session=secret"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func do(t *testing.T, transport http.RoundTripper, method, rawurl, authorization string) string {
+	req, err := http.NewRequest(method, rawurl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body)
+}
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cassette")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "cassette.json")
+
+	// Record.
+	recorder := &Recorder{Transport: &echoRoundTripper{}}
+	do(t, recorder, "GET", "https://www.googleapis.com/plus/v1/people?query=Larry&maxResults=10&key=abc", "")
+	do(t, recorder, "GET", "https://www.googleapis.com/plus/v1/people/me", "Bearer ya29.secret")
+	do(t, recorder, "GET", "https://www.googleapis.com/plus/v1/people/me", "Bearer ya29.secret")
+	do(t, recorder, "POST", "https://accounts.google.com/o/oauth2/token", "")
+	if err := recorder.Cassette().Save(path); err != nil {
+		t.Fatal(err)
+	}
+
+	// No secret may end up in the cassette file.
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, secret := range []string{"abc", "ya29.secret", "1/secret", "session=secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("cassette contains secret %q:\n%s", secret, data)
+		}
+	}
+
+	// Replay, with another key and a different parameter order.
+	c, err := Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	replayer := &Replayer{Cassette: c}
+	tests := []struct{ method, url, body string }{
+		{"GET", "https://www.googleapis.com/plus/v1/people?key=def&maxResults=10&query=Larry", "/plus/v1/people #1"},
+		{"GET", "https://www.googleapis.com/plus/v1/people/me", "/plus/v1/people/me #2"},
+		{"GET", "https://www.googleapis.com/plus/v1/people/me", "/plus/v1/people/me #3"},
+		// Used up: the last matching interaction is repeated.
+		{"GET", "https://www.googleapis.com/plus/v1/people/me", "/plus/v1/people/me #3"},
+		{"POST", "https://accounts.google.com/o/oauth2/token", `{"access_token": "REDACTED", "refresh_token": "REDACTED", "expires_in": 3600}`},
+	}
+	for _, test := range tests {
+		if body := do(t, replayer, test.method, test.url, ""); body != test.body {
+			t.Errorf("%s %s: expected %q but got %q", test.method, test.url, test.body, body)
+		}
+	}
+
+	// Unrecorded requests fail.
+	req, _ := http.NewRequest("GET", "https://www.googleapis.com/plus/v1/people?query=Sergey", nil)
+	if _, err := replayer.RoundTrip(req); err == nil {
+		t.Error("expected an error for an unrecorded request")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cassette
+
+import (
+	"bytes"
+	"fmt"
+	"http"
+	"io/ioutil"
+	"os"
+	"strings"
+	"sync"
+	"url"
+
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+// Recorder implements http.RoundTripper. It forwards requests to its
+// Transport and records every interaction, with secrets redacted. It should
+// be placed underneath the noauth or oauth transport, so that it sees the
+// final requests. It is safe for use by multiple goroutines.
+type Recorder struct {
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	mu           sync.Mutex
+	interactions []*Interaction
+}
+
+func (r *Recorder) transport() http.RoundTripper {
+	if r.Transport != nil {
+		return r.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip executes a single HTTP transaction and records it.
+func (r *Recorder) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	resp, err := r.transport().RoundTrip(req)
+	if err != nil {
+		return nil, err
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	i := &Interaction{
+		Request: Request{
+			Method: req.Method,
+			URL:    redactURL(req.URL),
+			Header: redactHeader(req.Header),
+		},
+		Response: Response{
+			Status:     resp.Status,
+			StatusCode: resp.StatusCode,
+			Header:     redactHeader(resp.Header),
+			Body:       redactBody(string(body)),
+		},
+	}
+
+	r.mu.Lock()
+	r.interactions = append(r.interactions, i)
+	r.mu.Unlock()
+
+	return resp, nil
+}
+
+// CancelRequest cancels req if the Transport can cancel it, e.g. while it
+// waits for a ratelimit.Transport.
+func (r *Recorder) CancelRequest(req *http.Request) {
+	if c, ok := r.transport().(noauth.Canceler); ok {
+		c.CancelRequest(req)
+	}
+}
+
+// Cassette returns the interactions recorded so far.
+func (r *Recorder) Cassette() *Cassette {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	interactions := make([]*Interaction, len(r.interactions))
+	copy(interactions, r.interactions)
+	return &Cassette{interactions}
+}
+
+// Replayer implements http.RoundTripper. It answers requests with the
+// responses recorded in its Cassette, without any network access. Requests
+// are matched on their method, path and querystring (ignoring parameter order
+// and the redacted parameters). Identical requests get the matching
+// interactions in recorded order; once those are used up, the last one is
+// repeated. It is safe for use by multiple goroutines.
+type Replayer struct {
+	Cassette *Cassette
+
+	mu   sync.Mutex
+	used map[*Interaction]bool
+}
+
+// RoundTrip returns the recorded response matching req, or an error if there
+// is none.
+func (r *Replayer) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	key := matchKey(req.Method, req.URL)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used == nil {
+		r.used = make(map[*Interaction]bool)
+	}
+
+	var match *Interaction
+	for _, i := range r.Cassette.Interactions {
+		u, err := url.Parse(i.Request.URL)
+		if err != nil || matchKey(i.Request.Method, u) != key {
+			continue
+		}
+		match = i
+		if !r.used[i] {
+			break
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("cassette: no recorded response for %s", key)
+	}
+	r.used[match] = true
+
+	header := make(http.Header)
+	for k, v := range match.Response.Header {
+		header[k] = v
+	}
+	return &http.Response{
+		Status:        match.Response.Status,
+		StatusCode:    match.Response.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(strings.NewReader(match.Response.Body)),
+		ContentLength: int64(len(match.Response.Body)),
+		Request:       req,
+	}, nil
+}
@@ -15,43 +15,54 @@
 package main
 
 import (
-	"flag"
-	"fmt"
 	"os"
 	"template"
 
-	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
 )
 
-// Flags are parsed in main.go.
-var activityId *string = flag.String("activityId", "z12gtjhq3qn2xxl2o224exwiqruvtda0i",
-	"The ID of the activity to display in the activities.get action. Must be the ID of a *public* activity.")
+var activitiesGetCommand = &command{
+	Name:        "get",
+	Description: "Display a public activity. ID must be the ID of a *public* activity.",
+	Args:        []arg{arg{"ID", false}},
+	Auth:        apiKey,
+	Run:         ActivitiesGet,
+	View:        activitiesGetView,
+	Demo:        []string{"z12gtjhq3qn2xxl2o224exwiqruvtda0i"},
+}
 
 // ActivitiesGet fetches and displays a specific public Google+ activity using
 // unauthenticated (simple) API access.
-func ActivitiesGet() os.Error {
+func ActivitiesGet(args []string) os.Error {
+	activityId := args[0]
+
 	// Get the *plus.Service.
 	// Getting specific public activities doesn't require OAuth.
-	p, err := api.NoAuthPlus()
+	p, err := plusService()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Getting activity with ID %q...\n", *activityId)
+	progressf("Getting activity with ID %q...\n", activityId)
 
 	// Get a specific public activity.
-	activity, err := p.Activities.Get(*activityId).Do()
+	activity, err := p.Activities.Get(activityId).Do()
 	if err != nil {
 		return err
 	}
 
 	// Display the activity.
-	return activitiesGetTemplate.Execute(os.Stdout, activity)
+	return display(activity, activitiesGetView)
 }
 
-var activitiesGetTemplate = template.Must(template.New("activities.get").Parse(`
-Author: {{.Actor.DisplayName}}
-Content: {{.Object.Content}}
-Attachment: {{$attachment := index .Object.Attachments 0}}{{$attachment.Url}}
+var activitiesGetView = &render.View{
+	Template: template.Must(template.New("activities.get").Parse(`
+Author: {{with .Actor}}{{.DisplayName}}{{end}}
+Content: {{with .Object}}{{.Content}}{{end}}
+Attachment: {{with .Object}}{{with .Attachments}}{{with index . 0}}{{.Url}}{{end}}{{end}}{{end}}
 
-`))
+`)),
+	Columns:  []string{"id", "actor/displayName", "object/content", "object/attachments/url"},
+	Resource: &plus.Activity{},
+}
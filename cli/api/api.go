@@ -18,105 +18,426 @@
 // To get started, enable the Google+ API service at
 // https://code.google.com/apis/console/ > Services. Then, simply fill in the
 // "config.json" file with your values from the API Access section of the same
-// site. You must specify the path to the config.json file using Config.
+// site. You must specify the path to the config.json file using Config. The
+// client secrets file ("client_secret.json") downloaded from the same site can
+// be used as the config file too.
 //
 // For authenticated API access, the user's OAuth tokens (access token and
 // refresh token) can be stored in a file. You can specify the path to this
 // file by setting the TokenPath variable.
+//
+// The package functions share a default Client, configured by Config and the
+// package variables. Programs which need several configurations at once
+// create their own Clients with NewClient:
+//
+// 	c, err := api.NewClient("config.json", &api.Options{
+// 		TokenStore: &api.FileTokenStore{Path: "token.json"},
+// 	})
+// 	if err != nil {
+// 		log.Fatal(err)
+// 	}
+// 	p, err := c.OAuthPlus()
 package api
 
 import (
 	"fmt"
+	"http"
 	"io"
+	"io/ioutil"
 	"json"
+	"log"
 	"os"
+	"strings"
+	"time"
 
 	"goauth2.googlecode.com/hg/oauth"
 	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/cassette"
+	"google-plus-go-starter.googlecode.com/hg/configcheck"
+	"google-plus-go-starter.googlecode.com/hg/core"
+	"google-plus-go-starter.googlecode.com/hg/fields"
+	"google-plus-go-starter.googlecode.com/hg/httpcache"
 	"google-plus-go-starter.googlecode.com/hg/noauth"
 )
 
-// config contains configuration values used to access the Google+ Platform
-// APIs. These values are loaded when you call Config.
-var config = struct {
-	// Your unique Google API Key for simple API Access.
-	APIKey string
-	// Your OAuth configuration information for protected user data access.
-	OAuthConfig oauth.Config
-}{}
+// Options configure a Client. The zero value is usable: the client then uses
+// http.DefaultTransport, logs to standard error, and doesn't store OAuth
+// tokens.
+type Options struct {
+	// ConfigOverrides maps setting names (see SettingNames) to values which
+	// take precedence over the config file and the environment variables,
+	// e.g. values of command-line flags. Empty values are ignored.
+	ConfigOverrides map[string]string
+	// TokenStore stores the OAuth tokens of OAuthPlus, to avoid forcing the
+	// user through the OAuth dance multiple times. If nil, tokens aren't
+	// stored.
+	TokenStore core.TokenStore
+	// Transport is the HTTP transport underlying all requests. It will default
+	// to http.DefaultTransport.
+	Transport http.RoundTripper
+	// Logger receives warnings and notices. If nil, they are written to
+	// standard error.
+	Logger *log.Logger
+	// OAuthFlow selects the OAuth flow used by OAuthPlus. It will default to
+	// LoopbackFlow if empty.
+	OAuthFlow string
+	// LoopbackTimeout is how long, in nanoseconds, the loopback OAuth flow
+	// waits for the user to authorize access in the browser. It will default
+	// to 5 minutes.
+	LoopbackTimeout int64
+	// ServiceAccountKeyPath specifies the path to the JSON key file of the
+	// service account used by ServiceAccountPlus, as downloaded from the API
+	// console.
+	ServiceAccountKeyPath string
+	// Fields is a partial-response selector, e.g. "items(id,displayName)",
+	// sent with every Google+ API request so that only the selected fields
+	// are returned. Optional.
+	Fields string
+	// Access selects the credentials which the config must hold, e.g.
+	// APIKeyAccess for a program which only uses NoAuthPlus. If empty, both
+	// the API key and the OAuth client are required.
+	Access string
+}
+
+// Client gives access to the Google+ API with one API config. Clients don't
+// share any state, so a program can use several configs at once.
+type Client struct {
+	Options
+
+	config core.Config
+	// sources maps setting names to the source of their value.
+	sources map[string]string
+	// problems lists the problems of config, which only InspectAccess keeps
+	// loaded.
+	problems configcheck.Problems
+	// core builds the transports of config.
+	core *core.Client
+
+	// recorder records all API requests once Record is called.
+	recorder *cassette.Recorder
+	// replayer answers all API requests once Replay is called.
+	replayer *cassette.Replayer
 
-// Config must be called with the path to the API config file before NoAuthPlus
-// and OAuthPlus are called.
-func Config(path string) os.Error {
-	return readJSON(&config, path)
+	// requiredScopes holds the scopes declared with RequireScopes.
+	requiredScopes map[string]bool
+
+	// now returns the current time in seconds, and sleep waits for ns
+	// nanoseconds. They are replaced in tests.
+	now   func() int64
+	sleep func(ns int64)
 }
 
-// NoAuthPlus returns a *plus.Service which provides unauthenticated (simple)
-// access to the Google+ API. It will initialize the *plus.Service for you.
+// NewClient returns a Client configured with the API config file at path and
+// options, which may be nil.
 //
-// You must call Config before calling this function.
-func NoAuthPlus() (*plus.Service, os.Error) {
-	if len(config.APIKey) == 0 {
-		return nil, os.NewError("APIKey missing")
+// The values of the file are layered: environment variables like PLUS_API_KEY
+// and PLUS_CLIENT_ID (see SettingNames) take precedence over the file, and
+// ConfigOverrides take precedence over both. Unset values get their defaults.
+// The resulting config is validated for the Access of options, and the error
+// lists every problem found.
+func NewClient(path string, options *Options) (*Client, os.Error) {
+	c := newClient()
+	if options != nil {
+		c.Options = *options
+	}
+	if err := c.load(path); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+func newClient() *Client {
+	c := &Client{
+		requiredScopes: make(map[string]bool),
+		now:            time.Seconds,
+		sleep:          func(ns int64) { time.Sleep(ns) },
+	}
+	c.core, _ = core.NewClient(&c.config)
+	return c
+}
+
+// load loads the API config file at path, replacing the current config.
+func (c *Client) load(path string) os.Error {
+	// Start from scratch if the config is loaded again.
+	c.config = core.Config{}
+	c.core, _ = core.NewClient(&c.config)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	config, client, err := core.Parse(data)
+	if err != nil {
+		return fmt.Errorf("couldn't parse %s: %s", path, err.String())
+	}
+	if client != nil && len(config.OAuthConfig.RedirectURL) == 0 {
+		config.OAuthConfig.RedirectURL = client.LocalRedirectURI()
+	}
+	c.config = *config
+
+	c.applySettings()
+	c.problems = c.validate()
+	if c.Access == InspectAccess {
+		// Keep the config with its problems, and the transports without it
+		// if they can't be built.
+		if cc, err := core.NewClient(&c.config); err == nil {
+			c.core = cc
+		}
+		return nil
+	}
+	if err := c.problems.Err(path); err != nil {
+		return err
+	}
+	cc, err := core.NewClient(&c.config)
+	if err != nil {
+		return err
+	}
+	c.core = cc
+	return nil
+}
+
+// logf writes a notice to the Logger of c, or to standard error.
+func (c *Client) logf(format string, args ...interface{}) {
+	if c.Logger == nil {
+		fmt.Fprintf(os.Stderr, format+"\n", args...)
+		return
+	}
+	c.Logger.Printf(format, args...)
+}
+
+// warnf writes a warning like logf.
+func (c *Client) warnf(format string, args ...interface{}) {
+	c.logf("[warning] "+format, args...)
+}
+
+// CacheStats returns how many API requests were served from the response
+// cache so far.
+func (c *Client) CacheStats() httpcache.Stats {
+	return c.core.CacheStats()
+}
+
+// Record starts recording all API requests and responses, with secrets
+// redacted. Call SaveRecording to write them to a cassette file.
+func (c *Client) Record() {
+	c.recorder = &cassette.Recorder{}
+}
+
+// SaveRecording writes the API requests recorded since Record was called to
+// the cassette file at path.
+func (c *Client) SaveRecording(path string) os.Error {
+	if c.recorder == nil {
+		return os.NewError("Record was not called")
+	}
+	return c.recorder.Cassette().Save(path)
+}
+
+// Replay makes all API requests be answered from the cassette file at path,
+// written by SaveRecording, without network access. OAuthPlus doesn't need
+// OAuth tokens while replaying.
+func (c *Client) Replay(path string) os.Error {
+	cas, err := cassette.Load(path)
+	if err != nil {
+		return err
+	}
+	c.replayer = &cassette.Replayer{Cassette: cas}
+	return nil
+}
+
+// baseTransport returns the HTTP transport underlying the noauth and oauth
+// transports, built by core.Client.Transport and recorded or replayed. It asks
+// for the Fields only, if set.
+func (c *Client) baseTransport() http.RoundTripper {
+	var t http.RoundTripper
+	if c.replayer != nil {
+		t = c.replayer
+	} else {
+		t = c.core.Transport(core.TransportFunc(func() http.RoundTripper {
+			if c.Transport == nil {
+				return http.DefaultTransport
+			}
+			return c.Transport
+		}))
+		if c.recorder != nil {
+			c.recorder.Transport = t
+			t = c.recorder
+		}
 	}
-	t := &noauth.Transport{APIKey: config.APIKey}
-	return plus.New(t.Client())
+	if len(c.Fields) > 0 {
+		t = &fields.Transport{Fields: c.Fields, Transport: t}
+	}
+	return t
+}
+
+// KeyStats returns the usage counters of each key in the APIKeys pool, or nil
+// if the config file doesn't list any.
+func (c *Client) KeyStats() []noauth.KeyStats {
+	return c.core.KeyStats()
 }
 
-// TokenPath specifies the path to the file where OAuth access and refresh
-// tokens will be read and written. See OAuthPlus for more information.
-var TokenPath string
+// NoAuthPlus returns a *plus.Service which provides unauthenticated (simple)
+// access to the Google+ API. It will initialize the *plus.Service for you.
+func (c *Client) NoAuthPlus() (*plus.Service, os.Error) {
+	return c.core.NoAuthPlus(c.baseTransport())
+}
+
+// OAuth flows that OAuthPlus can use to guide the user through the OAuth
+// dance.
+const (
+	// LoopbackFlow receives the authorization code on a temporary HTTP
+	// listener on 127.0.0.1, which the browser is redirected to.
+	LoopbackFlow = "loopback"
+	// ManualFlow asks the user to copy the authorization code from the
+	// browser and paste it on the command line. It uses the RedirectURL of
+	// the config file.
+	ManualFlow = "manual"
+	// DeviceFlow asks the user to enter a code on a verification page, in a
+	// browser on any device, and polls the token endpoint until access is
+	// authorized. It suits machines without a browser, e.g. over SSH.
+	DeviceFlow = "device"
+)
 
 // OAuthPlus returns a *plus.Service which provides authenticated (OAuth) access
 // to the Google+ API. It will guide the user through the OAuth dance if
 // necessary and initialize the *plus.Service.
 //
-// If TokenPath is set, OAuthPlus will attempt to read and write the OAuth
-// access and refresh tokens to the file specified to avoid forcing the user
-// through the OAuth dance multiple times.
+// If the Client has a TokenStore, OAuthPlus reads the OAuth access and refresh
+// tokens from it, and writes them to it, to avoid forcing the user through the
+// OAuth dance multiple times. Tokens refreshed while the *plus.Service is used
+// are written back too.
+//
+// OAuthPlus requests the scopes of the config file and those declared with
+// RequireScopes. If the stored tokens lack a declared scope, the user is guided
+// through the OAuth dance again, and the new tokens keep the scopes granted
+// before (incremental authorization).
 //
-// You must call Config before calling this function.
-func OAuthPlus() (*plus.Service, os.Error) {
-	transport := &oauth.Transport{Config: &config.OAuthConfig}
-
-	// If a path is specified, read OAuth tokens from the file.
-	if len(TokenPath) > 0 {
-		token := &oauth.Token{}
-		if err := readJSON(token, TokenPath); err != nil {
-			fmt.Fprintf(os.Stderr, "[warning] Couldn't read oauth.Token from %s: %s\n",
-				TokenPath, err.String())
-		} else {
-			transport.Token = token
+// The OAuth dance uses the flow selected by OAuthFlow.
+func (c *Client) OAuthPlus() (*plus.Service, os.Error) {
+	t, err := c.authorize(false)
+	if err != nil {
+		return nil, err
+	}
+	return plus.New(&http.Client{Transport: t})
+}
+
+// newOAuthTransport returns an oauth.Transport without a token, for the scopes
+// of the config file and the required scopes.
+func (c *Client) newOAuthTransport() *oauth.Transport {
+	return c.core.OAuthTransport(c.baseTransport(), c.scopes())
+}
+
+// authTransport returns the HTTP transport underlying OAuth requests.
+func (c *Client) authTransport() http.RoundTripper {
+	return core.AuthTransport(c.baseTransport())
+}
+
+// authorize returns an http.RoundTripper which makes OAuth-authenticated
+// requests, as described by OAuthPlus. If login is set, it guides the user
+// through the OAuth dance even if the TokenStore holds tokens.
+func (c *Client) authorize(login bool) (http.RoundTripper, os.Error) {
+	transport := c.newOAuthTransport()
+
+	// Recorded responses don't depend on the OAuth tokens, so don't bother the
+	// user with the OAuth dance while replaying.
+	if c.replayer != nil {
+		transport.Token = &oauth.Token{AccessToken: cassette.Redacted}
+		return transport, nil
+	}
+
+	if c.TokenStore != nil && !login {
+		token, err := c.TokenStore.ReadToken()
+		if _, ok := err.(*DecryptError); ok {
+			// Don't replace tokens that can't be decrypted, e.g. with the
+			// wrong passphrase. Login replaces them.
+			return nil, err
+		}
+		if err != nil {
+			// Other unreadable tokens, e.g. a corrupt file, are replaced
+			// by the OAuth dance.
+			c.warnf("%s; running the OAuth dance again", err.String())
+		}
+		transport.Token = token
+	}
+	// The saver remembers the stored token, so that it is only written back
+	// once it changes.
+	saver := core.NewTokenSaver(transport, c.TokenStore)
+	saver.Logf = c.warnf
+	if transport.Token != nil {
+		if granted, ok := c.hasRequiredScopes(saver); !ok {
+			// Run the OAuth dance again for the missing scopes. Ask for the
+			// scopes granted before too, since only some flows keep them
+			// (include_granted_scopes).
+			transport.Config.Scope = mergeScopes(transport.Config.Scope, granted)
+			transport.Token = nil
 		}
 	}
 
 	if transport.Token == nil {
 		// Retrieve tokens through the OAuth dance.
-		if err := oauthDance(transport, os.Stdin, os.Stdout); err != nil {
+		var err os.Error
+		switch c.OAuthFlow {
+		case "", LoopbackFlow:
+			timeout := c.LoopbackTimeout
+			if timeout <= 0 {
+				timeout = defaultLoopbackTimeout
+			}
+			err = loopbackDance(transport, os.Stdout, timeout)
+		case ManualFlow:
+			err = oauthDance(transport, os.Stdin, os.Stdout)
+		case DeviceFlow:
+			err = deviceDance(transport, c.config.DeviceCodeURL, os.Stdout, c.sleep)
+		default:
+			err = fmt.Errorf("unknown OAuth flow %q", c.OAuthFlow)
+		}
+		if err != nil {
 			return nil, err
 		}
+	}
 
-		// If a path is specified, save the tokens to the file. 
-		if len(TokenPath) > 0 {
-			if err := writeJSON(transport.Token, TokenPath); err != nil {
-				fmt.Fprintf(os.Stderr, "[warning] Couldn't write oauth.Token to %s: %s\n",
-					TokenPath, err.String())
-			}
-		}
+	if c.TokenStore == nil {
+		return transport, nil
 	}
+	// Save the tokens now if they came from the OAuth dance, and whenever
+	// they are refreshed later.
+	saver.SaveIfChanged()
+	return saver, nil
+}
 
-	return plus.New(transport.Client())
+// hasRequiredScopes reports whether the token of saver was granted the scopes
+// declared with RequireScopes, and returns the scopes it was granted. The
+// token information endpoint is only asked if scopes were declared, and the
+// access token is refreshed first if it has expired. If the endpoint can't
+// tell, the token is assumed to be fine.
+func (c *Client) hasRequiredScopes(saver *core.TokenSaver) (granted string, ok bool) {
+	if len(c.requiredScopes) == 0 {
+		return "", true
+	}
+	info, _, err := c.fetchTokenInfo(saver)
+	if err != nil {
+		c.warnf("Couldn't check the scopes of oauth.Token: %s", err.String())
+		return "", true
+	}
+	missing := c.missingScopes(info.Scope)
+	if len(missing) == 0 {
+		return info.Scope, true
+	}
+	c.logf("The stored OAuth tokens lack the scopes %s", strings.Join(missing, ", "))
+	return info.Scope, false
 }
 
 // oauthDance creates a new *oauth.Token for transport by guiding the user
-// through the OAuth flow. transport's Token field will be set to the new
-// *oauth.Token.
+// through the OAuth flow and reading the authorization code from r
+// (ManualFlow). The exchange is protected with PKCE. transport's Token field
+// will be set to the new *oauth.Token.
 func oauthDance(transport *oauth.Transport, r io.Reader, w io.Writer) os.Error {
+	p, err := newPKCE()
+	if err != nil {
+		return err
+	}
+
 	// Guide the user through the OAuth flow and read the authorization code.
 	if _, err := fmt.Fprintln(w, "Open your browser and go to the following URL:"); err != nil {
 		return err
 	}
-	if _, err := fmt.Fprintln(w, transport.Config.AuthCodeURL(""), "\n"); err != nil {
+	if _, err := fmt.Fprintln(w, p.authCodeURL(transport.Config, ""), "\n"); err != nil {
 		return err
 	}
 	if _, err := fmt.Fprint(w, "Enter the authorization code: "); err != nil {
@@ -127,8 +448,7 @@ func oauthDance(transport *oauth.Transport, r io.Reader, w io.Writer) os.Error {
 		return err
 	}
 	// Exchange the authorization code for access and refresh tokens.
-	_, err := transport.Exchange(code)
-	return err
+	return p.exchange(transport, code)
 }
 
 func readJSON(v interface{}, path string) os.Error {
@@ -140,13 +460,3 @@ func readJSON(v interface{}, path string) os.Error {
 
 	return json.NewDecoder(file).Decode(v)
 }
-
-func writeJSON(v interface{}, path string) os.Error {
-	file, err := os.Create(path)
-	if err != nil {
-		return err
-	}
-	defer file.Close()
-
-	return json.NewEncoder(file).Encode(v)
-}
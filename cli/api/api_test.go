@@ -0,0 +1,467 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"http"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+	"google-plus-go-starter.googlecode.com/hg/plustest"
+)
+
+// setUp starts a fake Google+ API server and configures the package to use
+// it. The returned function cleans up.
+func setUp(t *testing.T) (*plustest.Server, func()) {
+	s := plustest.NewServer()
+	s.AddKey("key")
+	s.AddToken("token", "1")
+	s.AddPerson(&plus.Person{Id: "1", DisplayName: "Larry Page"})
+
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cleanUp := func() {
+		s.Close()
+		os.RemoveAll(dir)
+		TokenPath = ""
+	}
+
+	configPath := filepath.Join(dir, "config.json")
+	configJSON := fmt.Sprintf(`{"BaseURL": %q, "APIKey": "key",
+		"OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`, s.BaseURL())
+	if err := ioutil.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
+		cleanUp()
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err != nil {
+		cleanUp()
+		t.Fatal(err)
+	}
+
+	TokenPath = filepath.Join(dir, "token.json")
+	if err := ioutil.WriteFile(TokenPath, []byte(`{"AccessToken": "token"}`), 0600); err != nil {
+		cleanUp()
+		t.Fatal(err)
+	}
+	return s, cleanUp
+}
+
+func TestNoAuthPlusBaseURL(t *testing.T) {
+	s, cleanUp := setUp(t)
+	defer cleanUp()
+
+	p, err := NoAuthPlus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	feed, err := p.People.Search("larry").Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(feed.Items) != 1 || feed.Items[0].DisplayName != "Larry Page" {
+		t.Errorf("unexpected search results: %v", feed.Items)
+	}
+	if calls := s.Calls("people.search"); calls != 1 {
+		t.Errorf("expected the request to reach the fake server, got %d calls", calls)
+	}
+}
+
+func TestOAuthPlusBaseURL(t *testing.T) {
+	_, cleanUp := setUp(t)
+	defer cleanUp()
+
+	p, err := OAuthPlus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	me, err := p.People.Get("me").Do()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me.Id != "1" {
+		t.Errorf("expected me to be user 1, got %q", me.Id)
+	}
+}
+
+func TestConfigRejectsInvalidBaseURL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"BaseURL": "localhost/plus/v1/"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err == nil {
+		t.Error("expected an error for a relative BaseURL")
+	}
+}
+
+func TestConfigClientSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A client secrets file, with an API key added.
+	configPath := filepath.Join(dir, "client_secret.json")
+	configJSON := `{"APIKey": "key", "installed": {
+		"client_id": "123.apps.googleusercontent.com",
+		"client_secret": "secret",
+		"auth_uri": "https://accounts.example.com/auth",
+		"token_uri": "https://accounts.example.com/token",
+		"redirect_uris": ["http://localhost", "urn:ietf:wg:oauth:2.0:oob"]
+	}}`
+	if err := ioutil.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err != nil {
+		t.Fatal(err)
+	}
+	c := defaultClient.config.OAuthConfig
+	if defaultClient.config.APIKey != "key" || c.ClientId != "123.apps.googleusercontent.com" || c.ClientSecret != "secret" ||
+		c.AuthURL != "https://accounts.example.com/auth" || c.TokenURL != "https://accounts.example.com/token" ||
+		c.RedirectURL != "urn:ietf:wg:oauth:2.0:oob" || c.Scope != PlusMeScope {
+		t.Errorf("unexpected config %+v", c)
+	}
+
+	if err := ioutil.WriteFile(configPath, []byte(`{"installed": {}, "web": {}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err == nil {
+		t.Error("expected an error for a file with both clients")
+	}
+}
+
+func TestConfigValidation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Every problem is reported at once.
+	configPath := filepath.Join(dir, "config.json")
+	configJSON := `{
+		"APIKey": "YOUR_API_KEY",
+		"BaseURL": "localhost/plus/v1/",
+		"OAuthConfig": {
+			"ClientId": "YOUR_CLIENT_ID",
+			"ClientSecret": "YOUR_CLIENT_SECRET",
+			"Scope": "https://www.googleapis.com/auth/plus.me plus.stream",
+			"TokenURL": "accounts.google.com/o/oauth2/token"
+		}
+	}`
+	if err := ioutil.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = Config(configPath)
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, problem := range []string{"APIKey", "YOUR_CLIENT_ID", "YOUR_CLIENT_SECRET", `"plus.stream"`, "BaseURL", "TokenURL"} {
+		if !strings.Contains(err.String(), problem) {
+			t.Errorf("expected the error to mention %s: %s", problem, err)
+		}
+	}
+
+	// A missing client ID and secret are reported separately.
+	configJSON = `{"APIKey": "key", "OAuthConfig": {"ClientId": "", "ClientSecret": ""}}`
+	if err := ioutil.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	err = Config(configPath)
+	if err == nil {
+		t.Fatal("expected an error without a client ID and secret")
+	}
+	for _, problem := range []string{"ClientId is missing", "ClientSecret is missing"} {
+		if !strings.Contains(err.String(), problem) {
+			t.Errorf("expected the error to mention %q: %s", problem, err)
+		}
+	}
+
+	if err := ioutil.WriteFile(configPath, []byte("{\n\t\"APIKey\": \"key\",\n}"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err == nil || !strings.Contains(err.String(), "line 3") {
+		t.Errorf("expected a parse error on line 3, got %v", err)
+	}
+}
+
+type AccessTest struct {
+	access   string
+	config   string
+	problems []string // The expected problems, if any.
+}
+
+var AccessTests = []AccessTest{
+	// An API key is enough for simple API access, and an OAuth client for
+	// OAuth.
+	AccessTest{APIKeyAccess, `{"APIKey": "key"}`, nil},
+	AccessTest{APIKeyAccess, `{"APIKeys": [{"Key": "key"}]}`, nil},
+	AccessTest{APIKeyAccess, `{"OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`, []string{"APIKey is missing"}},
+	AccessTest{OAuthAccess, `{"OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`, nil},
+	AccessTest{OAuthAccess, `{"APIKey": "key"}`, []string{"ClientId is missing", "ClientSecret is missing"}},
+	// A service account needs neither, but the other values are checked.
+	AccessTest{ServiceAccountAccess, `{}`, nil},
+	AccessTest{ServiceAccountAccess, `{"OAuthConfig": {"Scope": "plus.me"}}`, []string{`"plus.me"`}},
+	// By default, both are required.
+	AccessTest{"", `{"APIKey": "key"}`, []string{"ClientId is missing", "ClientSecret is missing"}},
+	AccessTest{"", `{"OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`, []string{"APIKey is missing"}},
+}
+
+func TestConfigAccess(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	for _, test := range AccessTests {
+		if err := ioutil.WriteFile(configPath, []byte(test.config), 0600); err != nil {
+			t.Fatal(err)
+		}
+		_, err := NewClient(configPath, &Options{Access: test.access})
+		if len(test.problems) == 0 {
+			if err != nil {
+				t.Errorf("%q access with %s: %s", test.access, test.config, err)
+			}
+			continue
+		}
+		if err == nil {
+			t.Errorf("%q access with %s: expected an error", test.access, test.config)
+			continue
+		}
+		for _, problem := range test.problems {
+			if !strings.Contains(err.String(), problem) {
+				t.Errorf("%q access with %s: expected the error to mention %s: %s", test.access, test.config, problem, err)
+			}
+		}
+	}
+}
+
+func TestConfigInspect(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An invalid config is loaded, and its problems are shown with the values.
+	configPath := filepath.Join(dir, "config.json")
+	configJSON := `{"APIKey": "YOUR_API_KEY", "BaseURL": "localhost", "Cache": {"MaxEntries": -1}}`
+	if err := ioutil.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, err := NewClient(configPath, &Options{Access: InspectAccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := len(c.ConfigProblems()); n != 5 {
+		t.Errorf("expected 5 problems but got %d: %v", n, c.ConfigProblems())
+	}
+	expected := map[string]string{
+		"APIKey":   "placeholder",
+		"BaseURL":  "isn't an absolute",
+		"ClientId": "ClientId is missing",
+		"Cache":    "Cache.MaxEntries can't be negative",
+		"Scope":    "",
+	}
+	for _, v := range c.EffectiveConfig() {
+		e, ok := expected[v.Name]
+		if !ok {
+			continue
+		}
+		if len(e) == 0 && len(v.Problem) > 0 || !strings.Contains(v.Problem, e) {
+			t.Errorf("%s: expected a problem mentioning %q but got %q", v.Name, e, v.Problem)
+		}
+	}
+}
+
+func TestConfigLayers(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, env := range []string{"PLUS_API_KEY", "PLUS_CLIENT_ID", "PLUS_CLIENT_SECRET"} {
+		defer os.Setenv(env, os.Getenv(env))
+	}
+	defer func() { ConfigOverrides = make(map[string]string) }()
+
+	configPath := filepath.Join(dir, "config.json")
+	configJSON := `{"APIKey": "file-key-0123456789", "OAuthConfig": {"ClientId": "file-client", "ClientSecret": "file-secret-0123456789"}}`
+	if err := ioutil.WriteFile(configPath, []byte(configJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("PLUS_API_KEY", "")
+	os.Setenv("PLUS_CLIENT_ID", "env-client")
+	os.Setenv("PLUS_CLIENT_SECRET", "env-secret-0123456789")
+	ConfigOverrides["ClientSecret"] = "flag-secret-0123456789"
+	if err := Config(configPath); err != nil {
+		t.Fatal(err)
+	}
+	if defaultClient.config.APIKey != "file-key-0123456789" || defaultClient.config.OAuthConfig.ClientId != "env-client" ||
+		defaultClient.config.OAuthConfig.ClientSecret != "flag-secret-0123456789" || defaultClient.config.OAuthConfig.TokenURL != endpoint.GoogleTokenURL {
+		t.Errorf("unexpected config %+v", defaultClient.config)
+	}
+
+	expected := map[string]ConfigValue{
+		"APIKey":       ConfigValue{"APIKey", "file********", SourceFile, ""},
+		"ClientId":     ConfigValue{"ClientId", "env-client", SourceEnv + " PLUS_CLIENT_ID", ""},
+		"ClientSecret": ConfigValue{"ClientSecret", "flag********", SourceOverride, ""},
+		"TokenURL":     ConfigValue{"TokenURL", endpoint.GoogleTokenURL, SourceDefault, ""},
+		"BaseURL":      ConfigValue{"BaseURL", "", "", ""},
+	}
+	for _, v := range EffectiveConfig() {
+		if e, ok := expected[v.Name]; ok && (v.Value != e.Value || v.Source != e.Source) {
+			t.Errorf("expected %+v but got %+v", e, v)
+		}
+	}
+
+	ConfigOverrides["Bogus"] = "value"
+	if err := Config(configPath); err == nil || !strings.Contains(err.String(), `unknown setting "Bogus"`) {
+		t.Errorf("expected an error for an unknown setting, got %v", err)
+	}
+}
+
+func TestClients(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// Each Client has its own config, token file and transport, and the
+	// Clients are used concurrently.
+	done := make(chan os.Error)
+	names := []string{"Larry Page", "Sergey Brin"}
+	for i, name := range names {
+		s := plustest.NewServer()
+		defer s.Close()
+		key, token := fmt.Sprint("key", i), fmt.Sprint("token", i)
+		s.AddKey(key)
+		s.AddToken(token, "1")
+		s.AddPerson(&plus.Person{Id: "1", DisplayName: name})
+
+		configPath := filepath.Join(dir, key+".json")
+		if err := ioutil.WriteFile(configPath, []byte(fmt.Sprintf(`{"APIKey": %q, "OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`, key)), 0600); err != nil {
+			t.Fatal(err)
+		}
+		tokenPath := filepath.Join(dir, token+".json")
+		if err := writeJSON(&oauth.Token{AccessToken: token}, tokenPath); err != nil {
+			t.Fatal(err)
+		}
+		c, err := NewClient(configPath, &Options{
+			TokenStore: &FileTokenStore{Path: tokenPath},
+			Transport:  s.Transport(nil),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		go func(name string) {
+			done <- checkClient(c, name)
+		}(name)
+	}
+	for _ = range names {
+		if err := <-done; err != nil {
+			t.Error(err)
+		}
+	}
+}
+
+// queryRecorder records the querystrings of the requests it sends.
+type queryRecorder struct {
+	transport http.RoundTripper
+	queries   []string
+}
+
+func (r *queryRecorder) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	r.queries = append(r.queries, req.URL.RawQuery)
+	return r.transport.RoundTrip(req)
+}
+
+func TestFields(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := plustest.NewServer()
+	defer s.Close()
+	s.AddKey("key")
+	s.AddPerson(&plus.Person{Id: "1", DisplayName: "Larry Page"})
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"APIKey": "key", "OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	r := &queryRecorder{transport: s.Transport(nil)}
+	c, err := NewClient(configPath, &Options{Transport: r, Fields: "id,displayName"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.NoAuthPlus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.People.Get("1").Do(); err != nil {
+		t.Fatal(err)
+	}
+	if len(r.queries) != 1 || !strings.Contains(r.queries[0], "fields=id%2CdisplayName") {
+		t.Errorf("expected the fields parameter to be sent, got the querystrings %q", r.queries)
+	}
+}
+
+// checkClient checks that both the NoAuthPlus and OAuthPlus of c find the
+// person with the given name.
+func checkClient(c *Client, name string) os.Error {
+	p, err := c.NoAuthPlus()
+	if err != nil {
+		return err
+	}
+	person, err := p.People.Get("1").Do()
+	if err != nil {
+		return err
+	}
+	if person.DisplayName != name {
+		return fmt.Errorf("NoAuthPlus: expected %q but got %q", name, person.DisplayName)
+	}
+
+	if p, err = c.OAuthPlus(); err != nil {
+		return err
+	}
+	if person, err = p.People.Get("me").Do(); err != nil {
+		return err
+	}
+	if person.DisplayName != name {
+		return fmt.Errorf("OAuthPlus: expected %q but got %q", name, person.DisplayName)
+	}
+	return nil
+}
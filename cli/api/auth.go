@@ -0,0 +1,174 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"http"
+	"json"
+	"os"
+	"url"
+
+	"google-plus-go-starter.googlecode.com/hg/core"
+)
+
+// TokenInfo is the information about an access token returned by the OAuth
+// token information endpoint.
+type TokenInfo struct {
+	// IssuedTo is the client ID of the application the token was issued to.
+	IssuedTo string `json:"issued_to"`
+	Audience string `json:"audience"`
+	UserId   string `json:"user_id"`
+	// Scope lists the granted scopes, separated by spaces.
+	Scope string `json:"scope"`
+	// ExpiresIn is the number of seconds until the token expires.
+	ExpiresIn     int64  `json:"expires_in"`
+	Email         string `json:"email"`
+	VerifiedEmail bool   `json:"verified_email"`
+	AccessType    string `json:"access_type"`
+}
+
+// TokenStatus describes the OAuth tokens held by a TokenStore.
+type TokenStatus struct {
+	// Encrypted reports whether the tokens are stored encrypted.
+	Encrypted bool
+	// HasRefreshToken reports whether there is a refresh token, so that the
+	// access token can be renewed without the user.
+	HasRefreshToken bool
+	// Refreshed reports whether the access token had expired and was
+	// refreshed by AuthStatus.
+	Refreshed bool
+	// Info is the information about the access token.
+	Info *TokenInfo
+}
+
+// oauthError is the body of an error response of the OAuth endpoints.
+type oauthError struct {
+	Error       string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+// errNoTokenStore is returned by the methods which need stored OAuth tokens
+// when the Client has no TokenStore.
+var errNoTokenStore = os.NewError("no TokenStore is set")
+
+// AuthStatus checks the OAuth tokens held by the TokenStore with the token
+// information endpoint, refreshing the access token first if it has expired.
+// It returns an error if there are no tokens or if they are invalid, e.g.
+// because they were revoked.
+func (c *Client) AuthStatus() (*TokenStatus, os.Error) {
+	if c.TokenStore == nil {
+		return nil, errNoTokenStore
+	}
+	token, err := c.TokenStore.ReadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, core.ErrNoToken
+	}
+	status := &TokenStatus{HasRefreshToken: len(token.RefreshToken) > 0}
+	if e, ok := c.TokenStore.(interface {
+		Encrypted() bool
+	}); ok {
+		status.Encrypted = e.Encrypted()
+	}
+
+	transport := c.newOAuthTransport()
+	transport.Token = token
+	saver := core.NewTokenSaver(transport, c.TokenStore)
+	saver.Logf = c.warnf
+	status.Info, status.Refreshed, err = c.fetchTokenInfo(saver)
+	return status, err
+}
+
+// fetchTokenInfo returns the information about the access token of saver
+// from the token information endpoint, refreshing and saving it first if it
+// has expired. refreshed reports whether it was.
+func (c *Client) fetchTokenInfo(saver *core.TokenSaver) (info *TokenInfo, refreshed bool, err os.Error) {
+	if refreshed, err = saver.RefreshIfExpired(); err != nil {
+		return nil, false, fmt.Errorf("couldn't refresh the access token: %s", err.String())
+	}
+
+	client := &http.Client{Transport: c.authTransport()}
+	resp, err := client.PostForm(c.config.TokenInfoURL, url.Values{"access_token": {saver.Transport.Token.AccessToken}})
+	if err != nil {
+		return nil, refreshed, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, refreshed, fmt.Errorf("the access token is invalid: %s", describeOAuthError(resp))
+	}
+	info = &TokenInfo{}
+	if err := json.NewDecoder(resp.Body).Decode(info); err != nil {
+		return nil, refreshed, err
+	}
+	return info, refreshed, nil
+}
+
+// Login guides the user through the OAuth dance, as OAuthPlus does, even if
+// the TokenStore already holds tokens, and stores the new tokens.
+func (c *Client) Login() os.Error {
+	if c.TokenStore == nil {
+		return errNoTokenStore
+	}
+	_, err := c.authorize(true)
+	return err
+}
+
+// Logout revokes the OAuth tokens held by the TokenStore with the revocation
+// endpoint, then deletes them. Tokens that were already revoked are deleted
+// as well. The tokens are kept if the revocation fails otherwise, so that it
+// can be retried.
+func (c *Client) Logout() os.Error {
+	if c.TokenStore == nil {
+		return errNoTokenStore
+	}
+	token, err := c.TokenStore.ReadToken()
+	if err != nil {
+		return err
+	}
+	if token == nil {
+		return core.ErrNoToken
+	}
+
+	// Revoking the refresh token revokes its access tokens too.
+	revoke := token.RefreshToken
+	if len(revoke) == 0 {
+		revoke = token.AccessToken
+	}
+	client := &http.Client{Transport: c.authTransport()}
+	resp, err := client.PostForm(c.config.RevokeURL, url.Values{"token": {revoke}})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		if e := describeOAuthError(resp); e != "invalid_token" {
+			return fmt.Errorf("couldn't revoke the token: %s", e)
+		}
+	}
+	return c.TokenStore.DeleteToken()
+}
+
+// describeOAuthError returns the error code of an OAuth endpoint error
+// response, or its status if the body isn't an OAuth error.
+func describeOAuthError(resp *http.Response) string {
+	e := &oauthError{}
+	if err := json.NewDecoder(resp.Body).Decode(e); err != nil || len(e.Error) == 0 {
+		return resp.Status
+	}
+	return e.Error
+}
@@ -0,0 +1,251 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-plus-go-starter.googlecode.com/hg/sealed"
+)
+
+func TestAuthActions(t *testing.T) {
+	s := newFakeOAuthServer()
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(s.configJSON()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err != nil {
+		t.Fatal(err)
+	}
+	TokenPath = filepath.Join(dir, "token.json")
+	OAuthFlow = DeviceFlow
+	defer func(f func(int64)) { defaultClient.sleep = f }(defaultClient.sleep)
+	defaultClient.sleep = func(int64) {}
+	defer func() { TokenPath, OAuthFlow = "", "" }()
+
+	if _, err := AuthStatus(); err == nil {
+		t.Error("status: expected an error without tokens")
+	}
+
+	// Log in, replacing an existing token file.
+	if err := writeJSON(&oauth.Token{AccessToken: "bogus"}, TokenPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := Login(); err != nil {
+		t.Fatal(err)
+	}
+	status, err := AuthStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.HasRefreshToken || status.Refreshed || status.Info.Email != "larry@example.com" ||
+		status.Info.Scope != PlusMeScope || status.Info.ExpiresIn != 3599 {
+		t.Errorf("unexpected status %+v, %+v", status, status.Info)
+	}
+
+	// An expired access token is refreshed and saved.
+	token, _, err := (&FileTokenStore{Path: TokenPath}).read()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token.TokenExpiry = 1
+	if err := writeJSON(token, TokenPath); err != nil {
+		t.Fatal(err)
+	}
+	if status, err := AuthStatus(); err != nil || !status.Refreshed {
+		t.Errorf("expected the access token to be refreshed, got %+v, %v", status, err)
+	}
+	refreshed, _, err := (&FileTokenStore{Path: TokenPath}).read()
+	if err != nil || refreshed.AccessToken == token.AccessToken || refreshed.RefreshToken != token.RefreshToken || refreshed.Expired() {
+		t.Errorf("the refreshed token wasn't saved: %v, %v", refreshed, err)
+	}
+
+	// Logging out revokes the tokens and deletes the file.
+	if err := Logout(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(TokenPath); err == nil {
+		t.Error("the token file wasn't deleted")
+	}
+	if err := Logout(); err == nil {
+		t.Error("logout: expected an error without tokens")
+	}
+
+	// Revoked tokens are reported as invalid, and can still be logged out.
+	if err := writeJSON(refreshed, TokenPath); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := AuthStatus(); err == nil {
+		t.Error("status: expected an error for revoked tokens")
+	}
+	if err := Logout(); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestRequireScopes(t *testing.T) {
+	s := newFakeOAuthServer()
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(s.configJSON()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err != nil {
+		t.Fatal(err)
+	}
+	TokenPath = filepath.Join(dir, "token.json")
+	OAuthFlow = DeviceFlow
+	defer func(f func(int64)) { defaultClient.sleep = f }(defaultClient.sleep)
+	defaultClient.sleep = func(int64) {}
+	defer func() { TokenPath, OAuthFlow, defaultClient.requiredScopes = "", "", make(map[string]bool) }()
+
+	const (
+		me      = PlusMeScope
+		stream  = "https://www.googleapis.com/auth/plus.stream"
+		circles = "https://www.googleapis.com/auth/plus.circles"
+	)
+	// Each step declares the scopes of one command, like cli/main.go does, and
+	// expects the OAuth dance to run if the stored tokens lack one of them. The
+	// dance asks for the scopes granted before too.
+	steps := []struct {
+		require  []string
+		dance    bool
+		requests string
+	}{
+		{nil, true, me},
+		{nil, false, ""},
+		{[]string{me}, false, ""},
+		{[]string{me, stream}, true, me + " " + stream},
+		{[]string{circles}, true, circles + " " + me + " " + stream},
+		{[]string{stream}, false, ""},
+		{[]string{circles, stream}, false, ""},
+	}
+	for i, step := range steps {
+		defaultClient.requiredScopes = make(map[string]bool)
+		RequireScopes(step.require...)
+		s.scope = ""
+		before := s.issued
+		if _, err := std().authorize(false); err != nil {
+			t.Fatalf("step %d: %s", i, err)
+		}
+		if danced := s.scope != ""; danced != step.dance || s.scope != step.requests {
+			t.Errorf("step %d: expected dance %v for %q, got %v for %q", i, step.dance, step.requests, danced, s.scope)
+		}
+		if !step.dance && s.issued != before {
+			t.Errorf("step %d: unexpected token request", i)
+		}
+	}
+
+	// The last tokens kept the scopes granted before.
+	status, err := AuthStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Info.Scope != circles+" "+me+" "+stream {
+		t.Errorf("unexpected scopes %q", status.Info.Scope)
+	}
+}
+
+func TestAuthorizeUnreadableTokens(t *testing.T) {
+	s := newFakeOAuthServer()
+	defer s.Close()
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(s.configJSON()), 0600); err != nil {
+		t.Fatal(err)
+	}
+	tokenPath := filepath.Join(dir, "token.json")
+	clientWith := func(passphrase string) (*Client, *bytes.Buffer) {
+		logs := &bytes.Buffer{}
+		c, err := NewClient(configPath, &Options{
+			TokenStore: &FileTokenStore{Path: tokenPath, passphrase: []byte(passphrase)},
+			Logger:     log.New(logs, "", 0),
+			OAuthFlow:  DeviceFlow,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.sleep = func(int64) {}
+		return c, logs
+	}
+
+	// A corrupt token file is replaced by the OAuth dance, with a warning.
+	if err := ioutil.WriteFile(tokenPath, []byte("{corrupt"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	c, logs := clientWith("")
+	if _, err := c.authorize(false); err != nil {
+		t.Fatal(err)
+	}
+	if len(s.scope) == 0 {
+		t.Error("expected the OAuth dance to run")
+	}
+	if !strings.Contains(logs.String(), "Couldn't read oauth.Token") {
+		t.Errorf("expected a warning, got %q", logs.String())
+	}
+	store := &FileTokenStore{Path: tokenPath}
+	token, _, err := store.read()
+	if err != nil || len(token.RefreshToken) == 0 {
+		t.Fatalf("the new tokens weren't saved: %v, %v", token, err)
+	}
+
+	// A token file which can't be decrypted is kept, and no dance runs.
+	defer func(p *sealed.Params) { sealed.DefaultParams = p }(sealed.DefaultParams)
+	sealed.DefaultParams = &sealed.Params{LogN: 4, R: 1, P: 1}
+	store.passphrase = []byte("passphrase")
+	if err := store.write(token, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := ioutil.ReadFile(tokenPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.scope = ""
+	c, _ = clientWith("wrong")
+	if _, err := c.authorize(false); !isDecryptError(err, sealed.ErrOpen) {
+		t.Errorf("expected a decryption error, got %v", err)
+	}
+	if len(s.scope) > 0 {
+		t.Error("unexpected OAuth dance")
+	}
+	if kept, err := ioutil.ReadFile(tokenPath); err != nil || string(kept) != string(data) {
+		t.Errorf("the encrypted token file was replaced: %v", err)
+	}
+}
@@ -0,0 +1,187 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"os"
+
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/httpcache"
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+// The package functions below call the methods of defaultClient, after
+// copying the package variables to its Options.
+
+// TokenPath specifies the path to the file where OAuth access and refresh
+// tokens will be read and written. See OAuthPlus for more information.
+var TokenPath string
+
+// EncryptTokens makes OAuthPlus encrypt the tokens it writes to TokenPath
+// with a passphrase. Encrypted token files are always read, and stay encrypted
+// when tokens are refreshed, whether or not EncryptTokens is set.
+var EncryptTokens bool
+
+// OAuthFlow selects the OAuth flow used by OAuthPlus. It will default to
+// LoopbackFlow if empty.
+var OAuthFlow string
+
+// ServiceAccountKeyPath specifies the path to the JSON key file of the service
+// account used by ServiceAccountPlus, as downloaded from the API console.
+var ServiceAccountKeyPath string
+
+// Fields is the partial-response selector sent with every Google+ API request
+// of the package functions. See Options.Fields.
+var Fields string
+
+// Access selects the credentials which the config must hold, e.g.
+// APIKeyAccess. See Options.Access.
+var Access string
+
+// ConfigOverrides maps setting names (see SettingNames) to values which take
+// precedence over the config file and the environment variables, e.g. values
+// of command-line flags. Empty values are ignored. Config applies them.
+var ConfigOverrides = make(map[string]string)
+
+// defaultClient is the Client used by the package functions.
+var defaultClient = newClient()
+
+// std returns defaultClient with the current values of the package variables.
+func std() *Client {
+	c := defaultClient
+	c.ConfigOverrides = ConfigOverrides
+	c.OAuthFlow = OAuthFlow
+	c.ServiceAccountKeyPath = ServiceAccountKeyPath
+	c.Fields = Fields
+	c.Access = Access
+	store, _ := c.TokenStore.(*FileTokenStore)
+	switch {
+	case len(TokenPath) == 0:
+		c.TokenStore = nil
+	case store == nil || store.Path != TokenPath:
+		c.TokenStore = &FileTokenStore{Path: TokenPath, Encrypt: EncryptTokens}
+	default:
+		// Keep the store while TokenPath doesn't change, so that the
+		// passphrase is only prompted for once per run.
+		store.Encrypt = EncryptTokens
+	}
+	return c
+}
+
+// Config must be called with the path to the API config file before NoAuthPlus
+// and OAuthPlus are called. It configures the default Client like NewClient
+// does, keeping the recording or replaying and the scopes declared so far.
+func Config(path string) os.Error {
+	return std().load(path)
+}
+
+// NoAuthPlus calls Client.NoAuthPlus on the default Client.
+//
+// You must call Config before calling this function.
+func NoAuthPlus() (*plus.Service, os.Error) {
+	return std().NoAuthPlus()
+}
+
+// OAuthPlus calls Client.OAuthPlus on the default Client, which reads and
+// writes the tokens in TokenPath if it is set.
+//
+// You must call Config before calling this function.
+func OAuthPlus() (*plus.Service, os.Error) {
+	return std().OAuthPlus()
+}
+
+// ServiceAccountPlus calls Client.ServiceAccountPlus on the default Client,
+// with the key file at ServiceAccountKeyPath.
+//
+// You must call Config before calling this function.
+func ServiceAccountPlus() (*plus.Service, os.Error) {
+	return std().ServiceAccountPlus()
+}
+
+// RequireScopes calls Client.RequireScopes on the default Client.
+func RequireScopes(scopes ...string) {
+	std().RequireScopes(scopes...)
+}
+
+// AuthStatus calls Client.AuthStatus on the default Client, for the tokens
+// stored in TokenPath.
+//
+// You must call Config before calling this function.
+func AuthStatus() (*TokenStatus, os.Error) {
+	if len(TokenPath) == 0 {
+		return nil, os.NewError("TokenPath is not set")
+	}
+	return std().AuthStatus()
+}
+
+// Login calls Client.Login on the default Client, which saves the new tokens
+// to TokenPath.
+//
+// You must call Config before calling this function.
+func Login() os.Error {
+	if len(TokenPath) == 0 {
+		return os.NewError("TokenPath is not set")
+	}
+	return std().Login()
+}
+
+// Logout calls Client.Logout on the default Client, which deletes TokenPath.
+//
+// You must call Config before calling this function.
+func Logout() os.Error {
+	if len(TokenPath) == 0 {
+		return os.NewError("TokenPath is not set")
+	}
+	return std().Logout()
+}
+
+// EffectiveConfig calls Client.EffectiveConfig on the default Client.
+//
+// You must call Config before calling this function.
+func EffectiveConfig() []ConfigValue {
+	return std().EffectiveConfig()
+}
+
+// ConfigProblems calls Client.ConfigProblems on the default Client.
+//
+// You must call Config before calling this function.
+func ConfigProblems() []string {
+	return std().ConfigProblems()
+}
+
+// CacheStats calls Client.CacheStats on the default Client.
+func CacheStats() httpcache.Stats {
+	return std().CacheStats()
+}
+
+// KeyStats calls Client.KeyStats on the default Client.
+func KeyStats() []noauth.KeyStats {
+	return std().KeyStats()
+}
+
+// Record calls Client.Record on the default Client.
+func Record() {
+	std().Record()
+}
+
+// SaveRecording calls Client.SaveRecording on the default Client.
+func SaveRecording(path string) os.Error {
+	return std().SaveRecording(path)
+}
+
+// Replay calls Client.Replay on the default Client.
+func Replay(path string) os.Error {
+	return std().Replay(path)
+}
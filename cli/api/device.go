@@ -0,0 +1,155 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"http"
+	"io"
+	"json"
+	"os"
+	"time"
+	"url"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+// deviceGrantType is the grant type of device code token requests.
+const deviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// deviceCode is the response of the device authorization endpoint. Google
+// calls the verification URL "verification_url" while RFC 8628 calls it
+// "verification_uri", so both are accepted.
+type deviceCode struct {
+	DeviceCode      string `json:"device_code"`
+	UserCode        string `json:"user_code"`
+	VerificationURL string `json:"verification_url"`
+	VerificationURI string `json:"verification_uri"`
+	ExpiresIn       int64  `json:"expires_in"`
+	Interval        int64  `json:"interval"`
+}
+
+// tokenResponse is the response of the token endpoint.
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	RefreshToken string `json:"refresh_token"`
+	ExpiresIn    int64  `json:"expires_in"`
+	Error        string `json:"error"`
+}
+
+// deviceDance creates a new *oauth.Token for transport with the device
+// authorization grant (DeviceFlow): it prints a verification URL and a code
+// which the user enters in a browser on any device, and polls the token
+// endpoint until the user has authorized access, calling sleep between
+// attempts. transport's Token field will be set to the new *oauth.Token.
+func deviceDance(transport *oauth.Transport, deviceCodeURL string, w io.Writer, sleep func(ns int64)) os.Error {
+	client := &http.Client{Transport: transport.Transport}
+	c := transport.Config
+
+	// Request a device code.
+	dc := &deviceCode{}
+	resp, err := client.PostForm(deviceCodeURL, url.Values{
+		"client_id": {c.ClientId},
+		"scope":     {c.Scope},
+	})
+	if err := decodeResponse(resp, err, dc); err != nil {
+		return err
+	}
+	verificationURL := dc.VerificationURL
+	if len(verificationURL) == 0 {
+		verificationURL = dc.VerificationURI
+	}
+	if len(dc.DeviceCode) == 0 || len(dc.UserCode) == 0 || len(verificationURL) == 0 {
+		return os.NewError("invalid response from the device authorization endpoint")
+	}
+	interval := dc.Interval
+	if interval <= 0 {
+		interval = 5
+	}
+
+	if _, err := fmt.Fprintln(w, "On any device, open your browser and go to the following URL:"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, verificationURL, "\n"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(w, "Enter the code %s and allow access. Waiting for authorization...\n", dc.UserCode); err != nil {
+		return err
+	}
+
+	// Poll the token endpoint until the user allows or denies access, or the
+	// device code expires.
+	var waited int64
+	for {
+		if dc.ExpiresIn > 0 && waited >= dc.ExpiresIn {
+			return os.NewError("the device code expired before access was authorized")
+		}
+		sleep(interval * 1e9)
+		waited += interval
+
+		tr := &tokenResponse{}
+		resp, err := client.PostForm(c.TokenURL, url.Values{
+			"client_id":     {c.ClientId},
+			"client_secret": {c.ClientSecret},
+			"device_code":   {dc.DeviceCode},
+			"grant_type":    {deviceGrantType},
+		})
+		if err != nil {
+			return err
+		}
+		err = json.NewDecoder(resp.Body).Decode(tr)
+		resp.Body.Close()
+		if err != nil {
+			return fmt.Errorf("invalid response from the token endpoint: %s", resp.Status)
+		}
+
+		switch tr.Error {
+		case "":
+			if len(tr.AccessToken) == 0 {
+				return os.NewError("no access token in the token endpoint response")
+			}
+			token := &oauth.Token{AccessToken: tr.AccessToken, RefreshToken: tr.RefreshToken}
+			if tr.ExpiresIn > 0 {
+				token.TokenExpiry = time.Seconds() + tr.ExpiresIn
+			}
+			transport.Token = token
+			return nil
+		case "authorization_pending":
+		case "slow_down":
+			// RFC 8628 asks to increase the interval by 5 seconds.
+			interval += 5
+		case "access_denied":
+			return os.NewError("access was denied")
+		case "expired_token":
+			return os.NewError("the device code expired before access was authorized")
+		default:
+			return fmt.Errorf("OAuth authorization failed: %s", tr.Error)
+		}
+	}
+	panic("unreachable")
+}
+
+// decodeResponse decodes the JSON body of a successful response into v, and
+// closes the body. resp and err are the results of an HTTP request.
+func decodeResponse(resp *http.Response, err os.Error, v interface{}) os.Error {
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected response: %s", resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
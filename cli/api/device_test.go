@@ -0,0 +1,116 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+type DeviceTest struct {
+	// The response of the device authorization endpoint.
+	device string
+	// The "error" values returned by successive token requests; "" issues a
+	// token. The last one is repeated.
+	script []string
+	// The expected sleeps between token requests.
+	sleeps []int64
+	ok     bool
+}
+
+var DeviceTests = []DeviceTest{
+	// The user authorizes access after a while; slow_down adds 5 seconds to
+	// the interval.
+	DeviceTest{
+		device: `{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_url": "https://www.google.com/device", "expires_in": 1800, "interval": 1}`,
+		script: []string{"authorization_pending", "slow_down", "authorization_pending", ""},
+		sleeps: []int64{1e9, 1e9, 6e9, 6e9},
+		ok:     true,
+	},
+	// RFC 8628 field name, and the default interval.
+	DeviceTest{
+		device: `{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_uri": "https://example.com/device", "expires_in": 1800}`,
+		script: []string{""},
+		sleeps: []int64{5e9},
+		ok:     true,
+	},
+	// The user denies access.
+	DeviceTest{
+		device: `{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_url": "https://www.google.com/device", "expires_in": 1800, "interval": 1}`,
+		script: []string{"authorization_pending", "access_denied"},
+		sleeps: []int64{1e9, 1e9},
+		ok:     false,
+	},
+	// The device code expires.
+	DeviceTest{
+		device: `{"device_code": "dev", "user_code": "ABCD-EFGH", "verification_url": "https://www.google.com/device", "expires_in": 3, "interval": 1}`,
+		script: []string{"authorization_pending"},
+		sleeps: []int64{1e9, 1e9, 1e9},
+		ok:     false,
+	},
+	// Invalid device authorization response.
+	DeviceTest{
+		device: `{"device_code": "dev"}`,
+		ok:     false,
+	},
+}
+
+func TestDeviceDance(t *testing.T) {
+	var sleeps []int64
+	sleep := func(ns int64) { sleeps = append(sleeps, ns) }
+
+	for i, d := range DeviceTests {
+		sleeps = nil
+		server := newFakeOAuthServer()
+		server.deviceResponse = d.device
+		server.deviceScript = d.script
+		transport := &oauth.Transport{Config: server.oauthConfig()}
+		out := &bytes.Buffer{}
+		err := deviceDance(transport, server.URL+"/device", out, sleep)
+		server.Close()
+
+		if d.ok {
+			if err != nil {
+				t.Errorf("%d: %v", i, err)
+				continue
+			}
+			if transport.Token == nil || transport.Token.AccessToken != "access1" || transport.Token.RefreshToken != "refresh1" {
+				t.Errorf("%d: unexpected token %v", i, transport.Token)
+			}
+			if server.scope != "plus.me" {
+				t.Errorf("%d: unexpected scope %q", i, server.scope)
+			}
+			if !strings.Contains(out.String(), "ABCD-EFGH") {
+				t.Errorf("%d: the user code wasn't printed: %q", i, out.String())
+			}
+		} else if err == nil {
+			t.Errorf("%d: expected an error", i)
+		}
+
+		if len(sleeps) != len(d.sleeps) {
+			t.Errorf("%d: expected sleeps %v but got %v", i, d.sleeps, sleeps)
+			continue
+		}
+		for j := range sleeps {
+			if sleeps[j] != d.sleeps[j] {
+				t.Errorf("%d: expected sleeps %v but got %v", i, d.sleeps, sleeps)
+				break
+			}
+		}
+	}
+}
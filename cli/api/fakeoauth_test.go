@@ -0,0 +1,320 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"http"
+	"http/httptest"
+	"io"
+	"json"
+	"os"
+	"strings"
+	"sync"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+// fakeOAuthServer is a fake OAuth server for the flows of the package, like
+// plustest is for the Google+ API. Its endpoints are:
+//
+// 	/auth       authorization, which requires PKCE and issues the code "abc"
+// 	/device     device authorization, for the device code "dev"
+// 	/token      token, for authorization codes, device codes, refresh tokens
+// 	            and the JWT assertions of a service account
+// 	/tokeninfo  token information
+// 	/revoke     revocation
+//
+// Access tokens are named "access1", "access2", etc., and refresh tokens
+// "refresh1", etc. New grants cover exactly the scope requested last, since
+// the device flow doesn't support include_granted_scopes. The configuration
+// fields must be set before the server is used.
+type fakeOAuthServer struct {
+	*httptest.Server
+
+	// deviceResponse replaces the response of /device if it is set.
+	deviceResponse string
+	// deviceScript lists the "error" values of successive device code token
+	// requests; "" issues tokens, and the last value is repeated. If it is
+	// empty, the user authorizes device codes right away.
+	deviceScript []string
+	// serviceAccountKey is the public key of the service account whose JWT
+	// assertions are accepted.
+	serviceAccountKey *rsa.PublicKey
+
+	mu sync.Mutex
+	// access maps valid access tokens to the refresh token they came from.
+	access map[string]string
+	// refresh maps valid refresh tokens to their scopes.
+	refresh map[string]string
+	// challenge and redirectURI are those of the last authorization request.
+	challenge   string
+	redirectURI string
+	// scope is the scope of the last authorization or device authorization
+	// request, or JWT assertion.
+	scope  string
+	issued int
+}
+
+func newFakeOAuthServer() *fakeOAuthServer {
+	s := &fakeOAuthServer{
+		access:  make(map[string]string),
+		refresh: make(map[string]string),
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/auth", s.auth)
+	mux.HandleFunc("/device", s.device)
+	mux.HandleFunc("/token", s.token)
+	mux.HandleFunc("/tokeninfo", s.tokenInfo)
+	mux.HandleFunc("/revoke", s.revoke)
+	s.Server = httptest.NewServer(mux)
+	return s
+}
+
+// configJSON returns an API config file using the server.
+func (s *fakeOAuthServer) configJSON() string {
+	return strings.Replace(`{
+		"APIKey": "key",
+		"OAuthConfig": {"ClientId": "client", "ClientSecret": "secret", "Scope": "https://www.googleapis.com/auth/plus.me",
+			"AuthURL": "SERVER/auth", "TokenURL": "SERVER/token"},
+		"DeviceCodeURL": "SERVER/device",
+		"TokenInfoURL": "SERVER/tokeninfo",
+		"RevokeURL": "SERVER/revoke"
+	}`, "SERVER", s.URL, -1)
+}
+
+// oauthConfig returns an OAuth config using the server, for the scope
+// "plus.me" and the out-of-band redirect URL.
+func (s *fakeOAuthServer) oauthConfig() *oauth.Config {
+	return &oauth.Config{
+		ClientId:     "client",
+		ClientSecret: "secret",
+		Scope:        "plus.me",
+		AuthURL:      s.URL + "/auth",
+		TokenURL:     s.URL + "/token",
+		RedirectURL:  "urn:ietf:wg:oauth:2.0:oob",
+	}
+}
+
+// auth redirects to the loopback redirect URL with the code, or shows the
+// code for the out-of-band redirect URL.
+func (s *fakeOAuthServer) auth(w http.ResponseWriter, r *http.Request) {
+	if r.FormValue("code_challenge_method") != "S256" || len(r.FormValue("code_challenge")) == 0 {
+		http.Error(w, "PKCE required", http.StatusBadRequest)
+		return
+	}
+	redirectURI := r.FormValue("redirect_uri")
+	s.mu.Lock()
+	s.challenge = r.FormValue("code_challenge")
+	s.redirectURI = redirectURI
+	s.scope = r.FormValue("scope")
+	s.mu.Unlock()
+
+	if strings.HasPrefix(redirectURI, "http") {
+		http.Redirect(w, r, redirectURI+"?code=abc&state="+r.FormValue("state"), http.StatusFound)
+		return
+	}
+	io.WriteString(w, "abc")
+}
+
+func (s *fakeOAuthServer) device(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	s.scope = r.FormValue("scope")
+	s.mu.Unlock()
+	if len(s.deviceResponse) > 0 {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, s.deviceResponse)
+		return
+	}
+	writeOAuthJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code": "dev", "user_code": "ABCD-EFGH",
+		"verification_url": s.URL + "/verify", "expires_in": 1800, "interval": 1,
+	})
+}
+
+func (s *fakeOAuthServer) token(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	newGrant := false
+	switch r.FormValue("grant_type") {
+	case "authorization_code":
+		p := &pkce{verifier: r.FormValue("code_verifier")}
+		if r.FormValue("code") != "abc" || len(p.verifier) == 0 || p.challenge() != s.challenge ||
+			r.FormValue("redirect_uri") != s.redirectURI {
+			writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		newGrant = true
+	case deviceGrantType:
+		if r.FormValue("device_code") != "dev" {
+			writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+		if len(s.deviceScript) > 0 {
+			e := s.deviceScript[0]
+			if len(s.deviceScript) > 1 {
+				s.deviceScript = s.deviceScript[1:]
+			}
+			if len(e) > 0 {
+				writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": e})
+				return
+			}
+		}
+		newGrant = true
+	case "refresh_token":
+		if len(s.refresh[r.FormValue("refresh_token")]) == 0 {
+			writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+			return
+		}
+	case jwtBearerGrantType:
+		claims, err := s.verify(r.FormValue("assertion"))
+		if err != nil {
+			writeOAuthJSON(w, http.StatusBadRequest, map[string]string{
+				"error": "invalid_grant", "error_description": err.String()})
+			return
+		}
+		s.scope = claims.Scope
+	default:
+		writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": "unsupported_grant_type"})
+		return
+	}
+
+	s.issued++
+	access := fmt.Sprint("access", s.issued)
+	body := map[string]interface{}{"access_token": access, "expires_in": 3600, "token_type": "Bearer"}
+	refresh := r.FormValue("refresh_token")
+	if newGrant {
+		refresh = fmt.Sprint("refresh", s.issued)
+		s.refresh[refresh] = s.scope
+		body["refresh_token"] = refresh
+	}
+	s.access[access] = refresh
+	writeOAuthJSON(w, http.StatusOK, body)
+}
+
+func (s *fakeOAuthServer) tokenInfo(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	refresh, ok := s.access[r.FormValue("access_token")]
+	if !ok {
+		writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_token"})
+		return
+	}
+	writeOAuthJSON(w, http.StatusOK, map[string]interface{}{
+		"issued_to": "client", "audience": "client", "user_id": "1",
+		"scope": s.refresh[refresh], "expires_in": 3599,
+		"email": "larry@example.com", "verified_email": true,
+	})
+}
+
+func (s *fakeOAuthServer) revoke(w http.ResponseWriter, r *http.Request) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	token := r.FormValue("token")
+	if _, ok := s.access[token]; ok {
+		s.access[token] = "", false
+	} else if _, ok := s.refresh[token]; ok {
+		s.refresh[token] = "", false
+		for access, refresh := range s.access {
+			if refresh == token {
+				s.access[access] = "", false
+			}
+		}
+	} else {
+		writeOAuthJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_token"})
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+func writeOAuthJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+type jwtClaims struct {
+	Iss   string `json:"iss"`
+	Scope string `json:"scope"`
+	Aud   string `json:"aud"`
+	Iat   int64  `json:"iat"`
+	Exp   int64  `json:"exp"`
+}
+
+// verify checks the RS256 signature of a JWT assertion with the key of the
+// service account, and its claims.
+func (s *fakeOAuthServer) verify(assertion string) (*jwtClaims, os.Error) {
+	if s.serviceAccountKey == nil {
+		return nil, os.NewError("no service account")
+	}
+	parts := strings.Split(assertion, ".")
+	if len(parts) != 3 {
+		return nil, os.NewError("malformed assertion")
+	}
+	header := make(map[string]string)
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, err
+	}
+	if header["alg"] != "RS256" {
+		return nil, fmt.Errorf("unexpected alg %q", header["alg"])
+	}
+	sig, err := decodeBase64URL(parts[2])
+	if err != nil {
+		return nil, err
+	}
+	h := sha256.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(s.serviceAccountKey, crypto.SHA256, h.Sum(), sig); err != nil {
+		return nil, os.NewError("invalid signature")
+	}
+
+	claims := &jwtClaims{}
+	if err := decodeSegment(parts[1], claims); err != nil {
+		return nil, err
+	}
+	switch {
+	case claims.Iss != "robot@example.iam.gserviceaccount.com":
+		return nil, fmt.Errorf("unexpected iss %q", claims.Iss)
+	case claims.Aud != s.URL+"/token":
+		return nil, fmt.Errorf("unexpected aud %q", claims.Aud)
+	case claims.Iat != defaultClient.now() || claims.Exp-claims.Iat > 3600:
+		return nil, fmt.Errorf("unexpected iat %d, exp %d", claims.Iat, claims.Exp)
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) os.Error {
+	data, err := decodeBase64URL(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+func decodeBase64URL(s string) ([]byte, os.Error) {
+	if n := len(s) % 4; n > 0 {
+		s += strings.Repeat("=", 4-n)
+	}
+	b := make([]byte, base64.URLEncoding.DecodedLen(len(s)))
+	n, err := base64.URLEncoding.Decode(b, []byte(s))
+	return b[:n], err
+}
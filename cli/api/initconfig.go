@@ -0,0 +1,200 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"json"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"google-plus-go-starter.googlecode.com/hg/clientsecrets"
+	"google-plus-go-starter.googlecode.com/hg/core"
+)
+
+// InitConfig creates a config file at path with values read from r, after
+// printing prompts to w: the API key, and either the path to a client secrets
+// file downloaded from the API console or the client ID and secret, none of
+// which may be empty. The values are validated like Config does, and the API
+// key is checked with a request through NoAuthPlus, before the file is
+// written, readable by the current user only. The environment variables and
+// ConfigOverrides don't take the place of these values while they are
+// checked, except for BaseURL. An existing file isn't replaced.
+//
+// Like Config, InitConfig leaves the package configured with the new file.
+func InitConfig(path string, r io.Reader, w io.Writer) os.Error {
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+
+	// Start from the defaults of the settings, like those of the sample
+	// config.json.
+	c := &core.Config{}
+	for _, s := range settings {
+		*s.field(c) = s.Default
+	}
+	c.RateLimit.RequestsPerSecond = 5
+	c.RateLimit.Burst = 10
+	c.Cache.MaxEntries = 100
+
+	fmt.Fprintf(w, "Creating %s. Copy the values from the API Access section of\nhttps://code.google.com/apis/console/\n\n", path)
+	apiKey, err := promptRequired(r, w, "API key")
+	if err != nil {
+		return err
+	}
+	c.APIKey = apiKey
+
+	secretsPath, err := prompt(r, w, "Client secrets file to import (client_secret.json), or empty to enter the client ID and secret: ")
+	if err != nil {
+		return err
+	}
+	if len(secretsPath) > 0 {
+		if err := importClientSecrets(c, secretsPath); err != nil {
+			return err
+		}
+	} else {
+		if c.OAuthConfig.ClientId, err = promptRequired(r, w, "client ID"); err != nil {
+			return err
+		}
+		if c.OAuthConfig.ClientSecret, err = promptRequired(r, w, "client secret"); err != nil {
+			return err
+		}
+	}
+
+	data, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	// Check the new config from a temporary file, so that a bad config never
+	// ends up at path. ioutil.TempFile creates the file with 0600
+	// permissions. It must be in the same directory for the rename to be
+	// atomic.
+	dir, name := filepath.Split(path)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, name+".init")
+	if err != nil {
+		return err
+	}
+	tmpPath := file.Name()
+	defer os.Remove(tmpPath)
+	_, err = file.Write(append(data, '\n'))
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	client, err := NewClient(tmpPath, &Options{ConfigOverrides: overrides(c)})
+	if err != nil {
+		return err
+	}
+	fmt.Fprint(w, "Checking the API key... ")
+	if err := checkAPIKey(client); err != nil {
+		fmt.Fprintln(w, "failed.")
+		return fmt.Errorf("the API key doesn't work: %s", err.String())
+	}
+	fmt.Fprintln(w, "OK.")
+
+	if err := os.Rename(tmpPath, path); err != nil {
+		return err
+	}
+	return Config(path)
+}
+
+// prompt prints message to w and reads a line from r, without surrounding
+// spaces.
+func prompt(r io.Reader, w io.Writer, message string) (string, os.Error) {
+	if _, err := fmt.Fprint(w, message); err != nil {
+		return "", err
+	}
+	line, err := readLine(r)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(line)), nil
+}
+
+// promptRequired prompts for the value called name like prompt does, and
+// returns an error if it is empty.
+func promptRequired(r io.Reader, w io.Writer, name string) (string, os.Error) {
+	value, err := prompt(r, w, strings.ToUpper(name[:1])+name[1:]+": ")
+	if err != nil {
+		return "", err
+	}
+	if len(value) == 0 {
+		return "", fmt.Errorf("the %s is required", name)
+	}
+	return value, nil
+}
+
+// overrides returns the settings of c as ConfigOverrides, so that they are
+// checked rather than the values of the environment variables or of
+// ConfigOverrides. Only the BaseURL of ConfigOverrides, which InitConfig
+// doesn't prompt for, is kept.
+func overrides(c *core.Config) map[string]string {
+	o := make(map[string]string)
+	for _, s := range settings {
+		o[s.Name] = *s.field(c)
+	}
+	o["BaseURL"] = ConfigOverrides["BaseURL"]
+	return o
+}
+
+// importClientSecrets sets the OAuth client of c from the client secrets file
+// at path.
+func importClientSecrets(c *core.Config, path string) os.Error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	secrets := &clientsecrets.File{}
+	if err := json.Unmarshal(data, secrets); err != nil {
+		return fmt.Errorf("couldn't parse %s: %s", path, err.String())
+	}
+	client, err := secrets.Client()
+	if err != nil {
+		return err
+	}
+	if client == nil {
+		return fmt.Errorf(`%s isn't a client secrets file: it has no "installed" or "web" client`, path)
+	}
+	c.OAuthConfig.ClientId = client.ClientId
+	c.OAuthConfig.ClientSecret = client.ClientSecret
+	if len(client.AuthURI) > 0 {
+		c.OAuthConfig.AuthURL = client.AuthURI
+	}
+	if len(client.TokenURI) > 0 {
+		c.OAuthConfig.TokenURL = client.TokenURI
+	}
+	if uri := client.LocalRedirectURI(); len(uri) > 0 {
+		c.OAuthConfig.RedirectURL = uri
+	}
+	return nil
+}
+
+// checkAPIKey makes a request through the NoAuthPlus of c.
+func checkAPIKey(c *Client) os.Error {
+	p, err := c.NoAuthPlus()
+	if err != nil {
+		return err
+	}
+	_, err = p.People.Search("Google").Do()
+	return err
+}
@@ -0,0 +1,122 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"google-plus-go-starter.googlecode.com/hg/core"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+	"google-plus-go-starter.googlecode.com/hg/plustest"
+)
+
+type InitConfigTest struct {
+	name string
+	// input is what the user types.
+	input string
+	// clientId is the expected client ID, or "" if InitConfig must fail.
+	clientId string
+}
+
+var InitConfigTests = []InitConfigTest{
+	InitConfigTest{"typed values", "key\n\n123.apps.googleusercontent.com\nsecret\n", "123.apps.googleusercontent.com"},
+	InitConfigTest{"client secrets file", "key\nSECRETS\n", "456.apps.googleusercontent.com"},
+	InitConfigTest{"wrong API key", "bad-key\n\n123.apps.googleusercontent.com\nsecret\n", ""},
+	InitConfigTest{"placeholder", "YOUR_API_KEY\n\n123.apps.googleusercontent.com\nsecret\n", ""},
+	InitConfigTest{"empty client ID", "key\n\n\nsecret\n", ""},
+	InitConfigTest{"empty client secret", "key\n\n123.apps.googleusercontent.com\n\n", ""},
+	InitConfigTest{"missing client secrets file", "key\nmissing.json\n", ""},
+	InitConfigTest{"early EOF", "key\n", ""},
+}
+
+func TestInitConfig(t *testing.T) {
+	s := plustest.NewServer()
+	defer s.Close()
+	s.AddKey("key")
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func() { ConfigOverrides = make(map[string]string) }()
+	ConfigOverrides["BaseURL"] = s.BaseURL()
+	// The typed API key is checked, not the one of the flags.
+	ConfigOverrides["APIKey"] = "key"
+
+	secretsPath := filepath.Join(dir, "client_secret.json")
+	secretsJSON := `{"installed": {"client_id": "456.apps.googleusercontent.com", "client_secret": "s",
+		"redirect_uris": ["urn:ietf:wg:oauth:2.0:oob", "http://localhost"]}}`
+	if err := ioutil.WriteFile(secretsPath, []byte(secretsJSON), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	for i, test := range InitConfigTests {
+		path := filepath.Join(dir, strings.Replace(test.name, " ", "_", -1)+".json")
+		input := strings.Replace(test.input, "SECRETS", secretsPath, 1)
+		out := &bytes.Buffer{}
+		err := InitConfig(path, strings.NewReader(input), out)
+		if len(test.clientId) == 0 {
+			if err == nil {
+				t.Errorf("%s: expected an error", test.name)
+			}
+			if _, err := os.Stat(path); err == nil {
+				t.Errorf("%s: the config file was written", test.name)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Permission() != 0600 {
+			t.Errorf("%s: the config file wasn't written with 0600 permissions: %v", test.name, err)
+		}
+		if defaultClient.config.APIKey != "key" || defaultClient.config.OAuthConfig.ClientId != test.clientId {
+			t.Errorf("%s: unexpected config %+v", test.name, defaultClient.config)
+		}
+		// The file holds the defaults as well as the values typed.
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if config, _, err := core.Parse(data); err != nil || config.RateLimit.Burst != 10 || config.RevokeURL != endpoint.GoogleRevokeURL {
+			t.Errorf("%s: unexpected config file %s: %v", test.name, data, err)
+		}
+		if calls := s.Calls("people.search"); calls != i+1 {
+			t.Errorf("%s: expected the API key to be checked", test.name)
+		}
+
+		// Existing files aren't replaced.
+		if err := InitConfig(path, strings.NewReader(input), out); err == nil {
+			t.Errorf("%s: expected an error for an existing file", test.name)
+		}
+	}
+
+	// The temporary files are removed.
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, fi := range files {
+		if strings.Contains(fi.Name, ".init") {
+			t.Errorf("the temporary file %s wasn't removed", fi.Name)
+		}
+	}
+}
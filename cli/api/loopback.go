@@ -0,0 +1,143 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"http"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+// defaultLoopbackTimeout is the default Options.LoopbackTimeout.
+const defaultLoopbackTimeout = 5 * 60e9
+
+// successPage is shown in the browser once the authorization code is received.
+const successPage = `<!DOCTYPE html>
+<html>
+<head><title>Google+ Go Starter</title></head>
+<body>
+<p>Authorization complete. You can close this window and return to the command line.</p>
+</body>
+</html>
+`
+
+// loopbackResult is the outcome of the redirect to the loopback listener.
+type loopbackResult struct {
+	code string
+	err  os.Error
+}
+
+// loopbackDance creates a new *oauth.Token for transport by sending the user
+// to the authorization page and receiving the authorization code on a
+// temporary HTTP listener on 127.0.0.1, which is used as the redirect URL.
+// The exchange is protected with PKCE. transport's Config is replaced by a copy
+// with that redirect URL, and its Token field will be set to the new
+// *oauth.Token.
+func loopbackDance(transport *oauth.Transport, w io.Writer, timeout int64) os.Error {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return err
+	}
+	defer l.Close()
+
+	state, err := randomState()
+	if err != nil {
+		return err
+	}
+	p, err := newPKCE()
+	if err != nil {
+		return err
+	}
+	c := *transport.Config
+	c.RedirectURL = "http://" + l.Addr().String() + "/"
+	transport.Config = &c
+
+	results := make(chan loopbackResult, 1)
+	go http.Serve(l, loopbackHandler(state, results))
+
+	if _, err := fmt.Fprintln(w, "Open your browser and go to the following URL:"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, p.authCodeURL(transport.Config, state), "\n"); err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintln(w, "Waiting for authorization..."); err != nil {
+		return err
+	}
+
+	var result loopbackResult
+	select {
+	case result = <-results:
+	case <-time.After(timeout):
+		return os.NewError("timed out waiting for OAuth authorization")
+	}
+	if result.err != nil {
+		return result.err
+	}
+	// Exchange the authorization code for access and refresh tokens.
+	return p.exchange(transport, result.code)
+}
+
+// loopbackHandler returns the handler of the loopback listener. It sends the
+// authorization code, or the error returned by the authorization server, on
+// results. Requests without a matching state are rejected and ignored, so
+// that other pages can't inject an authorization code.
+func loopbackHandler(state string, results chan<- loopbackResult) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		if r.FormValue("state") != state {
+			http.Error(w, "Invalid state parameter.", http.StatusBadRequest)
+			return
+		}
+
+		var result loopbackResult
+		if e := r.FormValue("error"); len(e) > 0 {
+			result.err = fmt.Errorf("OAuth authorization failed: %s", e)
+			http.Error(w, "Authorization failed: "+e, http.StatusForbidden)
+		} else if code := r.FormValue("code"); len(code) > 0 {
+			result.code = code
+			w.Header().Set("Content-Type", "text/html; charset=utf-8")
+			io.WriteString(w, successPage)
+		} else {
+			http.Error(w, "Missing authorization code.", http.StatusBadRequest)
+			return
+		}
+
+		// Only the first result counts, e.g. if the page is reloaded.
+		select {
+		case results <- result:
+		default:
+		}
+	})
+}
+
+// randomState returns an unguessable value for the OAuth state parameter.
+func randomState() (string, os.Error) {
+	b := make([]byte, 16)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
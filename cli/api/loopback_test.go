@@ -0,0 +1,122 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"http"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"url"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+// browse plays the user's browser: it reads the authorization URL printed by
+// loopbackDance from r and requests the redirect URL with the given query,
+// where "STATE" is replaced by the state parameter. It sends the status code
+// of the response on status.
+func browse(r io.Reader, query string, status chan<- int) {
+	defer io.Copy(ioutil.Discard, r)
+	u, err := readAuthURL(bufio.NewReader(r))
+	if err != nil {
+		status <- 0
+		return
+	}
+	// Let the server remember the PKCE challenge, without following its
+	// redirect: query is sent instead.
+	req, err := http.NewRequest("GET", u.String(), nil)
+	if err != nil {
+		status <- 0
+		return
+	}
+	if resp, err := http.DefaultTransport.RoundTrip(req); err == nil {
+		resp.Body.Close()
+	}
+	q := u.Query()
+	query = strings.Replace(query, "STATE", q.Get("state"), -1)
+	resp, err := http.Get(q.Get("redirect_uri") + "?" + query)
+	if err != nil {
+		status <- 0
+		return
+	}
+	resp.Body.Close()
+	status <- resp.StatusCode
+}
+
+// readAuthURL returns the first URL printed on br.
+func readAuthURL(br *bufio.Reader) (*url.URL, os.Error) {
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasPrefix(line, "http") {
+			return url.Parse(strings.TrimSpace(line))
+		}
+	}
+	panic("unreachable")
+}
+
+type LoopbackTest struct {
+	query  string
+	status int
+	ok     bool
+}
+
+var LoopbackTests = []LoopbackTest{
+	// The authorization code is exchanged for tokens.
+	LoopbackTest{query: "code=abc&state=STATE", status: 200, ok: true},
+	// The user denied access.
+	LoopbackTest{query: "error=access_denied&state=STATE", status: 403, ok: false},
+	// A request with the wrong state is ignored, and the flow times out.
+	LoopbackTest{query: "code=abc&state=wrong", status: 400, ok: false},
+	LoopbackTest{query: "code=abc", status: 400, ok: false},
+}
+
+func TestLoopbackDance(t *testing.T) {
+	server := newFakeOAuthServer()
+	defer server.Close()
+
+	for _, l := range LoopbackTests {
+		config := server.oauthConfig()
+		transport := &oauth.Transport{Config: config}
+
+		r, w := io.Pipe()
+		status := make(chan int, 1)
+		go browse(r, l.query, status)
+		err := loopbackDance(transport, w, 2e8)
+		w.Close()
+
+		if s := <-status; s != l.status {
+			t.Errorf("%s: expected status %d but got %d", l.query, l.status, s)
+		}
+		if l.ok {
+			if err != nil {
+				t.Errorf("%s: %v", l.query, err)
+			} else if transport.Token == nil || !strings.HasPrefix(transport.Token.AccessToken, "access") {
+				t.Errorf("%s: expected an access token but got %v", l.query, transport.Token)
+			}
+		} else if err == nil {
+			t.Errorf("%s: expected an error", l.query)
+		}
+		if config.RedirectURL != "urn:ietf:wg:oauth:2.0:oob" {
+			t.Errorf("%s: the shared config was modified: %q", l.query, config.RedirectURL)
+		}
+	}
+}
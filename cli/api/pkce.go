@@ -0,0 +1,125 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"http"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"url"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+// pkce holds the Proof Key for Code Exchange (RFC 7636) of one OAuth dance.
+// The authorization request carries the S256 challenge derived from a random
+// verifier, and the token request carries the verifier, so that an
+// authorization code intercepted on its way to the CLI is useless without it.
+// The client secret of an installed application ships with the application,
+// so it can't provide this protection.
+type pkce struct {
+	verifier string
+}
+
+// newPKCE returns a pkce with a new random verifier.
+func newPKCE() (*pkce, os.Error) {
+	b := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, b); err != nil {
+		return nil, err
+	}
+	return &pkce{verifier: base64URL(b)}, nil
+}
+
+// challenge returns the S256 code challenge of the verifier.
+func (p *pkce) challenge() string {
+	h := sha256.New()
+	io.WriteString(h, p.verifier)
+	return base64URL(h.Sum())
+}
+
+// authCodeURL returns the URL of the authorization page for config, with the
+// code challenge. The new tokens will also cover the scopes granted to the
+// client before (include_granted_scopes), so that asking for one more scope
+// doesn't lose the others.
+func (p *pkce) authCodeURL(config *oauth.Config, state string) string {
+	return config.AuthCodeURL(state) + "&code_challenge=" + p.challenge() + "&code_challenge_method=S256" +
+		"&include_granted_scopes=true"
+}
+
+// exchange exchanges the authorization code for access and refresh tokens,
+// sending the code verifier along. transport's Token field will be set to the
+// new *oauth.Token.
+func (p *pkce) exchange(transport *oauth.Transport, code string) os.Error {
+	base := transport.Transport
+	transport.Transport = &pkceTransport{
+		verifier:  p.verifier,
+		tokenURL:  transport.Config.TokenURL,
+		transport: base,
+	}
+	defer func() { transport.Transport = base }()
+
+	_, err := transport.Exchange(code)
+	return err
+}
+
+// pkceTransport adds the code verifier to authorization code token requests,
+// which the oauth package doesn't know about.
+type pkceTransport struct {
+	verifier  string
+	tokenURL  string
+	transport http.RoundTripper
+}
+
+func (t *pkceTransport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	transport := t.transport
+	if transport == nil {
+		transport = http.DefaultTransport
+	}
+	if req.Method != "POST" || req.URL.String() != t.tokenURL || req.Body == nil {
+		return transport.RoundTrip(req)
+	}
+
+	body, err := ioutil.ReadAll(req.Body)
+	req.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	form, err := url.ParseQuery(string(body))
+	if err != nil {
+		return nil, err
+	}
+	if form.Get("grant_type") == "authorization_code" {
+		form.Set("code_verifier", t.verifier)
+		body = []byte(form.Encode())
+	}
+
+	newReq := *req
+	newReq.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	newReq.ContentLength = int64(len(body))
+	return transport.RoundTrip(&newReq)
+}
+
+// base64URL encodes b with the URL-safe base64 alphabet, without padding.
+func base64URL(b []byte) string {
+	buf := make([]byte, base64.URLEncoding.EncodedLen(len(b)))
+	base64.URLEncoding.Encode(buf, b)
+	return strings.TrimRight(string(buf), "=")
+}
@@ -0,0 +1,135 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"bufio"
+	"fmt"
+	"http"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+func TestPKCEChallenge(t *testing.T) {
+	// The example of RFC 7636, appendix B.
+	p := &pkce{verifier: "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"}
+	if c := p.challenge(); c != "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM" {
+		t.Errorf("unexpected challenge %q", c)
+	}
+
+	p, err := newPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// RFC 7636 requires 43 to 128 characters.
+	if len(p.verifier) != 43 {
+		t.Errorf("expected a 43 character verifier but got %q", p.verifier)
+	}
+}
+
+func TestOAuthDancePKCE(t *testing.T) {
+	s := newFakeOAuthServer()
+	defer s.Close()
+	transport := &oauth.Transport{Config: s.oauthConfig()}
+
+	// Play the user: open the printed URL and type the code shown.
+	out, w := io.Pipe()
+	in, typed := io.Pipe()
+	go func() {
+		defer typed.Close()
+		br := bufio.NewReader(out)
+		u, err := readAuthURL(br)
+		// Keep reading the output, which prompts for the code while it's typed.
+		go io.Copy(ioutil.Discard, br)
+		if err != nil {
+			return
+		}
+		resp, err := http.Get(u.String())
+		if err != nil {
+			return
+		}
+		defer resp.Body.Close()
+		code, _ := ioutil.ReadAll(resp.Body)
+		fmt.Fprintln(typed, string(code))
+	}()
+
+	err := oauthDance(transport, in, w)
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.Token == nil || transport.Token.AccessToken != "access1" {
+		t.Errorf("expected access token %q but got %v", "access1", transport.Token)
+	}
+}
+
+func TestLoopbackDancePKCE(t *testing.T) {
+	s := newFakeOAuthServer()
+	defer s.Close()
+	transport := &oauth.Transport{Config: s.oauthConfig()}
+
+	// Play the browser: open the printed URL and follow the redirect.
+	out, w := io.Pipe()
+	go func() {
+		defer io.Copy(ioutil.Discard, out)
+		u, err := readAuthURL(bufio.NewReader(out))
+		if err != nil {
+			return
+		}
+		if resp, err := http.Get(u.String()); err == nil {
+			resp.Body.Close()
+		}
+	}()
+
+	err := loopbackDance(transport, w, 5e9)
+	w.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if transport.Token == nil || transport.Token.AccessToken != "access1" {
+		t.Errorf("expected access token %q but got %v", "access1", transport.Token)
+	}
+}
+
+func TestPKCEWrongVerifier(t *testing.T) {
+	s := newFakeOAuthServer()
+	defer s.Close()
+	config := s.oauthConfig()
+
+	p, err := newPKCE()
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := http.Get(p.authCodeURL(config, ""))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	// A stolen code can't be exchanged without the verifier.
+	transport := &oauth.Transport{Config: config}
+	if err := (&pkce{verifier: "wrong"}).exchange(transport, "abc"); err == nil {
+		t.Error("expected an error for the wrong verifier")
+	}
+	if _, err := transport.Exchange("abc"); err == nil {
+		t.Error("expected an error without a verifier")
+	}
+	if err := p.exchange(transport, "abc"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,243 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Profile is a named pair of API config file and OAuth token file, e.g. for a
+// personal account, a test account or another API project. Profiles are
+// stored in ConfigDir:
+// 	profiles/NAME/config.json
+// 	profiles/NAME/token.json
+// 	default
+// where the default file holds the name of the default profile.
+type Profile struct {
+	Name       string
+	ConfigPath string
+	TokenPath  string
+}
+
+// validProfileName matches the names of profiles, which are used as
+// directory names.
+var validProfileName = regexp.MustCompile(`^[A-Za-z0-9_\-][A-Za-z0-9_.\-]*$`)
+
+// ConfigDir returns the directory of the CLI's profiles, following the XDG
+// Base Directory Specification: $XDG_CONFIG_HOME/google-plus-go-starter, where
+// XDG_CONFIG_HOME defaults to ~/.config.
+func ConfigDir() (string, os.Error) {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if len(base) == 0 {
+		home := os.Getenv("HOME")
+		if len(home) == 0 {
+			return "", os.NewError("neither XDG_CONFIG_HOME nor HOME is set")
+		}
+		base = filepath.Join(home, ".config")
+	}
+	return filepath.Join(base, "google-plus-go-starter"), nil
+}
+
+// profilePaths returns the profile with the given name, whether or not it
+// exists.
+func profilePaths(name string) (*Profile, os.Error) {
+	if !validProfileName.MatchString(name) {
+		return nil, fmt.Errorf("invalid profile name %q: use letters, digits, '_', '-' and '.'", name)
+	}
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "profiles", name)
+	return &Profile{
+		Name:       name,
+		ConfigPath: filepath.Join(dir, "config.json"),
+		TokenPath:  filepath.Join(dir, "token.json"),
+	}, nil
+}
+
+// GetProfile returns the profile with the given name, or the default profile
+// if name is empty.
+func GetProfile(name string) (*Profile, os.Error) {
+	if len(name) == 0 {
+		var err os.Error
+		if name, err = DefaultProfile(); err != nil {
+			return nil, err
+		}
+		if len(name) == 0 {
+			return nil, os.NewError("no default profile")
+		}
+	}
+	p, err := profilePaths(name)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := os.Stat(p.ConfigPath); err != nil {
+		return nil, fmt.Errorf("no profile named %q", name)
+	}
+	return p, nil
+}
+
+// Profiles returns the names of all profiles, in increasing order.
+func Profiles() ([]string, os.Error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return nil, err
+	}
+	infos, err := ioutil.ReadDir(filepath.Join(dir, "profiles"))
+	if err != nil {
+		if notExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var names []string
+	for _, info := range infos {
+		if info.IsDirectory() && validProfileName.MatchString(info.Name) {
+			names = append(names, info.Name)
+		}
+	}
+	return names, nil
+}
+
+// DefaultProfile returns the name of the default profile, or "" if there is
+// none.
+func DefaultProfile() (string, os.Error) {
+	dir, err := ConfigDir()
+	if err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(filepath.Join(dir, "default"))
+	if err != nil {
+		if notExist(err) {
+			return "", nil
+		}
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// SetDefaultProfile makes the profile with the given name the default one.
+func SetDefaultProfile(name string) os.Error {
+	if _, err := GetProfile(name); err != nil {
+		return err
+	}
+	dir, err := ConfigDir()
+	if err != nil {
+		return err
+	}
+	return writeFile(filepath.Join(dir, "default"), []byte(name+"\n"))
+}
+
+// AddProfile creates a profile with a copy of the API config file at
+// configPath and, if tokenPath isn't empty, of the OAuth token file at
+// tokenPath. The first profile becomes the default one.
+func AddProfile(name, configPath, tokenPath string) os.Error {
+	p, err := profilePaths(name)
+	if err != nil {
+		return err
+	}
+	if _, err := os.Stat(p.ConfigPath); err == nil {
+		return fmt.Errorf("profile %q already exists", name)
+	}
+	if err := os.MkdirAll(filepath.Dir(p.ConfigPath), 0700); err != nil {
+		return err
+	}
+	if err := copyFile(p.ConfigPath, configPath); err != nil {
+		return err
+	}
+	if len(tokenPath) > 0 {
+		if err := copyFile(p.TokenPath, tokenPath); err != nil {
+			return err
+		}
+	}
+
+	def, err := DefaultProfile()
+	if err != nil {
+		return err
+	}
+	if _, err := GetProfile(def); len(def) == 0 || err != nil {
+		return SetDefaultProfile(name)
+	}
+	return nil
+}
+
+// RemoveProfile deletes the profile with the given name, including its OAuth
+// tokens. The default profile can't be removed while other profiles exist.
+func RemoveProfile(name string) os.Error {
+	p, err := GetProfile(name)
+	if err != nil {
+		return err
+	}
+	def, err := DefaultProfile()
+	if err != nil {
+		return err
+	}
+	names, err := Profiles()
+	if err != nil {
+		return err
+	}
+	if def == name && len(names) > 1 {
+		return fmt.Errorf("profile %q is the default: set another default profile first", name)
+	}
+	if err := os.RemoveAll(filepath.Dir(p.ConfigPath)); err != nil {
+		return err
+	}
+	if def == name {
+		dir, err := ConfigDir()
+		if err != nil {
+			return err
+		}
+		return os.Remove(filepath.Join(dir, "default"))
+	}
+	return nil
+}
+
+// UseProfile calls Config with the API config file of the profile with the
+// given name, or of the default profile if name is empty, and sets TokenPath
+// to its OAuth token file.
+func UseProfile(name string) os.Error {
+	p, err := GetProfile(name)
+	if err != nil {
+		return err
+	}
+	if err := Config(p.ConfigPath); err != nil {
+		return err
+	}
+	TokenPath = p.TokenPath
+	return nil
+}
+
+// notExist reports whether err means that a file doesn't exist.
+func notExist(err os.Error) bool {
+	if e, ok := err.(*os.PathError); ok {
+		err = e.Error
+	}
+	return err == os.ENOENT
+}
+
+// copyFile copies the file at src to dst with writeFile.
+func copyFile(dst, src string) os.Error {
+	data, err := ioutil.ReadFile(src)
+	if err != nil {
+		return err
+	}
+	return writeFile(dst, data)
+}
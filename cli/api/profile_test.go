@@ -0,0 +1,110 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestProfiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer os.Setenv("XDG_CONFIG_HOME", os.Getenv("XDG_CONFIG_HOME"))
+	os.Setenv("XDG_CONFIG_HOME", dir)
+	defer func() { TokenPath = "" }()
+
+	configPath := filepath.Join(dir, "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(`{"APIKey": "key", "OAuthConfig": {"ClientId": "client", "ClientSecret": "secret"}}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	tokenPath := filepath.Join(dir, "token.json")
+	if err := ioutil.WriteFile(tokenPath, []byte(`{"AccessToken": "token"}`), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if names, err := Profiles(); err != nil || len(names) != 0 {
+		t.Errorf("expected no profiles, got %v, %v", names, err)
+	}
+	if err := UseProfile(""); err == nil {
+		t.Error("expected an error without a default profile")
+	}
+
+	// The first profile becomes the default one.
+	if err := AddProfile("personal", configPath, tokenPath); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddProfile("test", configPath, ""); err != nil {
+		t.Fatal(err)
+	}
+	if err := AddProfile("test", configPath, ""); err == nil {
+		t.Error("expected an error for an existing profile")
+	}
+	for _, name := range []string{"", "..", "../x", "a/b", ".hidden"} {
+		if err := AddProfile(name, configPath, ""); err == nil {
+			t.Errorf("expected an error for the profile name %q", name)
+		}
+	}
+	names, err := Profiles()
+	if got := strings.Join(names, ","); err != nil || got != "personal,test" {
+		t.Errorf("expected personal,test but got %s, %v", got, err)
+	}
+	if def, err := DefaultProfile(); err != nil || def != "personal" {
+		t.Errorf("expected the default profile personal but got %q, %v", def, err)
+	}
+
+	// Profiles have their own config and token files.
+	if err := UseProfile(""); err != nil {
+		t.Fatal(err)
+	}
+	if TokenPath != filepath.Join(dir, "google-plus-go-starter", "profiles", "personal", "token.json") {
+		t.Errorf("unexpected TokenPath %s", TokenPath)
+	}
+	if token, _, err := (&FileTokenStore{Path: TokenPath}).read(); err != nil || token.AccessToken != "token" {
+		t.Errorf("the token wasn't copied: %v, %v", token, err)
+	}
+	if fi, err := os.Stat(filepath.Join(dir, "google-plus-go-starter", "profiles", "test", "config.json")); err != nil || fi.Permission() != 0600 {
+		t.Errorf("the config wasn't copied with 0600 permissions: %v", err)
+	}
+
+	// The default profile can only be removed last.
+	if err := RemoveProfile("personal"); err == nil {
+		t.Error("expected an error when removing the default profile")
+	}
+	if err := SetDefaultProfile("missing"); err == nil {
+		t.Error("expected an error for a missing profile")
+	}
+	if err := SetDefaultProfile("test"); err != nil {
+		t.Fatal(err)
+	}
+	if err := RemoveProfile("personal"); err != nil {
+		t.Fatal(err)
+	}
+	if err := UseProfile("personal"); err == nil {
+		t.Error("expected an error for a removed profile")
+	}
+	if err := RemoveProfile("test"); err != nil {
+		t.Fatal(err)
+	}
+	if def, err := DefaultProfile(); err != nil || def != "" {
+		t.Errorf("expected no default profile but got %q, %v", def, err)
+	}
+}
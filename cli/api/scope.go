@@ -0,0 +1,75 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"sort"
+	"strings"
+
+	"google-plus-go-starter.googlecode.com/hg/core"
+)
+
+// PlusMeScope is the OAuth scope which gives access to the user's Google+
+// identity, e.g. for People.Get("me").
+const PlusMeScope = core.PlusMeScope
+
+// RequireScopes declares OAuth scopes that the *plus.Services returned by
+// OAuthPlus must be authorized for. OAuthPlus requests the union of these
+// scopes and of the Scope of the config file. If the stored OAuth tokens lack
+// one of them, OAuthPlus guides the user through the OAuth dance again to
+// grant the missing scopes, asking for the ones granted before too so that
+// every flow keeps them.
+func (c *Client) RequireScopes(scopes ...string) {
+	for _, scope := range scopes {
+		c.requiredScopes[scope] = true
+	}
+}
+
+// scopes returns the scopes that OAuthPlus requests, separated by spaces.
+func (c *Client) scopes() string {
+	return mergeScopes(c.config.OAuthConfig.Scope, strings.Join(sortedKeys(c.requiredScopes), " "))
+}
+
+// mergeScopes returns the union of two lists of scopes separated by spaces,
+// in increasing order.
+func mergeScopes(a, b string) string {
+	set := make(map[string]bool)
+	for _, scope := range strings.Fields(a + " " + b) {
+		set[scope] = true
+	}
+	return strings.Join(sortedKeys(set), " ")
+}
+
+// missingScopes returns the required scopes which aren't in granted, a list of
+// scopes separated by spaces, in increasing order.
+func (c *Client) missingScopes(granted string) []string {
+	set := make(map[string]bool)
+	for scope := range c.requiredScopes {
+		set[scope] = true
+	}
+	for _, scope := range strings.Fields(granted) {
+		set[scope] = false, false
+	}
+	return sortedKeys(set)
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
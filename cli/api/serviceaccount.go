@@ -0,0 +1,253 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"asn1"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"http"
+	"json"
+	"os"
+	"sync"
+	"url"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/cassette"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+)
+
+// jwtBearerGrantType is the grant type of JWT bearer token requests
+// (RFC 7523).
+const jwtBearerGrantType = "urn:ietf:params:oauth:grant-type:jwt-bearer"
+
+// serviceAccountKey is the content of a service account JSON key file.
+type serviceAccountKey struct {
+	Type         string `json:"type"`
+	PrivateKeyId string `json:"private_key_id"`
+	PrivateKey   string `json:"private_key"`
+	ClientEmail  string `json:"client_email"`
+	ClientId     string `json:"client_id"`
+	TokenURI     string `json:"token_uri"`
+}
+
+// ServiceAccountPlus returns a *plus.Service which provides authenticated
+// access to the Google+ API as the service account whose key file is at
+// ServiceAccountKeyPath, without user interaction, e.g. for unattended jobs.
+// It requests the same scopes as OAuthPlus. Access tokens are obtained by
+// signing JWT assertions with the key of the service account, and are renewed
+// shortly before they expire.
+func (c *Client) ServiceAccountPlus() (*plus.Service, os.Error) {
+	if len(c.ServiceAccountKeyPath) == 0 {
+		return nil, os.NewError("ServiceAccountKeyPath is not set")
+	}
+	key := &serviceAccountKey{}
+	if err := readJSON(key, c.ServiceAccountKeyPath); err != nil {
+		return nil, err
+	}
+	t, err := c.newServiceAccountTransport(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key file %s: %s", c.ServiceAccountKeyPath, err.String())
+	}
+	if c.replayer != nil {
+		t.token = &oauth.Token{AccessToken: cassette.Redacted}
+	}
+	return plus.New(&http.Client{Transport: t})
+}
+
+// serviceAccountTransport is an http.RoundTripper which makes requests
+// authenticated with the access token of a service account. It obtains a new
+// access token with the JWT bearer grant when it has none or when the current
+// one is about to expire.
+type serviceAccountTransport struct {
+	email    string
+	key      *rsa.PrivateKey
+	keyId    string
+	tokenURL string
+	scope    string
+
+	// Transport is the HTTP transport of both the token requests and the
+	// authenticated requests.
+	Transport http.RoundTripper
+	// now returns the current time in seconds.
+	now func() int64
+
+	mu    sync.Mutex
+	token *oauth.Token
+}
+
+// tokenRenewal is how long before the expiry of an access token
+// serviceAccountTransport gets a new one, so that requests in flight don't
+// fail.
+const tokenRenewal = 60
+
+// jwtLifetime is the lifetime of the JWT assertions in seconds. The token
+// endpoint rejects assertions valid for longer than an hour.
+const jwtLifetime = 3600
+
+func (c *Client) newServiceAccountTransport(key *serviceAccountKey) (*serviceAccountTransport, os.Error) {
+	if len(key.Type) > 0 && key.Type != "service_account" {
+		return nil, fmt.Errorf("the type is %q instead of service_account", key.Type)
+	}
+	if len(key.ClientEmail) == 0 {
+		return nil, os.NewError("client_email missing")
+	}
+	privateKey, err := parsePrivateKey([]byte(key.PrivateKey))
+	if err != nil {
+		return nil, err
+	}
+	tokenURL := key.TokenURI
+	if len(tokenURL) == 0 {
+		tokenURL = endpoint.GoogleTokenURL
+	}
+	return &serviceAccountTransport{
+		email:     key.ClientEmail,
+		key:       privateKey,
+		keyId:     key.PrivateKeyId,
+		tokenURL:  tokenURL,
+		scope:     c.scopes(),
+		Transport: c.authTransport(),
+		now:       c.now,
+	}, nil
+}
+
+func (t *serviceAccountTransport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	token, err := t.accessToken()
+	if err != nil {
+		return nil, err
+	}
+
+	// Modify a copy of the request, which belongs to the caller.
+	newReq := *req
+	newReq.Header = make(http.Header)
+	for k, v := range req.Header {
+		newReq.Header[k] = v
+	}
+	newReq.Header.Set("Authorization", "Bearer "+token)
+	return t.Transport.RoundTrip(&newReq)
+}
+
+// accessToken returns the current access token, getting a new one first if
+// there is none or if it expires within tokenRenewal seconds.
+func (t *serviceAccountTransport) accessToken() (string, os.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if t.token != nil && (t.token.TokenExpiry == 0 || t.token.TokenExpiry-tokenRenewal > t.now()) {
+		return t.token.AccessToken, nil
+	}
+	assertion, err := t.assertion()
+	if err != nil {
+		return "", err
+	}
+	client := &http.Client{Transport: t.Transport}
+	resp, err := client.PostForm(t.tokenURL, url.Values{
+		"grant_type": {jwtBearerGrantType},
+		"assertion":  {assertion},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("couldn't get an access token for %s: %s", t.email, describeOAuthError(resp))
+	}
+	tr := &tokenResponse{}
+	if err := json.NewDecoder(resp.Body).Decode(tr); err != nil {
+		return "", err
+	}
+	if len(tr.AccessToken) == 0 {
+		return "", os.NewError("the token endpoint returned no access token")
+	}
+	t.token = &oauth.Token{AccessToken: tr.AccessToken}
+	if tr.ExpiresIn > 0 {
+		t.token.TokenExpiry = t.now() + tr.ExpiresIn
+	}
+	return t.token.AccessToken, nil
+}
+
+// assertion returns a new JWT assertion for the token endpoint, signed with
+// the key of the service account (RS256).
+func (t *serviceAccountTransport) assertion() (string, os.Error) {
+	header, err := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT", "kid": t.keyId})
+	if err != nil {
+		return "", err
+	}
+	iat := t.now()
+	claims, err := json.Marshal(map[string]interface{}{
+		"iss":   t.email,
+		"scope": t.scope,
+		"aud":   t.tokenURL,
+		"iat":   iat,
+		"exp":   iat + jwtLifetime,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	signed := base64URL(header) + "." + base64URL(claims)
+	h := sha256.New()
+	h.Write([]byte(signed))
+	sig, err := rsa.SignPKCS1v15(rand.Reader, t.key, crypto.SHA256, h.Sum())
+	if err != nil {
+		return "", err
+	}
+	return signed + "." + base64URL(sig), nil
+}
+
+// pkcs8 is the ASN.1 structure of a PKCS #8 private key, in which service
+// account keys are stored.
+type pkcs8 struct {
+	Version    int
+	Algorithm  algorithmIdentifier
+	PrivateKey []byte
+}
+
+type algorithmIdentifier struct {
+	Algorithm  asn1.ObjectIdentifier
+	Parameters asn1.RawValue `asn1:"optional"`
+}
+
+// oidRSA identifies RSA keys in PKCS #8.
+var oidRSA = asn1.ObjectIdentifier{1, 2, 840, 113549, 1, 1, 1}
+
+// parsePrivateKey parses a PEM encoded RSA private key, in either PKCS #8
+// ("PRIVATE KEY") or PKCS #1 ("RSA PRIVATE KEY") form.
+func parsePrivateKey(data []byte) (*rsa.PrivateKey, os.Error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, os.NewError("private_key isn't PEM encoded")
+	}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		var k pkcs8
+		if _, err := asn1.Unmarshal(block.Bytes, &k); err != nil {
+			return nil, err
+		}
+		if !k.Algorithm.Algorithm.Equal(oidRSA) {
+			return nil, fmt.Errorf("private_key isn't an RSA key (algorithm %v)", k.Algorithm.Algorithm)
+		}
+		return x509.ParsePKCS1PrivateKey(k.PrivateKey)
+	}
+	return nil, fmt.Errorf("unexpected private_key type %q", block.Type)
+}
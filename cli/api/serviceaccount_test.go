@@ -0,0 +1,151 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"asn1"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// marshalPKCS8 encodes key as a PEM encoded PKCS #8 private key, like in
+// service account key files.
+func marshalPKCS8(t *testing.T, key *rsa.PrivateKey) string {
+	der, err := asn1.Marshal(pkcs8{
+		Algorithm: algorithmIdentifier{
+			Algorithm:  oidRSA,
+			Parameters: asn1.RawValue{Tag: 5}, // NULL
+		},
+		PrivateKey: x509.MarshalPKCS1PrivateKey(key),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}))
+}
+
+func TestServiceAccountPlus(t *testing.T) {
+	s, cleanUp := setUp(t)
+	defer cleanUp()
+	s.AddToken("access1", "1")
+	s.AddToken("access2", "1")
+
+	// A service account needs neither the API key nor the OAuth client.
+	Access = ServiceAccountAccess
+	defer func() { Access = "" }()
+	configPath := filepath.Join(filepath.Dir(TokenPath), "config.json")
+	if err := ioutil.WriteFile(configPath, []byte(fmt.Sprintf(`{"BaseURL": %q}`, s.BaseURL())), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := Config(configPath); err != nil {
+		t.Fatal(err)
+	}
+
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	auth := newFakeOAuthServer()
+	defer auth.Close()
+	auth.serviceAccountKey = &key.PublicKey
+
+	clock := int64(1000000)
+	defer func(f func() int64) { defaultClient.now = f }(defaultClient.now)
+	defaultClient.now = func() int64 { return clock }
+	RequireScopes(PlusMeScope)
+	defer func() { ServiceAccountKeyPath, defaultClient.requiredScopes = "", make(map[string]bool) }()
+
+	ServiceAccountKeyPath = filepath.Join(filepath.Dir(TokenPath), "key.json")
+	if err := writeJSON(&serviceAccountKey{
+		Type:        "service_account",
+		PrivateKey:  marshalPKCS8(t, key),
+		ClientEmail: "robot@example.iam.gserviceaccount.com",
+		TokenURI:    auth.URL + "/token",
+	}, ServiceAccountKeyPath); err != nil {
+		t.Fatal(err)
+	}
+
+	p, err := ServiceAccountPlus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	getMe := func(step string, issued int) {
+		me, err := p.People.Get("me").Do()
+		if err != nil {
+			t.Fatalf("%s: %s", step, err)
+		}
+		if me.Id != "1" {
+			t.Errorf("%s: expected me to be user 1, got %q", step, me.Id)
+		}
+		if auth.issued != issued {
+			t.Errorf("%s: expected %d access tokens, got %d", step, issued, auth.issued)
+		}
+	}
+
+	getMe("first request", 1)
+	if auth.scope != PlusMeScope {
+		t.Errorf("unexpected scope %q", auth.scope)
+	}
+	// The access token is cached until shortly before it expires.
+	clock += 3500
+	getMe("cached token", 1)
+	clock += 60
+	getMe("renewed token", 2)
+
+	// Assertions signed with another key are rejected.
+	other, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transport, err := defaultClient.newServiceAccountTransport(&serviceAccountKey{
+		PrivateKey:  marshalPKCS8(t, other),
+		ClientEmail: "robot@example.iam.gserviceaccount.com",
+		TokenURI:    auth.URL + "/token",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := transport.accessToken(); err == nil || !strings.Contains(err.String(), "invalid_grant") {
+		t.Errorf("expected an invalid_grant error, got %v", err)
+	}
+}
+
+func TestParsePrivateKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkcs1 := string(pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)}))
+	for _, data := range []string{marshalPKCS8(t, key), pkcs1} {
+		parsed, err := parsePrivateKey([]byte(data))
+		if err != nil {
+			t.Error(err)
+		} else if parsed.D.Cmp(key.D) != 0 {
+			t.Error("the parsed key differs")
+		}
+	}
+	for _, data := range []string{"", "not PEM", "-----BEGIN CERTIFICATE-----\nAAAA\n-----END CERTIFICATE-----\n"} {
+		if _, err := parsePrivateKey([]byte(data)); err == nil {
+			t.Errorf("expected an error for %q", data)
+		}
+	}
+}
@@ -0,0 +1,258 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"google-plus-go-starter.googlecode.com/hg/clientsecrets"
+	"google-plus-go-starter.googlecode.com/hg/configcheck"
+	"google-plus-go-starter.googlecode.com/hg/core"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+)
+
+// setting is a config value which can be set by an environment variable or by
+// Options.ConfigOverrides, and which may have a default value.
+type setting struct {
+	// Name is the name of the setting in ConfigOverrides.
+	Name string
+	// Env is the environment variable of the setting.
+	Env string
+	// Default is the value used when no layer sets one.
+	Default string
+	// Secret settings are masked by EffectiveConfig.
+	Secret bool
+	// field returns the field of the setting in c.
+	field func(c *core.Config) *string
+}
+
+// settings lists the settings, in the order shown by EffectiveConfig.
+var settings = []setting{
+	setting{"BaseURL", "PLUS_BASE_URL", "", false, func(c *core.Config) *string { return &c.BaseURL }},
+	setting{"APIKey", "PLUS_API_KEY", "", true, func(c *core.Config) *string { return &c.APIKey }},
+	setting{"ClientId", "PLUS_CLIENT_ID", "", false, func(c *core.Config) *string { return &c.OAuthConfig.ClientId }},
+	setting{"ClientSecret", "PLUS_CLIENT_SECRET", "", true, func(c *core.Config) *string { return &c.OAuthConfig.ClientSecret }},
+	setting{"Scope", "PLUS_SCOPE", PlusMeScope, false, func(c *core.Config) *string { return &c.OAuthConfig.Scope }},
+	setting{"RedirectURL", "PLUS_REDIRECT_URL", clientsecrets.OOBRedirectURI, false, func(c *core.Config) *string { return &c.OAuthConfig.RedirectURL }},
+	setting{"AuthURL", "PLUS_AUTH_URL", endpoint.GoogleAuthURL, false, func(c *core.Config) *string { return &c.OAuthConfig.AuthURL }},
+	setting{"TokenURL", "PLUS_TOKEN_URL", endpoint.GoogleTokenURL, false, func(c *core.Config) *string { return &c.OAuthConfig.TokenURL }},
+	setting{"DeviceCodeURL", "PLUS_DEVICE_CODE_URL", endpoint.GoogleDeviceCodeURL, false, func(c *core.Config) *string { return &c.DeviceCodeURL }},
+	setting{"TokenInfoURL", "PLUS_TOKEN_INFO_URL", endpoint.GoogleTokenInfoURL, false, func(c *core.Config) *string { return &c.TokenInfoURL }},
+	setting{"RevokeURL", "PLUS_REVOKE_URL", endpoint.GoogleRevokeURL, false, func(c *core.Config) *string { return &c.RevokeURL }},
+}
+
+// SettingNames returns the names of the settings that ConfigOverrides and the
+// environment variables can set, with their environment variables.
+func SettingNames() map[string]string {
+	names := make(map[string]string)
+	for _, s := range settings {
+		names[s.Name] = s.Env
+	}
+	return names
+}
+
+// Sources of config values, as reported by EffectiveConfig.
+const (
+	SourceDefault  = "default"
+	SourceFile     = "file"
+	SourceEnv      = "environment"
+	SourceOverride = "override"
+)
+
+// applySettings layers the environment variables and ConfigOverrides over the
+// values of the config file, then fills in the default values.
+func (c *Client) applySettings() {
+	c.sources = make(map[string]string)
+	for _, s := range settings {
+		field := s.field(&c.config)
+		if len(*field) > 0 {
+			c.sources[s.Name] = SourceFile
+		}
+		if v := os.Getenv(s.Env); len(v) > 0 {
+			*field = v
+			c.sources[s.Name] = SourceEnv + " " + s.Env
+		}
+		if v := c.ConfigOverrides[s.Name]; len(v) > 0 {
+			*field = v
+			c.sources[s.Name] = SourceOverride
+		}
+		if len(*field) == 0 && len(s.Default) > 0 {
+			*field = s.Default
+			c.sources[s.Name] = SourceDefault
+		}
+	}
+}
+
+// Kinds of access that the config of a Client must allow. Each requires the
+// credentials that it uses, so that e.g. a config without an OAuth client
+// still works for simple API access.
+const (
+	// APIKeyAccess requires an API key, for NoAuthPlus.
+	APIKeyAccess = "apiKey"
+	// OAuthAccess requires an OAuth client ID and secret, for OAuthPlus and
+	// the functions which manage the OAuth tokens.
+	OAuthAccess = "oauth"
+	// ServiceAccountAccess requires no credentials, as ServiceAccountPlus
+	// reads them from the key file of the service account.
+	ServiceAccountAccess = "serviceAccount"
+	// InspectAccess loads the config even if it has problems, which
+	// ConfigProblems returns, e.g. to display them along with the config.
+	InspectAccess = "inspect"
+)
+
+// validate returns every problem of the config for the Access of c.
+// InspectAccess reports the problems of the default Access.
+func (c *Client) validate() configcheck.Problems {
+	config := &c.config
+	var p configcheck.Problems
+	for name := range c.ConfigOverrides {
+		if _, ok := SettingNames()[name]; !ok {
+			p.Add("unknown setting %q", name)
+		}
+	}
+	config.Check(&p)
+
+	o := &config.OAuthConfig
+	switch c.Access {
+	case APIKeyAccess:
+		config.RequireAPIKey(&p)
+	case OAuthAccess:
+		p.Required("ClientId", o.ClientId)
+		p.Required("ClientSecret", o.ClientSecret)
+	case ServiceAccountAccess:
+	default:
+		config.RequireAPIKey(&p)
+		p.Required("ClientId", o.ClientId)
+		p.Required("ClientSecret", o.ClientSecret)
+	}
+	p.Scopes("Scope", o.Scope)
+
+	if o.RedirectURL != clientsecrets.OOBRedirectURI {
+		p.URL("RedirectURL", o.RedirectURL)
+	}
+	p.URL("AuthURL", o.AuthURL)
+	p.URL("TokenURL", o.TokenURL)
+	p.URL("DeviceCodeURL", config.DeviceCodeURL)
+	p.URL("TokenInfoURL", config.TokenInfoURL)
+	p.URL("RevokeURL", config.RevokeURL)
+	if config.Cache.Memcache {
+		p.Add("Cache.Memcache is only supported on App Engine")
+	}
+	return p
+}
+
+// ConfigProblems returns the problems of the config of c, which is only loaded
+// despite them with InspectAccess.
+func (c *Client) ConfigProblems() []string {
+	return c.problems
+}
+
+// ConfigValue is a value of the effective config.
+type ConfigValue struct {
+	Name  string
+	Value string
+	// Source is where the value comes from: SourceDefault, SourceFile,
+	// SourceEnv followed by the variable name, or SourceOverride. It is empty
+	// for unset values.
+	Source string
+	// Problem lists the problems of the value, separated by semicolons, when
+	// the config was loaded with InspectAccess. Problems which aren't about
+	// any value are returned as values with an empty Name.
+	Problem string
+}
+
+// EffectiveConfig returns the values of the config of c, with the environment
+// variables and ConfigOverrides applied. Secrets are masked so that they can
+// be displayed.
+func (c *Client) EffectiveConfig() []ConfigValue {
+	config := &c.config
+	var values []ConfigValue
+	for _, s := range settings {
+		v := *s.field(config)
+		if s.Secret {
+			v = mask(v)
+		}
+		values = append(values, ConfigValue{Name: s.Name, Value: v, Source: c.sources[s.Name]})
+	}
+	for i, key := range config.APIKeys {
+		weight := key.Weight
+		if weight <= 0 {
+			weight = 1
+		}
+		values = append(values, ConfigValue{Name: fmt.Sprintf("APIKeys[%d]", i),
+			Value: mask(key.Key) + " (weight " + strconv.Itoa(weight) + ")", Source: SourceFile})
+	}
+	if config.RateLimit.RequestsPerSecond > 0 {
+		values = append(values, ConfigValue{Name: "RateLimit",
+			Value:  fmt.Sprintf("%g requests per second, burst %d", config.RateLimit.RequestsPerSecond, config.RateLimit.Burst),
+			Source: SourceFile})
+	}
+	switch {
+	case len(config.Cache.Dir) > 0:
+		values = append(values, ConfigValue{Name: "Cache", Value: "directory " + config.Cache.Dir, Source: SourceFile})
+	case config.Cache.Memcache:
+		values = append(values, ConfigValue{Name: "Cache", Value: "memcache", Source: SourceFile})
+	case config.Cache.MaxEntries != 0:
+		values = append(values, ConfigValue{Name: "Cache", Value: strconv.Itoa(config.Cache.MaxEntries) + " entries in memory", Source: SourceFile})
+	}
+	return addProblems(values, c.problems)
+}
+
+// addProblems sets the Problem of each value to the problems which start with
+// its name, and appends the other problems as values without a name.
+func addProblems(values []ConfigValue, problems configcheck.Problems) []ConfigValue {
+	for _, problem := range problems {
+		found := false
+		for i := range values {
+			v := &values[i]
+			if !isAbout(problem, v.Name) {
+				continue
+			}
+			if len(v.Problem) > 0 {
+				v.Problem += "; "
+			}
+			v.Problem += problem
+			found = true
+		}
+		if !found {
+			values = append(values, ConfigValue{Problem: problem})
+		}
+	}
+	return values
+}
+
+// isAbout reports whether problem is about the value named name, e.g.
+// "ClientId is missing" or "Cache.MaxEntries can't be negative" for "Cache".
+func isAbout(problem, name string) bool {
+	if !strings.HasPrefix(problem, name) || len(problem) == len(name) {
+		return false
+	}
+	return strings.Contains(" .:", problem[len(name):len(name)+1])
+}
+
+// mask hides all but the first 4 characters of a secret, and hides short
+// secrets completely.
+func mask(secret string) string {
+	if len(secret) == 0 {
+		return ""
+	}
+	if len(secret) < 12 {
+		return strings.Repeat("*", 8)
+	}
+	return secret[:4] + strings.Repeat("*", 8)
+}
@@ -0,0 +1,339 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"exec"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"json"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-plus-go-starter.googlecode.com/hg/sealed"
+)
+
+// TokenPassphraseEnv is the environment variable holding the passphrase of
+// encrypted token files. If it is empty, the passphrase is prompted for on the
+// terminal.
+const TokenPassphraseEnv = "PLUS_TOKEN_PASSPHRASE"
+
+// FileTokenStore is a core.TokenStore which keeps the token in a file, possibly
+// encrypted with a passphrase from the TokenPassphraseEnv environment
+// variable or the terminal.
+type FileTokenStore struct {
+	Path string
+	// Encrypt makes WriteToken encrypt the file. Encrypted files are always
+	// read, and stay encrypted when replaced, whether or not Encrypt is set.
+	Encrypt bool
+
+	// passphrase is the passphrase of the file, once read.
+	passphrase []byte
+	// locked is set while Lock is held, so that writes don't take the lock
+	// again.
+	locked bool
+}
+
+// DecryptError is returned by FileTokenStore.ReadToken when an encrypted
+// token file can't be decrypted, e.g. with the wrong passphrase.
+type DecryptError struct {
+	Path string
+	Err  os.Error
+}
+
+func (e *DecryptError) String() string {
+	return fmt.Sprintf("Couldn't decrypt oauth.Token from %s: %s", e.Path, e.Err.String())
+}
+
+func (s *FileTokenStore) ReadToken() (*oauth.Token, os.Error) {
+	token, _, err := s.read()
+	if notExist(err) {
+		return nil, nil
+	}
+	if _, ok := err.(*DecryptError); ok {
+		return nil, err
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't read oauth.Token from %s: %s", s.Path, err.String())
+	}
+	return token, nil
+}
+
+func (s *FileTokenStore) WriteToken(token *oauth.Token) os.Error {
+	return s.write(token, s.Encrypt || s.Encrypted())
+}
+
+func (s *FileTokenStore) DeleteToken() os.Error {
+	if err := os.Remove(s.Path); err != nil && !notExist(err) {
+		return err
+	}
+	return nil
+}
+
+// Lock takes the lock of the token file, so that core.TokenSaver can read,
+// refresh and write the token without another process doing the same. See
+// lockFile.
+func (s *FileTokenStore) Lock() (unlock func(), err os.Error) {
+	unlockFile, err := lockFile(s.Path + ".lock")
+	if err != nil {
+		return nil, err
+	}
+	s.locked = true
+	return func() {
+		s.locked = false
+		unlockFile()
+	}, nil
+}
+
+// Encrypted reports whether the file exists and is encrypted.
+func (s *FileTokenStore) Encrypted() bool {
+	data, err := ioutil.ReadFile(s.Path)
+	return err == nil && sealed.IsSealed(data)
+}
+
+// read reads the token file, which may be encrypted. encrypted reports whether
+// it is, and the errors of its decryption are *DecryptErrors.
+func (s *FileTokenStore) read() (token *oauth.Token, encrypted bool, err os.Error) {
+	data, err := ioutil.ReadFile(s.Path)
+	if err != nil {
+		return nil, false, err
+	}
+	if encrypted = sealed.IsSealed(data); encrypted {
+		passphrase, err := s.getPassphrase(false)
+		if err == nil {
+			data, err = sealed.Open(data, passphrase)
+		}
+		if err != nil {
+			return nil, true, &DecryptError{s.Path, err}
+		}
+	}
+	token = &oauth.Token{}
+	if err := json.Unmarshal(data, token); err != nil {
+		return nil, encrypted, err
+	}
+	return token, encrypted, nil
+}
+
+// write writes token to the file, encrypted if encrypt is set.
+func (s *FileTokenStore) write(token *oauth.Token, encrypt bool) os.Error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return err
+	}
+	if encrypt {
+		passphrase, err := s.getPassphrase(true)
+		if err != nil {
+			return err
+		}
+		if data, err = sealed.Seal(data, passphrase, nil); err != nil {
+			return err
+		}
+	}
+	if s.locked {
+		return replaceFile(s.Path, data)
+	}
+	return writeFile(s.Path, data)
+}
+
+// EncryptTokenFile encrypts the plaintext token file at path in place, with
+// the passphrase from the TokenPassphraseEnv environment variable or the
+// terminal.
+func EncryptTokenFile(path string) os.Error {
+	s := &FileTokenStore{Path: path}
+	token, encrypted, err := s.read()
+	if err != nil {
+		return err
+	}
+	if encrypted {
+		return fmt.Errorf("%s is already encrypted", path)
+	}
+	return s.write(token, true)
+}
+
+// getPassphrase returns the passphrase of the file from the
+// TokenPassphraseEnv environment variable, or else prompts for it, twice if
+// confirm is set. The passphrase is only prompted for once per store.
+func (s *FileTokenStore) getPassphrase(confirm bool) ([]byte, os.Error) {
+	if s.passphrase != nil {
+		return s.passphrase, nil
+	}
+	if p := os.Getenv(TokenPassphraseEnv); len(p) > 0 {
+		s.passphrase = []byte(p)
+		return s.passphrase, nil
+	}
+
+	p, err := readPassword("Token file passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, os.NewError("empty passphrase")
+	}
+	if confirm {
+		again, err := readPassword("Confirm passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		if string(again) != string(p) {
+			return nil, os.NewError("the passphrases don't match")
+		}
+	}
+	s.passphrase = p
+	return p, nil
+}
+
+// readPassword prints prompt and reads a line from the terminal without
+// echoing it. It is replaced in tests.
+var readPassword = func(prompt string) ([]byte, os.Error) {
+	fmt.Fprint(os.Stderr, prompt)
+	defer fmt.Fprintln(os.Stderr)
+	if err := stty("-echo"); err != nil {
+		return nil, fmt.Errorf("can't disable echo to read the passphrase (set %s instead): %s",
+			TokenPassphraseEnv, err.String())
+	}
+	defer stty("echo")
+	return readLine(os.Stdin)
+}
+
+func stty(arg string) os.Error {
+	cmd := exec.Command("stty", arg)
+	cmd.Stdin = os.Stdin
+	return cmd.Run()
+}
+
+// readLine reads a line from r, one byte at a time so that no input after it
+// is consumed.
+func readLine(r io.Reader) ([]byte, os.Error) {
+	var line []byte
+	b := make([]byte, 1)
+	for {
+		n, err := r.Read(b)
+		if n == 1 {
+			if b[0] == '\n' {
+				break
+			}
+			line = append(line, b[0])
+		}
+		if err == os.EOF && len(line) > 0 {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(line) > 0 && line[len(line)-1] == '\r' {
+		line = line[:len(line)-1]
+	}
+	return line, nil
+}
+
+// writeJSON writes v to the file at path, like writeFile.
+func writeJSON(v interface{}, path string) os.Error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, append(data, '\n'))
+}
+
+// writeFile writes data to the file at path, readable by the current user
+// only. The file is replaced atomically, so that readers never see a partial
+// file, and writers hold the lock of path (see lockFile), so that concurrent
+// CLI invocations don't interfere with each other.
+func writeFile(path string, data []byte) os.Error {
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	return replaceFile(path, data)
+}
+
+// replaceFile implements writeFile, without the lock.
+func replaceFile(path string, data []byte) os.Error {
+	// ioutil.TempFile creates the file with 0600 permissions. It must be in
+	// the same directory for the rename to be atomic.
+	dir, name := filepath.Split(path)
+	if len(dir) == 0 {
+		dir = "."
+	}
+	file, err := ioutil.TempFile(dir, name+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = file.Write(data)
+	if err == nil {
+		err = file.Sync()
+	}
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(file.Name(), path)
+	}
+	if err != nil {
+		os.Remove(file.Name())
+	}
+	return err
+}
+
+// lockFile takes an exclusive lock on the file at path, creating it if
+// necessary, and returns a function that releases the lock. Files replaced by
+// renaming them can't be locked themselves, so their lock is this separate
+// file, e.g. "token.json.lock" for "token.json".
+//
+// The lock file is removed when the lock is released, before unlocking it. A
+// waiting process may then lock the removed file, so the lock is only taken
+// once the file locked is still the one at path.
+func lockFile(path string) (unlock func(), err os.Error) {
+	for {
+		file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0600)
+		if err != nil {
+			return nil, err
+		}
+		if errno := syscall.Flock(file.Fd(), syscall.LOCK_EX); errno != 0 {
+			file.Close()
+			return nil, os.NewSyscallError("flock", errno)
+		}
+		locked, err := file.Stat()
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+		current, err := os.Stat(path)
+		if err == nil && sameFile(locked, current) {
+			return func() {
+				os.Remove(path)
+				syscall.Flock(file.Fd(), syscall.LOCK_UN)
+				file.Close()
+			}, nil
+		}
+		// The file was removed by the previous holder of the lock: lock
+		// the next one.
+		file.Close()
+		if err != nil && !notExist(err) {
+			return nil, err
+		}
+	}
+	panic("unreachable")
+}
+
+// sameFile reports whether a and b describe the same file.
+func sameFile(a, b *os.FileInfo) bool {
+	return a.Dev == b.Dev && a.Ino == b.Ino
+}
@@ -0,0 +1,239 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package api
+
+import (
+	"http"
+	"http/httptest"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-plus-go-starter.googlecode.com/hg/core"
+	"google-plus-go-starter.googlecode.com/hg/sealed"
+)
+
+func TestWriteJSON(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token.json")
+
+	// An existing file readable by others is replaced.
+	if err := ioutil.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeJSON(&oauth.Token{AccessToken: "token"}, path); err != nil {
+		t.Fatal(err)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if perm := fi.Permission(); perm != 0600 {
+		t.Errorf("expected permissions 0600 but got %o", perm)
+	}
+	token := &oauth.Token{}
+	if err := readJSON(token, path); err != nil || token.AccessToken != "token" {
+		t.Errorf("expected access token %q but got %v, %v", "token", token, err)
+	}
+
+	// Concurrent writers don't corrupt the file or leave temporary or lock
+	// files.
+	done := make(chan bool)
+	for i := 0; i < 10; i++ {
+		go func(i int) {
+			if err := writeJSON(&oauth.Token{AccessToken: "token" + strconv.Itoa(i)}, path); err != nil {
+				t.Error(err)
+			}
+			done <- true
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		<-done
+	}
+	if err := readJSON(token, path); err != nil || !strings.HasPrefix(token.AccessToken, "token") {
+		t.Errorf("unexpected token %v, %v", token, err)
+	}
+	d, err := os.Open(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names, err := d.Readdirnames(-1)
+	d.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(names)
+	if got := strings.Join(names, ","); got != "token.json" {
+		t.Errorf("unexpected files %s", got)
+	}
+}
+
+func TestTokenSaver(t *testing.T) {
+	refreshes := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			refreshes++
+			if r.FormValue("refresh_token") != "refresh" {
+				http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			io.WriteString(w, `{"access_token": "new", "expires_in": 3600}`)
+			return
+		}
+		io.WriteString(w, "{}")
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token.json")
+
+	// An expired access token is refreshed by the first request.
+	transport := &oauth.Transport{
+		Config: &oauth.Config{ClientId: "client", TokenURL: server.URL + "/token"},
+		Token:  &oauth.Token{AccessToken: "old", RefreshToken: "refresh", TokenExpiry: 1},
+	}
+	saver := core.NewTokenSaver(transport, &FileTokenStore{Path: path})
+	resp, err := saver.Client().Get(server.URL + "/plus/v1/people/me")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	token := &oauth.Token{}
+	if err := readJSON(token, path); err != nil {
+		t.Fatal(err)
+	}
+	if token.AccessToken != "new" || token.RefreshToken != "refresh" || token.Expired() {
+		t.Errorf("expected the refreshed token to be saved, got %v", token)
+	}
+
+	// Another process which read the expired token before uses the refreshed
+	// one instead of refreshing it again.
+	transport = &oauth.Transport{
+		Config: &oauth.Config{ClientId: "client", TokenURL: server.URL + "/token"},
+		Token:  &oauth.Token{AccessToken: "old", RefreshToken: "refresh", TokenExpiry: 1},
+	}
+	saver = core.NewTokenSaver(transport, &FileTokenStore{Path: path})
+	if resp, err = saver.Client().Get(server.URL + "/plus/v1/people/me"); err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if refreshes != 1 || transport.Token.AccessToken != "new" {
+		t.Errorf("expected 1 refresh and the refreshed token, got %d and %v", refreshes, transport.Token)
+	}
+	if _, err := os.Stat(path + ".lock"); !notExist(err) {
+		t.Errorf("expected the lock file to be removed, got %v", err)
+	}
+}
+
+func TestEncryptTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "api")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "token.json")
+
+	// Make scrypt cheap, and play the user typing the passphrase.
+	defer func(p *sealed.Params) { sealed.DefaultParams = p }(sealed.DefaultParams)
+	sealed.DefaultParams = &sealed.Params{LogN: 4, R: 1, P: 1}
+	defer func(f func(string) ([]byte, os.Error)) { readPassword = f }(readPassword)
+	prompts := 0
+	readPassword = func(string) ([]byte, os.Error) {
+		prompts++
+		return []byte("passphrase"), nil
+	}
+	os.Setenv(TokenPassphraseEnv, "")
+
+	if err := writeJSON(&oauth.Token{AccessToken: "token", RefreshToken: "refresh"}, path); err != nil {
+		t.Fatal(err)
+	}
+	if _, encrypted, err := (&FileTokenStore{Path: path}).read(); err != nil || encrypted {
+		t.Fatalf("expected a plaintext token, got %v, %v", encrypted, err)
+	}
+
+	if err := EncryptTokenFile(path); err != nil {
+		t.Fatal(err)
+	}
+	// The passphrase is confirmed.
+	if prompts != 2 {
+		t.Errorf("expected 2 prompts but got %d", prompts)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !sealed.IsSealed(data) || strings.Contains(string(data), "refresh") {
+		t.Errorf("the token file isn't encrypted: %q", data)
+	}
+	// A store prompts for the passphrase once, then remembers it.
+	s := &FileTokenStore{Path: path}
+	for i := 0; i < 2; i++ {
+		token, encrypted, err := s.read()
+		if err != nil || !encrypted || token.AccessToken != "token" || token.RefreshToken != "refresh" {
+			t.Errorf("unexpected token %v, %v, %v", token, encrypted, err)
+		}
+	}
+	if prompts != 3 {
+		t.Errorf("expected 3 prompts but got %d", prompts)
+	}
+	if err := EncryptTokenFile(path); err == nil {
+		t.Error("expected an error for an encrypted file")
+	}
+
+	s = &FileTokenStore{Path: path, passphrase: []byte("wrong")}
+	if _, encrypted, err := s.read(); !encrypted || !isDecryptError(err, sealed.ErrOpen) {
+		t.Errorf("wrong passphrase: expected ErrOpen but got %v, %v", encrypted, err)
+	}
+	if _, err := s.ReadToken(); !isDecryptError(err, sealed.ErrOpen) {
+		t.Errorf("wrong passphrase: expected ErrOpen but got %v", err)
+	}
+	os.Setenv(TokenPassphraseEnv, "passphrase")
+	defer os.Setenv(TokenPassphraseEnv, "")
+	if _, _, err := (&FileTokenStore{Path: path}).read(); err != nil {
+		t.Errorf("passphrase from the environment: %v", err)
+	}
+}
+
+// isDecryptError reports whether err is a *DecryptError caused by cause.
+func isDecryptError(err, cause os.Error) bool {
+	e, ok := err.(*DecryptError)
+	return ok && e.Err == cause
+}
+
+func TestReadLine(t *testing.T) {
+	r := strings.NewReader("secret\r\nnext line")
+	if line, err := readLine(r); err != nil || string(line) != "secret" {
+		t.Errorf("expected %q but got %q, %v", "secret", line, err)
+	}
+	if line, err := readLine(r); err != nil || string(line) != "next line" {
+		t.Errorf("expected %q but got %q, %v", "next line", line, err)
+	}
+}
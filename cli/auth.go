@@ -0,0 +1,131 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"template"
+
+	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
+)
+
+// The auth commands manage the OAuth tokens stored at tokenPath. They don't run
+// with "all".
+var authCommand = &command{
+	Name:        "auth",
+	Description: "Manage the stored OAuth tokens.",
+	Subcommands: []*command{
+		&command{
+			Name:        "encrypt",
+			Description: "Encrypt the plaintext token file in place.",
+			Auth:        oauth,
+			Run:         AuthEncrypt,
+		},
+		&command{
+			Name:        "login",
+			Description: "Authorize again, for the scopes of all commands, and replace the stored tokens.",
+			Auth:        oauth,
+			Run:         AuthLogin,
+		},
+		&command{
+			Name:        "logout",
+			Description: "Revoke the stored tokens and delete them.",
+			Auth:        oauth,
+			Run:         AuthLogout,
+		},
+		&command{
+			Name:        "status",
+			Description: "Display the account, scopes and expiry of the stored tokens.",
+			Auth:        oauth,
+			Run:         AuthStatus,
+		},
+	},
+}
+
+// AuthStatus displays whether the stored OAuth tokens are valid, for which
+// account and scopes, and when the access token expires.
+func AuthStatus(args []string) os.Error {
+	status, err := api.AuthStatus()
+	if err != nil {
+		return err
+	}
+	return display(map[string]interface{}{
+		"Path":    api.TokenPath,
+		"Status":  status,
+		"Scopes":  strings.Fields(status.Info.Scope),
+		"Expires": formatSeconds(status.Info.ExpiresIn),
+	}, authStatusView)
+}
+
+var authStatusView = &render.View{
+	Template: template.Must(template.New("auth.status").Parse(`
+Token file: {{.Path}}{{if .Status.Encrypted}} (encrypted){{end}}
+Account: {{with .Status.Info}}{{if .Email}}{{.Email}} {{end}}{{if .UserId}}(user {{.UserId}}){{end}}{{end}}
+Client: {{.Status.Info.IssuedTo}}
+Scopes:{{range .Scopes}}
+  {{.}}{{end}}
+Access token expires in: {{.Expires}}{{if .Status.Refreshed}} (refreshed){{end}}
+Refresh token: {{if .Status.HasRefreshToken}}yes{{else}}no{{end}}
+
+`)),
+	Columns: []string{"Path", "Status/Info/email", "Scopes", "Expires"},
+}
+
+// AuthLogin guides the user through the OAuth dance, replacing the stored
+// OAuth tokens. It authorizes the scopes of all commands, so that they don't
+// have to ask again.
+func AuthLogin(args []string) os.Error {
+	requireAllScopes()
+	if err := api.Login(); err != nil {
+		return err
+	}
+	fmt.Println("Logged in. The OAuth tokens were saved to", api.TokenPath)
+	return nil
+}
+
+// AuthLogout revokes the stored OAuth tokens and deletes them.
+func AuthLogout(args []string) os.Error {
+	if err := api.Logout(); err != nil {
+		return err
+	}
+	fmt.Println("Logged out. The OAuth tokens were revoked and", api.TokenPath, "was deleted.")
+	return nil
+}
+
+// AuthEncrypt encrypts the plaintext token file with a passphrase.
+func AuthEncrypt(args []string) os.Error {
+	if len(api.TokenPath) == 0 {
+		return os.NewError("You must supply the tokenPath flag.")
+	}
+	if err := api.EncryptTokenFile(api.TokenPath); err != nil {
+		return fmt.Errorf("Could not encrypt token file: %s", err)
+	}
+	fmt.Println("Encrypted", api.TokenPath)
+	return nil
+}
+
+// formatSeconds formats a number of seconds like "1h02m03s".
+func formatSeconds(s int64) string {
+	if s <= 0 {
+		return "expired"
+	}
+	if s < 3600 {
+		return fmt.Sprintf("%dm%02ds", s/60, s%60)
+	}
+	return fmt.Sprintf("%dh%02dm%02ds", s/3600, s/60%60, s%60)
+}
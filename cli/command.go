@@ -0,0 +1,313 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
+)
+
+// authMode describes what a command needs before it runs.
+type authMode int
+
+const (
+	// noConfig commands run without loading the API config, e.g. to manage
+	// profiles.
+	noConfig authMode = iota
+	// anyConfig commands load the API config even if it has problems, e.g.
+	// to display them.
+	anyConfig
+	// apiKey commands load the API config and use the API key only.
+	apiKey
+	// oauth commands load the API config and act as the user, or as the
+	// service account if the serviceAccountKey flag is set.
+	oauth
+)
+
+var authModeNames = []string{
+	noConfig:  "none",
+	anyConfig: "none",
+	apiKey:    "API key",
+	oauth:     "OAuth",
+}
+
+// arg describes a positional argument of a command.
+type arg struct {
+	Name     string
+	Optional bool
+}
+
+// A command is a node of the command tree, e.g. "people" or "people search".
+// Commands with Subcommands only group them, the others have a Run function
+// which is called with the positional arguments left after parsing Flags.
+type command struct {
+	Name        string
+	Description string // One line, shown in the help of the parent command.
+	Args        []arg
+	Auth        authMode
+	Scopes      []string // The OAuth scopes needed beyond the Scope of the config file.
+	Flags       *flag.FlagSet
+	Run         func(args []string) os.Error
+	Subcommands []*command
+
+	// View displays the results of Run. Its Resource, if any, is the type
+	// whose fields can be selected with the fields flag.
+	View *render.View
+
+	// Demo holds the arguments used by the "all" command, which leaves out
+	// the commands without them.
+	Demo []string
+
+	parent *command
+}
+
+// setParents links the subcommands of c, recursively, to their parents.
+func (c *command) setParents() {
+	for _, sub := range c.Subcommands {
+		sub.parent = c
+		sub.setParents()
+	}
+}
+
+// top returns the root of the command tree of c.
+func (c *command) top() *command {
+	for c.parent != nil {
+		c = c.parent
+	}
+	return c
+}
+
+// path returns the command line which runs c, e.g. "cli people search".
+func (c *command) path() string {
+	if c.parent == nil {
+		return c.Name
+	}
+	return c.parent.path() + " " + c.Name
+}
+
+// running is the command being run. Its Auth selects the *plus.Service
+// returned by plusService.
+var running *command
+
+// execute calls the Run function of c with args, as the running command.
+func (c *command) execute(args []string) os.Error {
+	defer func(prev *command) { running = prev }(running)
+	running = c
+	return c.Run(args)
+}
+
+// usageError is returned by Run functions for invalid flags or arguments,
+// which are reported along with the help of the command.
+type usageError string
+
+func (e usageError) String() string {
+	return string(e)
+}
+
+// walk calls fn for c and all its subcommands, recursively.
+func (c *command) walk(fn func(*command)) {
+	fn(c)
+	for _, sub := range c.Subcommands {
+		sub.walk(fn)
+	}
+}
+
+// find follows the leading arguments that name subcommands of c, and returns
+// the command they lead to with the remaining arguments. Unknown names are
+// reported along with the closest subcommands.
+func (c *command) find(args []string) (*command, []string, os.Error) {
+	for len(args) > 0 && len(c.Subcommands) > 0 && !strings.HasPrefix(args[0], "-") {
+		sub := c.subcommand(args[0])
+		if sub == nil {
+			msg := fmt.Sprintf("Unknown command %q.", c.path()+" "+args[0])
+			if suggestions := c.suggest(args[0]); len(suggestions) > 0 {
+				msg += fmt.Sprintf(" Did you mean %q?", strings.Join(suggestions, `" or "`))
+			}
+			return nil, nil, fmt.Errorf("%s Run %q for a list of commands.", msg, c.path()+" -help")
+		}
+		c, args = sub, args[1:]
+	}
+	return c, args, nil
+}
+
+// subcommand returns the subcommand of c with the given name, or nil.
+func (c *command) subcommand(name string) *command {
+	for _, sub := range c.Subcommands {
+		if sub.Name == name {
+			return sub
+		}
+	}
+	return nil
+}
+
+// suggest returns the paths of the subcommands of c whose names are close to
+// name, i.e. start with it or are at most two edits away.
+func (c *command) suggest(name string) []string {
+	var suggestions []string
+	for _, sub := range c.Subcommands {
+		if strings.HasPrefix(sub.Name, name) || distance(strings.ToLower(sub.Name), strings.ToLower(name)) <= 2 {
+			suggestions = append(suggestions, sub.path())
+		}
+	}
+	return suggestions
+}
+
+// distance returns the Levenshtein distance between a and b, i.e. the number
+// of single-byte insertions, deletions and substitutions turning a into b.
+func distance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	cur := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = min(prev[j]+1, cur[j-1]+1, prev[j-1]+cost)
+		}
+		prev, cur = cur, prev
+	}
+	return prev[len(b)]
+}
+
+func min(n int, others ...int) int {
+	for _, o := range others {
+		if o < n {
+			n = o
+		}
+	}
+	return n
+}
+
+// parse parses the flags of c from args, and checks the number of positional
+// arguments left. Its errors have already been reported along with the help
+// of c, or are flag.ErrHelp if the help was asked for.
+func (c *command) parse(args []string) ([]string, os.Error) {
+	if c.Flags == nil {
+		c.Flags = flag.NewFlagSet(c.path(), flag.ContinueOnError)
+	}
+	c.Flags.Usage = func() { c.help(os.Stderr) }
+	if err := c.Flags.Parse(args); err != nil {
+		return nil, err
+	}
+	args = c.Flags.Args()
+
+	var err os.Error
+	required := 0
+	for _, a := range c.Args {
+		if !a.Optional {
+			required++
+		}
+	}
+	if len(args) < required {
+		err = fmt.Errorf("Missing %s.", c.Args[len(args)].Name)
+	} else if len(args) > len(c.Args) {
+		err = fmt.Errorf("Unexpected argument %q.", args[len(c.Args)])
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		c.help(os.Stderr)
+		return nil, err
+	}
+	return args, nil
+}
+
+// usage returns the usage line of c, e.g.
+// "cli [global flags] people search [flags] QUERY".
+func (c *command) usage() string {
+	top := c.top()
+	path := top.Name + " [global flags]" + c.path()[len(top.Name):]
+	if len(c.Subcommands) > 0 {
+		return path + " COMMAND [arguments]"
+	}
+	if c.Flags != nil && hasFlags(c.Flags) {
+		path += " [flags]"
+	}
+	for _, a := range c.Args {
+		if a.Optional {
+			path += " [" + a.Name + "]"
+		} else {
+			path += " " + a.Name
+		}
+	}
+	return path
+}
+
+func hasFlags(fs *flag.FlagSet) bool {
+	found := false
+	fs.VisitAll(func(*flag.Flag) { found = true })
+	return found
+}
+
+// help writes the usage, description, authorization, flags and subcommands
+// of c to w. The root command also lists the global flags.
+func (c *command) help(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s\n", c.usage())
+	if len(c.Description) > 0 {
+		fmt.Fprintf(w, "\n%s\n", c.Description)
+	}
+	if c.Run != nil && c.Auth != noConfig && c.Auth != anyConfig {
+		auth := authModeNames[c.Auth]
+		if len(c.Scopes) > 0 {
+			auth += " (" + strings.Join(c.Scopes, " ") + ")"
+		}
+		fmt.Fprintf(w, "\nAuthorization: %s\n", auth)
+	}
+	if c.Flags != nil && hasFlags(c.Flags) {
+		fmt.Fprintln(w, "\nFlags:")
+		printFlags(w, c.Flags)
+	}
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintln(w, "\nCommands:")
+		width := 0
+		for _, sub := range c.Subcommands {
+			if len(sub.Name) > width {
+				width = len(sub.Name)
+			}
+		}
+		for _, sub := range c.Subcommands {
+			fmt.Fprintf(w, "  %s%s  %s\n", sub.Name, strings.Repeat(" ", width-len(sub.Name)), sub.Description)
+		}
+	}
+	if c.parent == nil {
+		fmt.Fprintln(w, "\nGlobal flags, which go before the command:")
+		printFlags(w, nil)
+	}
+	if len(c.Subcommands) > 0 {
+		fmt.Fprintf(w, "\nRun \"%s COMMAND -help\" for more information about a command.\n", c.path())
+	}
+}
+
+// printFlags writes the flags of fs, or the global flags if fs is nil, to w in
+// the format of flag.PrintDefaults.
+func printFlags(w io.Writer, fs *flag.FlagSet) {
+	printFlag := func(f *flag.Flag) {
+		fmt.Fprintf(w, "  -%s=%s: %s\n", f.Name, f.DefValue, f.Usage)
+	}
+	if fs == nil {
+		flag.VisitAll(printFlag)
+	} else {
+		fs.VisitAll(printFlag)
+	}
+}
@@ -0,0 +1,199 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"os"
+	"strings"
+	"testing"
+)
+
+func run(args []string) os.Error { return nil }
+
+func testTree() *command {
+	searchFlags := flag.NewFlagSet("people search", flag.ContinueOnError)
+	searchFlags.Int64("maxResults", 10, "")
+	tree := &command{
+		Name: "cli",
+		Subcommands: []*command{
+			&command{
+				Name: "people",
+				Subcommands: []*command{
+					&command{Name: "me", Run: run},
+					&command{Name: "search", Args: []arg{arg{"QUERY", false}}, Flags: searchFlags, Run: run},
+				},
+			},
+			&command{
+				Name: "profiles",
+				Subcommands: []*command{
+					&command{Name: "add", Args: []arg{arg{"NAME", false}, arg{"CONFIGPATH", false}, arg{"TOKENPATH", true}}, Run: run},
+					&command{Name: "setDefault", Args: []arg{arg{"NAME", false}}, Run: run},
+				},
+			},
+		},
+	}
+	tree.setParents()
+	return tree
+}
+
+type FindTest struct {
+	args     string
+	expected string // The path of the command found, or the error.
+	rest     string
+}
+
+var FindTests = []FindTest{
+	FindTest{"people search Larry", "cli people search", "Larry"},
+	FindTest{"people search -maxResults=5 Larry", "cli people search", "-maxResults=5 Larry"},
+	FindTest{"people", "cli people", ""},
+	FindTest{"people -help", "cli people", "-help"},
+	FindTest{"", "cli", ""},
+	FindTest{"people serch Larry", `Unknown command "cli people serch". Did you mean "cli people search"? ` +
+		`Run "cli people -help" for a list of commands.`, ""},
+	FindTest{"profiles setdefault test", `Unknown command "cli profiles setdefault". Did you mean "cli profiles setDefault"? ` +
+		`Run "cli profiles -help" for a list of commands.`, ""},
+	FindTest{"pro list", `Unknown command "cli pro". Did you mean "cli profiles"? ` +
+		`Run "cli -help" for a list of commands.`, ""},
+	FindTest{"activities get", `Unknown command "cli activities". Run "cli -help" for a list of commands.`, ""},
+}
+
+func TestFind(t *testing.T) {
+	tree := testTree()
+	for _, test := range FindTests {
+		c, rest, err := tree.find(strings.Fields(test.args))
+		got := ""
+		if err != nil {
+			got = err.String()
+		} else {
+			got = c.path()
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.args, test.expected, got)
+		}
+		if r := strings.Join(rest, " "); r != test.rest {
+			t.Errorf("%q: expected the arguments %q to be left, got %q", test.args, test.rest, r)
+		}
+	}
+}
+
+type ParseTest struct {
+	args     string
+	expected string // The arguments left, or the error.
+}
+
+var ParseTests = []ParseTest{
+	ParseTest{"people search Larry", "Larry"},
+	ParseTest{"people search -maxResults=5 Larry", "Larry"},
+	ParseTest{"people search", "Missing QUERY."},
+	ParseTest{"people search Larry Page", `Unexpected argument "Page".`},
+	ParseTest{"people me", ""},
+	ParseTest{"profiles add test", "Missing CONFIGPATH."},
+	ParseTest{"profiles add test config.json", "test config.json"},
+	ParseTest{"profiles add test config.json token.json", "test config.json token.json"},
+}
+
+func TestParse(t *testing.T) {
+	// Parse errors are reported on stderr along with the help.
+	stderr := os.Stderr
+	os.Stderr, _ = os.Open(os.DevNull)
+	defer func() { os.Stderr = stderr }()
+
+	for _, test := range ParseTests {
+		c, args, err := testTree().find(strings.Fields(test.args))
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, err = c.parse(args)
+		got := strings.Join(args, " ")
+		if err != nil {
+			got = err.String()
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.args, test.expected, got)
+		}
+	}
+}
+
+func TestUsage(t *testing.T) {
+	tree := testTree()
+	expected := map[string]string{
+		"":              "cli [global flags] COMMAND [arguments]",
+		"people":        "cli [global flags] people COMMAND [arguments]",
+		"people search": "cli [global flags] people search [flags] QUERY",
+		"profiles add":  "cli [global flags] profiles add NAME CONFIGPATH [TOKENPATH]",
+		"people me":     "cli [global flags] people me",
+	}
+	for args, usage := range expected {
+		c, _, err := tree.find(strings.Fields(args))
+		if err != nil {
+			t.Error(err)
+			continue
+		}
+		if got := c.usage(); got != usage {
+			t.Errorf("%q: expected usage %q, got %q", args, usage, got)
+		}
+	}
+}
+
+type DistanceTest struct {
+	a, b     string
+	expected int
+}
+
+var DistanceTests = []DistanceTest{
+	DistanceTest{"search", "search", 0},
+	DistanceTest{"serch", "search", 1},
+	DistanceTest{"saerch", "search", 2},
+	DistanceTest{"", "me", 2},
+	DistanceTest{"get", "list", 3},
+}
+
+func TestDistance(t *testing.T) {
+	for _, test := range DistanceTests {
+		if got := distance(test.a, test.b); got != test.expected {
+			t.Errorf("distance(%q, %q): expected %d, got %d", test.a, test.b, test.expected, got)
+		}
+	}
+}
+
+func TestExecute(t *testing.T) {
+	// The service follows the Auth of the running command, and commands which
+	// don't load the API config get none.
+	var err os.Error
+	c := &command{Name: "list", Auth: noConfig, Run: func([]string) os.Error {
+		_, err = plusService()
+		return nil
+	}}
+	if err := c.execute(nil); err != nil {
+		t.Fatal(err)
+	}
+	if err == nil {
+		t.Error("expected an error for a command without the API config")
+	}
+	if running != nil {
+		t.Errorf("expected no running command after execute, got %q", running.path())
+	}
+}
+
+func TestPeopleSearchMaxResults(t *testing.T) {
+	defer func(n int64) { *maxResults = n }(*maxResults)
+	for _, n := range []int64{0, 21} {
+		*maxResults = n
+		if _, ok := PeopleSearch([]string{"Larry"}).(usageError); !ok {
+			t.Errorf("%d: expected a usage error", n)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"template"
+
+	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
+)
+
+// Flags are parsed in main.go. They override the config file and the
+// environment variables.
+var configFlags = map[string]*string{
+	"APIKey":       flag.String("apiKey", "", "The API key. Overrides the config file and $PLUS_API_KEY."),
+	"ClientId":     flag.String("clientId", "", "The OAuth client ID. Overrides the config file and $PLUS_CLIENT_ID."),
+	"ClientSecret": flag.String("clientSecret", "", "The OAuth client secret. Overrides the config file and $PLUS_CLIENT_SECRET."),
+	"Scope":        flag.String("scope", "", "The OAuth scopes, separated by spaces. Overrides the config file and $PLUS_SCOPE."),
+	"BaseURL":      flag.String("baseURL", "", "The base URL of the Google+ API. Overrides the config file and $PLUS_BASE_URL."),
+}
+
+// setConfigOverrides passes the config flags to the api package.
+func setConfigOverrides() {
+	for name, value := range configFlags {
+		api.ConfigOverrides[name] = *value
+	}
+}
+
+// The config commands create and inspect the config. They don't run with
+// "all".
+var configCommand = &command{
+	Name:        "config",
+	Description: "Create and inspect the config file.",
+	Subcommands: []*command{
+		&command{
+			Name:        "init",
+			Description: "Prompt for the API key and the OAuth client, and write a new config file.",
+			Args:        []arg{arg{"PATH", false}},
+			Auth:        noConfig,
+			Run:         ConfigInit,
+		},
+		&command{
+			Name:        "show",
+			Description: "Display the effective config, with secrets masked, and its problems.",
+			Auth:        anyConfig,
+			Run:         ConfigShow,
+		},
+	},
+}
+
+// ConfigInit prompts for the API key and the OAuth client, checks them, and
+// writes them to a new config file at the given path. It runs before the
+// config is loaded.
+func ConfigInit(args []string) os.Error {
+	path := args[0]
+	setConfigOverrides()
+	if err := api.InitConfig(path, os.Stdin, os.Stdout); err != nil {
+		return err
+	}
+	fmt.Printf("Wrote %s. Save it as a profile with \"%s profiles add NAME %s\"\n",
+		path, root.Name, path)
+	return nil
+}
+
+// ConfigShow displays the effective config, after the environment variables
+// and flags are applied, with secrets masked. The config is loaded even if it
+// is invalid, and the problems are shown next to the values.
+func ConfigShow(args []string) os.Error {
+	return display(api.EffectiveConfig(), configShowView)
+}
+
+var configShowView = &render.View{
+	Template: template.Must(template.New("config.show").Parse(`
+{{range .}}{{if .Name}}{{.Name}}: {{if .Value}}{{.Value}}{{else}}(not set){{end}}{{if .Source}} [{{.Source}}]{{end}}{{if .Problem}}  <- {{.Problem}}{{end}}{{else}}Problem: {{.Problem}}{{end}}
+{{end}}
+`)),
+	Columns: []string{"Name", "Value", "Source", "Problem"},
+}
@@ -18,83 +18,284 @@ import (
 	"flag"
 	"fmt"
 	"os"
-	"sort"
 	"strings"
+	"time"
 
+	"google-api-go-client.googlecode.com/hg/plus/v1"
 	"google-plus-go-starter.googlecode.com/hg/cli/api"
 )
 
-type actionFunc func() os.Error
+// root is the command tree. Users run a command by naming it and its parents,
+// e.g. "cli people search Larry". It's built in init, since the "all" command
+// walks it.
+var root *command
 
-// actions maps command-line names to functions that demonstrate the use of the
-// Google+ API. Users can specify which action(s) to run with the "action" flag.
-var actions = map[string]actionFunc{
-	"activities.get": ActivitiesGet,
-	"people.search":  PeopleSearch,
-	"plus.me":        PlusMe,
+func init() {
+	root = &command{
+		Name: "cli",
+		Description: "Demonstrates the use of the Google+ API. The API commands load the config file\n" +
+			"from the configPath flag, or else from a profile.",
+		Subcommands: []*command{
+			allCommand,
+			&command{
+				Name:        "activities",
+				Description: "Get public activities.",
+				Subcommands: []*command{activitiesGetCommand},
+			},
+			authCommand,
+			configCommand,
+			&command{
+				Name:        "people",
+				Description: "Get and search for people.",
+				Subcommands: []*command{peopleMeCommand, peopleSearchCommand},
+			},
+			profilesCommand,
+		},
+	}
+	root.setParents()
+}
+
+var allCommand = &command{
+	Name:        "all",
+	Description: "Run every API command with sample arguments.",
+	Auth:        oauth,
+	Run:         All,
+}
+
+// All runs the commands which have Demo arguments, after printing their names.
+// It declares all their scopes first, so that the user authorizes them at once.
+func All(args []string) os.Error {
+	requireAllScopes()
+	var demos []*command
+	root.walk(func(c *command) {
+		if c.Demo != nil {
+			demos = append(demos, c)
+		}
+	})
+	for _, c := range demos {
+		name := c.path()[len(root.Name)+1:]
+		progressf("%s\n%s\n", name, strings.Repeat("-", len(name)))
+		args, err := c.parse(c.Demo)
+		if err != nil {
+			return err
+		}
+		if err := c.execute(args); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// requireAllScopes declares the OAuth scopes of all commands.
+func requireAllScopes() {
+	root.walk(func(c *command) {
+		api.RequireScopes(c.Scopes...)
+	})
 }
 
-var action *string = flag.String("action", "all",
-	"The action(s) to execute. One of: all, "+strings.Join(keys(actions), ", "))
+var action *string = flag.String("action", "",
+	"Replaced by commands, e.g. \"cli people search QUERY\" instead of -action=people.search.")
 var configPath *string = flag.String("configPath", "",
-	"The path to the file containing API access information.")
+	"The path to the file containing API access information. Defaults to the profile's.")
 var tokenPath *string = flag.String("tokenPath", "",
-	"The path to the file where OAuth tokens will be read and written. Optional.")
+	"The path to the file where OAuth tokens will be read and written. Optional; defaults to the profile's.")
+var oauthFlow *string = flag.String("oauthFlow", api.LoopbackFlow,
+	"The OAuth flow to use. One of: "+api.LoopbackFlow+" (redirect the browser to a local listener), "+api.ManualFlow+" (paste the authorization code), "+api.DeviceFlow+" (enter a code on another device).")
+var encryptTokens *bool = flag.Bool("encryptTokens", false,
+	"Encrypt the file at tokenPath with a passphrase, read from the "+api.TokenPassphraseEnv+" environment variable or the terminal.")
+var serviceAccountKey *string = flag.String("serviceAccountKey", "",
+	"The path to the JSON key file of a service account, to authenticate as it instead of as a user, e.g. in unattended jobs. Optional.")
+var keyStats *bool = flag.Bool("keyStats", false,
+	"Print per-key usage counters when the config file lists APIKeys.")
+var cacheStats *bool = flag.Bool("cacheStats", false,
+	"Print response cache hit and miss counters when the config file enables the Cache.")
+var record *string = flag.String("record", "",
+	"The path to a cassette file where all API requests and responses will be recorded, with secrets redacted. Optional.")
+var replay *string = flag.String("replay", "",
+	"The path to a cassette file (written with -record) from which API responses will be replayed, without network access. Optional.")
 
 func main() {
+	flag.Usage = func() { root.help(os.Stderr) }
 	flag.Parse()
+	if len(*action) > 0 {
+		hint := root.Name + " -help"
+		if c, _, err := root.find(strings.Split(*action, ".")); err == nil && c.Run != nil {
+			hint = c.usage()
+		}
+		fmt.Fprintf(os.Stderr, "The action flag was replaced by commands: run %q instead.\n", hint)
+		os.Exit(2)
+	}
 
-	if len(*configPath) == 0 {
-		fmt.Fprintln(os.Stderr, "You must supply the configPath flag.")
-		os.Exit(1)
+	// Find the command and parse its flags and arguments.
+	cmd, args, err := root.find(flag.Args())
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	if cmd.Run == nil {
+		cmd.help(os.Stderr)
+		if len(args) > 0 && (args[0] == "-help" || args[0] == "-h") {
+			os.Exit(0)
+		}
+		os.Exit(2)
+	}
+	if args, err = cmd.parse(args); err == flag.ErrHelp {
+		os.Exit(0)
+	} else if err != nil {
+		os.Exit(2)
+	}
+	if err := setOutput(cmd); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
 
-	// Set up the API helper functions.
-	if err := api.Config(*configPath); err != nil {
-		fmt.Fprintln(os.Stderr, "Could not configure API: ", err)
+	// Manage profiles and create config files, without loading the config.
+	if cmd.Auth == noConfig {
+		if err := cmd.execute(args); err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitCode(cmd, err))
+		}
+		return
+	}
+
+	// Set up the API helper functions, from the configPath flag or else from
+	// a profile, overridden by the environment variables and flags. The config
+	// only needs the credentials of the command.
+	setConfigOverrides()
+	api.Access = access(cmd)
+	if len(*configPath) > 0 {
+		if len(*profile) > 0 {
+			fmt.Fprintln(os.Stderr, "The configPath and profile flags can't be used together.")
+			os.Exit(1)
+		}
+		if err := api.Config(*configPath); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not configure API: ", err)
+			os.Exit(1)
+		}
+	} else if err := api.UseProfile(*profile); err != nil {
+		fmt.Fprintln(os.Stderr, "You must supply the configPath flag or add a profile: ", err)
 		os.Exit(1)
 	}
-	api.TokenPath = *tokenPath
+	if len(*tokenPath) > 0 || len(*configPath) > 0 {
+		api.TokenPath = *tokenPath
+	}
+	api.OAuthFlow = *oauthFlow
+	api.EncryptTokens = *encryptTokens
+	api.ServiceAccountKeyPath = *serviceAccountKey
+
+	// Declare the OAuth scopes of the command to execute.
+	api.RequireScopes(cmd.Scopes...)
 
-	// Execute specified action(s).
-	if *action == "all" {
-		for _, name := range keys(actions) {
-			executeAction(name)
+	// Set up recording or replaying of API requests.
+	if len(*record) > 0 && len(*replay) > 0 {
+		fmt.Fprintln(os.Stderr, "The record and replay flags can't be used together.")
+		os.Exit(1)
+	}
+	if len(*replay) > 0 {
+		if err := api.Replay(*replay); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not load cassette: ", err)
+			os.Exit(1)
 		}
-	} else {
-		executeAction(*action)
 	}
+	if len(*record) > 0 {
+		api.Record()
+	}
+
+	// Execute the command.
+	if err := cmd.execute(args); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		exit(exitCode(cmd, err))
+	}
+
+	if *keyStats {
+		printKeyStats()
+	}
+	if *cacheStats {
+		fmt.Fprintln(os.Stderr, "Response cache:", api.CacheStats())
+	}
+	exit(0)
 }
 
-// executeAction prints the name of the action and executes it.
-// It will os.Exit with an error if the action does not exist or the action
-// encountered an error during execution.
-func executeAction(name string) {
-	fn, ok := actions[name]
-	if !ok {
-		fmt.Fprintln(os.Stderr, "Invalid action name: ", name)
-		os.Exit(1)
+// exitCode returns the exit code of the error err of cmd. Usage errors exit
+// with 2 like those of the flags, after the help of cmd.
+func exitCode(cmd *command, err os.Error) int {
+	if _, ok := err.(usageError); ok {
+		cmd.help(os.Stderr)
+		return 2
+	}
+	return 1
+}
+
+// access returns the api.Access of cmd: the credentials of its Auth, or those
+// of the service account if the serviceAccountKey flag is set.
+func access(cmd *command) string {
+	switch {
+	case cmd.Auth == anyConfig:
+		return api.InspectAccess
+	case cmd.Auth == apiKey:
+		return api.APIKeyAccess
+	case len(*serviceAccountKey) > 0:
+		return api.ServiceAccountAccess
 	}
+	return api.OAuthAccess
+}
 
-	// Print the action name.
-	fmt.Println(name)
-	fmt.Println(strings.Repeat("-", len(name)))
+// plusService returns the *plus.Service of the Auth of the running command:
+// simple API access for apiKey commands, and authPlus for oauth commands.
+func plusService() (*plus.Service, os.Error) {
+	if running == nil {
+		return nil, os.NewError("no command is running")
+	}
+	switch running.Auth {
+	case apiKey:
+		return api.NoAuthPlus()
+	case oauth:
+		return authPlus()
+	}
+	return nil, fmt.Errorf("%q doesn't load the API config", running.path())
+}
 
-	// Execute the action.
-	if err := fn(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+// authPlus returns a *plus.Service which provides authenticated access to the
+// Google+ API, as the service account if the serviceAccountKey flag is set and
+// as the user otherwise.
+func authPlus() (*plus.Service, os.Error) {
+	if len(*serviceAccountKey) > 0 {
+		return api.ServiceAccountPlus()
 	}
+	return api.OAuthPlus()
 }
 
-// keys returns a slice containing all keys in the map in increasing order.
-func keys(m map[string]actionFunc) []string {
-	keys := make([]string, len(m))
-	i := 0
-	for key, _ := range m {
-		keys[i] = key
-		i++
+// exit saves the recorded API requests, if the record flag is set, and exits
+// with the given status code.
+func exit(code int) {
+	if len(*record) > 0 {
+		if err := api.SaveRecording(*record); err != nil {
+			fmt.Fprintln(os.Stderr, "Could not save cassette: ", err)
+			code = 1
+		}
+	}
+	os.Exit(code)
+}
+
+// printKeyStats prints the usage counters of the API key pool. Keys are
+// truncated so that they don't end up in terminal logs.
+func printKeyStats() {
+	stats := api.KeyStats()
+	if stats == nil {
+		fmt.Fprintln(os.Stderr, "No APIKeys configured.")
+		return
+	}
+	fmt.Fprintln(os.Stderr, "API key usage:")
+	for _, s := range stats {
+		key := s.Key
+		if len(key) > 8 {
+			key = key[:8] + "..."
+		}
+		benched := ""
+		if s.BenchedUntil > 0 {
+			benched = " (benched until " + time.SecondsToLocalTime(s.BenchedUntil).Format(time.Kitchen) + ")"
+		}
+		fmt.Fprintf(os.Stderr, "  %s: %d requests, %d errors, %d quota errors%s\n",
+			key, s.Requests, s.Errors, s.QuotaErrors, benched)
 	}
-	sort.Strings(keys)
-	return keys
 }
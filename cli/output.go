@@ -0,0 +1,128 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"template"
+
+	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
+	"google-plus-go-starter.googlecode.com/hg/fields"
+)
+
+// Flags are parsed in main.go.
+var format *string = flag.String("format", "text",
+	"The output format. One of: "+strings.Join(render.Formats, ", ")+". Text uses the templates of the commands.")
+var columns *string = flag.String("columns", "",
+	"The columns of the csv, tsv and table formats, separated by commas, e.g. id,actor/displayName. Defaults to the command's.")
+var templateFlag *string = flag.String("template", "",
+	"A template replacing the text format of the command, or @ followed by the path of a file holding it. "+
+		"Templates can also be saved in the templates directory of the profiles, e.g. as people.search.tmpl.")
+var fieldsFlag *string = flag.String("fields", "",
+	"Request and display only these fields of the API results, e.g. items(id,actor/displayName),nextPageToken. "+
+		"Paths name nested fields with slashes, and parentheses select several fields of one.")
+
+// output displays the results of the commands, as selected by the format,
+// columns, template and fields flags.
+var output = &render.Renderer{}
+
+// setOutput configures output from the flags, and with the templates saved in
+// the templates directory of the profiles. The fields flag is checked against
+// the Resource of the View of cmd, and also sets the fields requested from the
+// API.
+func setOutput(cmd *command) os.Error {
+	output.Format = *format
+	output.Columns = nil
+	if len(*columns) > 0 {
+		output.Columns = strings.Split(*columns, ",")
+	}
+	output.Template = nil
+	if len(*templateFlag) > 0 {
+		t, err := parseTemplateFlag(*templateFlag)
+		if err != nil {
+			return err
+		}
+		output.Template = t
+	}
+	if dir, err := api.ConfigDir(); err == nil {
+		output.TemplateDir = filepath.Join(dir, "templates")
+	}
+	output.Fields = nil
+	if len(*fieldsFlag) > 0 {
+		if cmd.View == nil || cmd.View.Resource == nil {
+			return fmt.Errorf("The fields flag can't be used with %q.", cmd.path())
+		}
+		s, err := fields.Parse(*fieldsFlag)
+		if err != nil {
+			return err
+		}
+		if err := s.Check(reflect.TypeOf(cmd.View.Resource)); err != nil {
+			return err
+		}
+		if within := cmd.View.Within; len(within) > 0 {
+			if _, ok := s.Sub(within); !ok {
+				return fmt.Errorf("The fields flag must select %s, which %q displays, e.g. %s(id).", within, cmd.path(), within)
+			}
+		}
+		output.Fields = s
+		api.Fields = *fieldsFlag
+	}
+	return output.Check()
+}
+
+// parseTemplateFlag parses the template given inline, with a newline added at
+// its end, or the template in the file named after "@".
+func parseTemplateFlag(value string) (*template.Template, os.Error) {
+	if strings.HasPrefix(value, "@") {
+		path := value[1:]
+		text, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		t, err := render.Parse(filepath.Base(path), string(text))
+		if err != nil {
+			return nil, fmt.Errorf("Couldn't parse template %s: %s", path, err)
+		}
+		return t, nil
+	}
+	if !strings.HasSuffix(value, "\n") {
+		value += "\n"
+	}
+	t, err := render.Parse("template", value)
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse the template flag: %s", err)
+	}
+	return t, nil
+}
+
+// display writes the result of a command to stdout.
+func display(v interface{}, view *render.View) os.Error {
+	return output.Render(os.Stdout, v, view)
+}
+
+// progressf prints a progress message, in the text format only and unless the
+// template flag is set, so that the output can be parsed by scripts.
+func progressf(format string, args ...interface{}) {
+	if output.Text() && output.Template == nil {
+		fmt.Printf(format, args...)
+	}
+}
@@ -20,39 +20,61 @@ import (
 	"os"
 	"template"
 
-	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
 )
 
-// Flags are parsed in main.go.
-var searchQuery *string = flag.String("searchQuery", "Larry",
-	"The query used in the people.search action.")
+var peopleSearchFlags = flag.NewFlagSet("people search", flag.ContinueOnError)
+var maxResults *int64 = peopleSearchFlags.Int64("maxResults", 10,
+	"The maximum number of people to display, between 1 and 20.")
+
+var peopleSearchCommand = &command{
+	Name:        "search",
+	Description: "Search for people by name.",
+	Args:        []arg{arg{"QUERY", false}},
+	Auth:        apiKey,
+	Flags:       peopleSearchFlags,
+	Run:         PeopleSearch,
+	View:        peopleSearchView,
+	Demo:        []string{"Larry"},
+}
 
 // PeopleSearch fetches and displays a list of public Google+ profiles using
 // unauthenticated (simple) API access.
-func PeopleSearch() os.Error {
+func PeopleSearch(args []string) os.Error {
+	searchQuery := args[0]
+	if *maxResults < 1 || *maxResults > 20 {
+		return usageError(fmt.Sprintf("maxResults must be between 1 and 20, not %d.", *maxResults))
+	}
+
 	// Get the *plus.Service.
 	// Searching for people (or activities) doesn't require OAuth.
-	p, err := api.NoAuthPlus()
+	p, err := plusService()
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Searching for people matching %q...", *searchQuery)
+	progressf("Searching for people matching %q...", searchQuery)
 
 	// Find people matching the query.
-	people, err := p.People.Search(*searchQuery).Do()
+	people, err := p.People.Search(searchQuery).MaxResults(*maxResults).Do()
 	if err != nil {
 		return err
 	}
 
 	// Display the search results.
-	return peopleSearchTemplate.Execute(os.Stdout, people.Items)
+	return display(people.Items, peopleSearchView)
 }
 
-var peopleSearchTemplate = template.Must(template.New("people.search").Parse(`
+var peopleSearchView = &render.View{
+	Template: template.Must(template.New("people.search").Parse(`
 {{range .}}
 - Name: {{.DisplayName}}
   Profile: {{.Url}}
 {{end}}
 
-`))
+`)),
+	Columns:  []string{"id", "displayName", "url"},
+	Resource: &plus.PeopleFeed{},
+	Within:   "items",
+}
@@ -15,24 +15,35 @@
 package main
 
 import (
-	"fmt"
 	"os"
 	"template"
 
+	"google-api-go-client.googlecode.com/hg/plus/v1"
 	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
 )
 
+var peopleMeCommand = &command{
+	Name:        "me",
+	Description: "Display the profile of the authenticated user.",
+	Auth:        oauth,
+	Scopes:      []string{api.PlusMeScope},
+	Run:         PlusMe,
+	View:        plusMeView,
+	Demo:        []string{},
+}
+
 // PlusMe fetches and displays the user's public Google+ profile using
 // authenticated (OAuth) API access.
-func PlusMe() os.Error {
+func PlusMe(args []string) os.Error {
 	// Get the *plus.Service.
 	// Associating a user with their Google+ profile requires OAuth.
-	p, err := api.OAuthPlus()
+	p, err := plusService()
 	if err != nil {
 		return err
 	}
 
-	fmt.Println("Getting the authenticated user's profile...")
+	progressf("Getting the authenticated user's profile...\n")
 
 	// Get the user's profile.
 	// "me" is a special value that refers to the authenticated user.
@@ -42,12 +53,16 @@ func PlusMe() os.Error {
 	}
 
 	// Display the user's profile.
-	return plusMeTemplate.Execute(os.Stdout, me)
+	return display(me, plusMeView)
 }
 
-var plusMeTemplate = template.Must(template.New("plus.me").Parse(`
+var plusMeView = &render.View{
+	Template: template.Must(template.New("people.me").Parse(`
 Name: {{.DisplayName}}
 Profile: {{.Url}}
 About: {{.AboutMe}}
 
-`))
+`)),
+	Columns:  []string{"id", "displayName", "url", "aboutMe"},
+	Resource: &plus.Person{},
+}
@@ -0,0 +1,126 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"template"
+
+	"google-plus-go-starter.googlecode.com/hg/cli/api"
+	"google-plus-go-starter.googlecode.com/hg/cli/render"
+)
+
+// Flags are parsed in main.go.
+var profile *string = flag.String("profile", "",
+	"The profile to use. Commands use the default profile when neither profile nor configPath is supplied.")
+
+// The profiles commands manage the profiles stored in the CLI's config
+// directory. They don't access the Google+ API, and they don't run with "all".
+var profilesCommand = &command{
+	Name:        "profiles",
+	Description: "Manage the saved config files and tokens.",
+	Subcommands: []*command{
+		&command{
+			Name:        "add",
+			Description: "Add a profile with a copy of the config file and, if supplied, of the token file.",
+			Args:        []arg{arg{"NAME", false}, arg{"CONFIGPATH", false}, arg{"TOKENPATH", true}},
+			Run:         ProfilesAdd,
+		},
+		&command{
+			Name:        "list",
+			Description: "List the profiles, marking the default one.",
+			Run:         ProfilesList,
+		},
+		&command{
+			Name:        "remove",
+			Description: "Remove a profile.",
+			Args:        []arg{arg{"NAME", false}},
+			Run:         ProfilesRemove,
+		},
+		&command{
+			Name:        "setDefault",
+			Description: "Make a profile the default one.",
+			Args:        []arg{arg{"NAME", false}},
+			Run:         ProfilesSetDefault,
+		},
+	},
+}
+
+// ProfilesList lists the profiles, marking the default one.
+func ProfilesList(args []string) os.Error {
+	names, err := api.Profiles()
+	if err != nil {
+		return err
+	}
+	def, err := api.DefaultProfile()
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 && output.Text() {
+		fmt.Printf("No profiles. Add one with \"%s profiles add NAME CONFIGPATH\".\n", root.Name)
+		return nil
+	}
+	profiles := make([]profileEntry, len(names))
+	for i, name := range names {
+		profiles[i] = profileEntry{name, name == def}
+	}
+	return display(profiles, profilesListView)
+}
+
+type profileEntry struct {
+	Name    string
+	Default bool
+}
+
+var profilesListView = &render.View{
+	Template: template.Must(template.New("profiles.list").Parse(
+		`{{range .}}{{if .Default}}*{{else}} {{end}} {{.Name}}
+{{end}}`)),
+	Columns: []string{"Name", "Default"},
+}
+
+// ProfilesAdd adds the named profile, with a copy of the config file and, if
+// supplied, of the token file.
+func ProfilesAdd(args []string) os.Error {
+	name, configPath, tokenPath := args[0], args[1], ""
+	if len(args) > 2 {
+		tokenPath = args[2]
+	}
+	if err := api.AddProfile(name, configPath, tokenPath); err != nil {
+		return err
+	}
+	fmt.Printf("Added profile %q.\n", name)
+	return nil
+}
+
+// ProfilesRemove removes the named profile.
+func ProfilesRemove(args []string) os.Error {
+	if err := api.RemoveProfile(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("Removed profile %q.\n", args[0])
+	return nil
+}
+
+// ProfilesSetDefault makes the named profile the default one.
+func ProfilesSetDefault(args []string) os.Error {
+	if err := api.SetDefaultProfile(args[0]); err != nil {
+		return err
+	}
+	fmt.Printf("The default profile is now %q.\n", args[0])
+	return nil
+}
@@ -0,0 +1,129 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"fmt"
+	"json"
+	"os"
+	"reflect"
+	"regexp"
+	"strings"
+	"template"
+	"time"
+)
+
+// Funcs are the helper functions available in the templates parsed by Parse.
+// Their last argument is the piped value, e.g.
+// 	{{.Published | date "Jan 2, 2006"}}
+// 	{{.Object.Content | stripHTML | truncate 80}}
+// 	{{.Scopes | join ", "}}
+// 	{{json .}}
+var Funcs = template.FuncMap{
+	"date":      date,
+	"stripHTML": stripHTML,
+	"truncate":  truncate,
+	"json":      toJSON,
+	"join":      join,
+}
+
+// Parse parses a template with the given name, with Funcs available.
+func Parse(name, text string) (*template.Template, os.Error) {
+	return template.New(name).Funcs(Funcs).Parse(text)
+}
+
+// dateLayouts are the layouts of the timestamps of the API, which have
+// milliseconds.
+var dateLayouts = []string{"2006-01-02T15:04:05.000Z07:00", time.RFC3339}
+
+// date formats an RFC 3339 timestamp, as used by the API, with the layout of
+// the time package. Other values are returned unchanged.
+func date(layout, value string) string {
+	for _, l := range dateLayouts {
+		if t, err := time.Parse(l, value); err == nil {
+			return t.Format(layout)
+		}
+	}
+	return value
+}
+
+var (
+	htmlBreak = regexp.MustCompile(`<[bB][rR] */?>|</[pP]>`)
+	htmlTag   = regexp.MustCompile(`<[^>]*>`)
+)
+
+// htmlEntities are the entities found in the content of activities, in the
+// order they must be replaced.
+var htmlEntities = []string{
+	"&lt;", "<",
+	"&gt;", ">",
+	"&quot;", `"`,
+	"&#39;", "'",
+	"&nbsp;", " ",
+	"&amp;", "&",
+}
+
+// stripHTML turns HTML content into plain text: line breaks and paragraph ends
+// become newlines, other tags are removed and common entities are unescaped.
+func stripHTML(s string) string {
+	s = htmlBreak.ReplaceAllString(s, "\n")
+	s = htmlTag.ReplaceAllString(s, "")
+	for i := 0; i < len(htmlEntities); i += 2 {
+		s = strings.Replace(s, htmlEntities[i], htmlEntities[i+1], -1)
+	}
+	return s
+}
+
+// truncate shortens s to n characters, ending with "..." if it was cut.
+func truncate(n int, s string) string {
+	const ellipsis = "..."
+	keep, cut, chars := n-len(ellipsis), 0, 0
+	for i, _ := range s {
+		if chars == keep {
+			cut = i
+		}
+		if chars == n {
+			if keep <= 0 {
+				return s[:i]
+			}
+			return s[:cut] + ellipsis
+		}
+		chars++
+	}
+	return s
+}
+
+// toJSON encodes v as compact JSON.
+func toJSON(v interface{}) (string, os.Error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// join joins the elements of a slice or array, formatted like fmt.Sprint,
+// with sep.
+func join(sep string, list interface{}) (string, os.Error) {
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return "", fmt.Errorf("join: can't join a %s", v.Kind())
+	}
+	elems := make([]string, v.Len())
+	for i := range elems {
+		elems[i] = fmt.Sprint(v.Index(i).Interface())
+	}
+	return strings.Join(elems, sep), nil
+}
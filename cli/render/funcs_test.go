@@ -0,0 +1,74 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"testing"
+)
+
+type FuncsTest struct {
+	template string
+	expected string
+}
+
+var FuncsTests = []FuncsTest{
+	FuncsTest{`{{.Published | date "Jan 2, 2006"}}`, "Oct 18, 2011"},
+	FuncsTest{`{{date "2006-01-02 15:04" .Published}}`, "2011-10-18 09:30"},
+	FuncsTest{`{{.Title | date "2006"}}`, "Fish &amp; <b>chips</b>"},
+	FuncsTest{`{{.Content | stripHTML}}`, "Fish & chips\n\"Hot\"\nnow"},
+	FuncsTest{`{{.Content | stripHTML | truncate 10}}`, "Fish & ..."},
+	FuncsTest{`{{.Title | truncate 40}}`, "Fish &amp; <b>chips</b>"},
+	FuncsTest{`{{truncate 3 "Crème brûlée"}}`, "Crè"},
+	FuncsTest{`{{truncate 8 "Crème brûlée"}}`, "Crème..."},
+	FuncsTest{`{{.Tags | join ", "}}`, "go, plus"},
+	FuncsTest{`{{json .Tags}}`, `["go","plus"]`},
+}
+
+var funcsData = map[string]interface{}{
+	"Published": "2011-10-18T09:30:00.000Z",
+	"Title":     "Fish &amp; <b>chips</b>",
+	"Content":   "Fish &amp; chips<br />&quot;Hot&quot;<BR>now",
+	"Tags":      []string{"go", "plus"},
+}
+
+func TestFuncs(t *testing.T) {
+	for _, test := range FuncsTests {
+		tmpl, err := Parse("test", test.template)
+		if err != nil {
+			t.Errorf("%s: %s", test.template, err)
+			continue
+		}
+		var b bytes.Buffer
+		if err := tmpl.Execute(&b, funcsData); err != nil {
+			t.Errorf("%s: %s", test.template, err)
+			continue
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.template, test.expected, got)
+		}
+	}
+}
+
+func TestJoinError(t *testing.T) {
+	tmpl, err := Parse("test", `{{.Title | join ", "}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var b bytes.Buffer
+	if err := tmpl.Execute(&b, funcsData); err == nil {
+		t.Errorf("expected an error joining a string, got %q", b.String())
+	}
+}
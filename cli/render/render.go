@@ -0,0 +1,530 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The render package displays the results of the command-line actions in the
+// format chosen by the user: the text templates of the actions, or one of the
+// machine-readable formats.
+//
+// Example usage:
+// 	r := &render.Renderer{Format: "csv", Columns: []string{"displayName", "url"}}
+// 	if err := r.Check(); err != nil {
+// 		...
+// 	}
+// 	err := r.Render(os.Stdout, people.Items, &render.View{Template: peopleTemplate})
+//
+// The machine-readable formats use the JSON names of the fields, and columns
+// name nested fields with slashes, e.g. "actor/displayName".
+package render
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"tabwriter"
+	"template"
+
+	"google-plus-go-starter.googlecode.com/hg/fields"
+)
+
+// Formats lists the supported output formats. Text is the default.
+var Formats = []string{"text", "json", "ndjson", "yaml", "csv", "tsv", "table"}
+
+// A View describes how an action displays its result.
+type View struct {
+	// Template displays the result in the "text" format.
+	Template *template.Template
+	// Columns are the default columns of the csv, tsv and table formats. If
+	// empty, all the top-level fields are displayed.
+	Columns []string
+	// Records is the path of the array holding the records of the ndjson,
+	// csv, tsv and table formats, e.g. "items" for feeds. If empty, the
+	// elements of a slice are the records, and any other value is a single
+	// record.
+	Records string
+	// Resource is a value of the type of the API response, e.g.
+	// &plus.PeopleFeed{}, against which the fields selected by users are
+	// checked. If nil, fields can't be selected.
+	Resource interface{}
+	// Within is the path of the results in the Resource, e.g. "items" for
+	// actions which display the items of a feed. The fields selected under it
+	// apply to the results. If empty, the results are the Resource.
+	Within string
+}
+
+// A Renderer writes results in a format.
+type Renderer struct {
+	// Format is one of Formats. It will default to "text" if empty.
+	Format string
+	// Columns selects the columns of the csv, tsv and table formats,
+	// overriding those of the View.
+	Columns []string
+	// Template replaces the templates of all Views in the text format.
+	Template *template.Template
+	// TemplateDir is a directory of templates, parsed with Funcs, which
+	// replace the templates of the Views they're named after, e.g.
+	// "people.search.tmpl". Optional.
+	TemplateDir string
+	// Fields projects the results to the selected fields of the Resource of
+	// the View, in every format. The columns of the csv, tsv and table
+	// formats default to the selected fields of the records. Optional.
+	Fields fields.Selection
+}
+
+// Check returns an error if the Format is unknown, if Columns are selected
+// for a format without columns, or if a Template is set for a format other
+// than text.
+func (r *Renderer) Check() os.Error {
+	if r.Template != nil && !r.Text() {
+		return os.NewError("Templates can only be used with the text format.")
+	}
+	switch r.format() {
+	case "csv", "tsv", "table":
+		return nil
+	case "text", "json", "ndjson", "yaml":
+		if len(r.Columns) > 0 {
+			return os.NewError("Columns can only be selected for the csv, tsv and table formats.")
+		}
+		return nil
+	}
+	return fmt.Errorf("Unknown format %q. Use one of: %s", r.Format, strings.Join(Formats, ", "))
+}
+
+func (r *Renderer) format() string {
+	if len(r.Format) == 0 {
+		return "text"
+	}
+	return r.Format
+}
+
+// Text reports whether r displays results with the text templates, so that
+// actions can print progress messages meant for humans.
+func (r *Renderer) Text() bool {
+	return r.format() == "text"
+}
+
+// Render writes v to w, as described by view.
+func (r *Renderer) Render(w io.Writer, v interface{}, view *View) os.Error {
+	if err := r.Check(); err != nil {
+		return err
+	}
+	format := r.format()
+	selected := r.selection(view)
+	switch format {
+	case "text":
+		t, err := r.textTemplate(view)
+		if err != nil {
+			return err
+		}
+		if selected != nil {
+			if v, err = project(v, selected); err != nil {
+				return err
+			}
+		}
+		return t.Execute(w, v)
+	case "json":
+		if selected == nil {
+			return writeJSON(w, v)
+		}
+	}
+
+	// The other formats work on the generic form of v, as decoded from JSON.
+	generic, err := toGeneric(v)
+	if err != nil {
+		return err
+	}
+	generic = selected.Project(generic)
+	if format == "json" {
+		return writeJSON(w, generic)
+	}
+	if format == "yaml" {
+		var b bytes.Buffer
+		writeYAML(&b, generic, "")
+		_, err = w.Write(b.Bytes())
+		return err
+	}
+	var records []interface{}
+	if len(view.Records) > 0 {
+		records, _ = Lookup(generic, view.Records).([]interface{})
+	} else if slice, ok := generic.([]interface{}); ok {
+		records = slice
+	} else {
+		records = []interface{}{generic}
+	}
+	if format == "ndjson" {
+		for _, record := range records {
+			data, err := json.Marshal(record)
+			if err != nil {
+				return err
+			}
+			if _, err := fmt.Fprintf(w, "%s\n", data); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	columns := r.Columns
+	if len(columns) == 0 {
+		columns = selectedColumns(selected, view)
+	}
+	if len(columns) == 0 {
+		columns = view.Columns
+	}
+	if len(columns) == 0 {
+		columns = fieldNames(records)
+	}
+	rows := [][]string{columns}
+	for _, record := range records {
+		row := make([]string, len(columns))
+		for i, column := range columns {
+			row[i] = cell(Lookup(record, column))
+		}
+		rows = append(rows, row)
+	}
+	switch format {
+	case "csv":
+		return writeRows(w, rows, ",", csvQuote)
+	case "tsv":
+		return writeRows(w, rows, "\t", tsvEscape)
+	}
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	if err := writeRows(tw, rows, "\t", tableCell); err != nil {
+		return err
+	}
+	return tw.Flush()
+}
+
+// selection returns the Fields selected in the results of view, or nil if
+// they are all selected.
+func (r *Renderer) selection(view *View) fields.Selection {
+	if r.Fields == nil || len(view.Within) == 0 {
+		return r.Fields
+	}
+	sub, ok := r.Fields.Sub(view.Within)
+	if !ok {
+		// None of the results are selected.
+		return fields.Selection{}
+	}
+	return sub
+}
+
+// selectedColumns returns the paths of the fields of selected in the records
+// of view, or nil if they are all selected or if any "*" is.
+func selectedColumns(selected fields.Selection, view *View) []string {
+	sub := selected
+	if len(view.Records) > 0 {
+		sub, _ = selected.Sub(view.Records)
+	}
+	paths := sub.Paths()
+	for _, p := range paths {
+		if p == "*" || strings.HasSuffix(p, "/*") {
+			return nil
+		}
+	}
+	return paths
+}
+
+// writeJSON writes v as indented JSON, followed by a newline.
+func writeJSON(w io.Writer, v interface{}) os.Error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "%s\n", data)
+	return err
+}
+
+// textTemplate returns the template displaying view in the text format: the
+// Template of r, or else the one named after view in TemplateDir, or else the
+// Template of view.
+func (r *Renderer) textTemplate(view *View) (*template.Template, os.Error) {
+	if r.Template != nil {
+		return r.Template, nil
+	}
+	if len(r.TemplateDir) == 0 {
+		return view.Template, nil
+	}
+	path := filepath.Join(r.TemplateDir, view.Template.Name()+".tmpl")
+	text, err := ioutil.ReadFile(path)
+	if pe, ok := err.(*os.PathError); ok && pe.Error == os.ENOENT {
+		return view.Template, nil
+	} else if err != nil {
+		return nil, err
+	}
+	t, err := Parse(view.Template.Name(), string(text))
+	if err != nil {
+		return nil, fmt.Errorf("Couldn't parse template %s: %s", path, err)
+	}
+	return t, nil
+}
+
+// project returns a copy of v, of the same type, with only the selected
+// fields, so that templates see the others as empty.
+func project(v interface{}, selected fields.Selection) (interface{}, os.Error) {
+	if v == nil {
+		return nil, nil
+	}
+	generic, err := toGeneric(v)
+	if err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(selected.Project(generic))
+	if err != nil {
+		return nil, err
+	}
+	p := reflect.New(reflect.TypeOf(v))
+	if err := json.Unmarshal(data, p.Interface()); err != nil {
+		return nil, err
+	}
+	return p.Elem().Interface(), nil
+}
+
+// toGeneric converts v to the maps, slices, strings, float64s, bools and nils
+// of its JSON form.
+func toGeneric(v interface{}) (interface{}, os.Error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// fieldNames returns the sorted names of the fields of the records.
+func fieldNames(records []interface{}) []string {
+	seen := make(map[string]bool)
+	var names []string
+	for _, record := range records {
+		m, ok := record.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		for name, _ := range m {
+			if !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Lookup returns the field of the generic value v named by path, e.g.
+// "actor/displayName", or nil if there is none. Paths go through arrays: the
+// result is then the array of the fields of their elements.
+func Lookup(v interface{}, path string) interface{} {
+	names := strings.Split(path, "/")
+	for i, name := range names {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			v = t[name]
+		case []interface{}:
+			rest := strings.Join(names[i:], "/")
+			values := make([]interface{}, len(t))
+			for j, e := range t {
+				values[j] = Lookup(e, rest)
+			}
+			return values
+		default:
+			return nil
+		}
+	}
+	return v
+}
+
+// cell formats a generic value for a column. Arrays of scalars are joined
+// with commas, and objects are written as JSON.
+func cell(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return t
+	case []interface{}:
+		cells := make([]string, 0, len(t))
+		for _, e := range t {
+			if _, ok := e.(map[string]interface{}); ok {
+				return compactJSON(v)
+			}
+			if c := cell(e); len(c) > 0 {
+				cells = append(cells, c)
+			}
+		}
+		return strings.Join(cells, ", ")
+	case map[string]interface{}:
+		return compactJSON(v)
+	}
+	return fmt.Sprint(v)
+}
+
+func compactJSON(v interface{}) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+func writeRows(w io.Writer, rows [][]string, sep string, escape func(string) string) os.Error {
+	for _, row := range rows {
+		cells := make([]string, len(row))
+		for i, c := range row {
+			cells[i] = escape(c)
+		}
+		if _, err := io.WriteString(w, strings.Join(cells, sep)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// csvQuote quotes s as described by RFC 4180, if it contains a comma, a
+// double quote or a line break.
+func csvQuote(s string) string {
+	if strings.IndexAny(s, ",\"\r\n") < 0 {
+		return s
+	}
+	return `"` + strings.Replace(s, `"`, `""`, -1) + `"`
+}
+
+// tsvEscape escapes backslashes, tabs and line breaks, which can't appear in
+// the fields of tab-separated values.
+func tsvEscape(s string) string {
+	s = strings.Replace(s, `\`, `\\`, -1)
+	s = strings.Replace(s, "\t", `\t`, -1)
+	s = strings.Replace(s, "\n", `\n`, -1)
+	return strings.Replace(s, "\r", `\r`, -1)
+}
+
+// tableCell puts s on a single line, so that it doesn't break the alignment.
+func tableCell(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// writeYAML writes the generic value v to b as a YAML block, indented by
+// indent. Object keys are sorted.
+func writeYAML(b *bytes.Buffer, v interface{}, indent string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) == 0 {
+			b.WriteString("{}\n")
+			return
+		}
+		keys := make([]string, 0, len(t))
+		for key, _ := range t {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			b.WriteString(indent + yamlScalar(key) + ":")
+			writeYAMLValue(b, t[key], indent+"  ")
+		}
+	case []interface{}:
+		if len(t) == 0 {
+			b.WriteString("[]\n")
+			return
+		}
+		for _, e := range t {
+			// Objects start on the line of their dash.
+			if m, ok := e.(map[string]interface{}); ok && len(m) > 0 {
+				var elem bytes.Buffer
+				writeYAML(&elem, m, indent+"  ")
+				b.WriteString(indent + "- ")
+				b.Write(elem.Bytes()[len(indent)+2:])
+				continue
+			}
+			b.WriteString(indent + "-")
+			writeYAMLValue(b, e, indent+"  ")
+		}
+	default:
+		b.WriteString(yamlScalar(v) + "\n")
+	}
+}
+
+// writeYAMLValue writes the value of a key or of an array element, after the
+// colon or dash. Non-empty objects and arrays start on the next line.
+func writeYAMLValue(b *bytes.Buffer, v interface{}, indent string) {
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if len(t) > 0 {
+			b.WriteString("\n")
+			writeYAML(b, t, indent)
+			return
+		}
+	case []interface{}:
+		if len(t) > 0 {
+			b.WriteString("\n")
+			writeYAML(b, t, indent)
+			return
+		}
+	}
+	b.WriteString(" ")
+	writeYAML(b, v, indent)
+}
+
+// yamlScalar formats a string, number, bool or nil as a YAML scalar. Strings
+// are double-quoted unless they can't be mistaken for anything else.
+func yamlScalar(v interface{}) string {
+	switch t := v.(type) {
+	case nil:
+		return "null"
+	case string:
+		if plainYAML(t) {
+			return t
+		}
+		return strconv.Quote(t)
+	}
+	return fmt.Sprint(v)
+}
+
+// plainYAML reports whether s can be written as a plain YAML scalar: words of
+// letters, digits and a few punctuation characters, which don't look like a
+// number or a bool.
+func plainYAML(s string) bool {
+	if len(s) == 0 {
+		return false
+	}
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "null", "~":
+		return false
+	}
+	for i, c := range s {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c == '_', c == '/':
+		case c >= '0' && c <= '9', c == '.', c == '-', c == '@':
+			if i == 0 {
+				return false
+			}
+		case c == ' ':
+			if i == 0 || i == len(s)-1 {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
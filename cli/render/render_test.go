@@ -0,0 +1,318 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package render
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"template"
+	"testing"
+
+	"google-plus-go-starter.googlecode.com/hg/fields"
+)
+
+type actor struct {
+	DisplayName string `json:"displayName,omitempty"`
+}
+
+type activity struct {
+	Id    string   `json:"id,omitempty"`
+	Title string   `json:"title,omitempty"`
+	Actor *actor   `json:"actor,omitempty"`
+	Tags  []string `json:"tags,omitempty"`
+}
+
+var activities = []*activity{
+	&activity{Id: "a1", Title: "Hello, world", Actor: &actor{"Larry Page"}, Tags: []string{"go", "plus"}},
+	&activity{Id: "a2", Title: "Say \"hi\"\tnow", Actor: &actor{"Sergey"}},
+}
+
+var view = &View{
+	Template: template.Must(template.New("activities").Parse(`{{range .}}{{.Id}}: {{.Title}}
+{{end}}`)),
+	Columns: []string{"id", "actor/displayName"},
+}
+
+type RenderTest struct {
+	format   string
+	columns  []string
+	value    interface{}
+	expected string
+}
+
+var RenderTests = []RenderTest{
+	RenderTest{"", nil, activities, "a1: Hello, world\na2: Say \"hi\"\tnow\n"},
+	RenderTest{"text", nil, activities, "a1: Hello, world\na2: Say \"hi\"\tnow\n"},
+	RenderTest{"json", nil, activities[1], `{
+  "id": "a2",
+  "title": "Say \"hi\"\tnow",
+  "actor": {
+    "displayName": "Sergey"
+  }
+}
+`},
+	RenderTest{"ndjson", nil, activities, `{"actor":{"displayName":"Larry Page"},"id":"a1","tags":["go","plus"],"title":"Hello, world"}
+{"actor":{"displayName":"Sergey"},"id":"a2","title":"Say \"hi\"\tnow"}
+`},
+	RenderTest{"yaml", nil, activities, `- actor:
+    displayName: Larry Page
+  id: a1
+  tags:
+    - go
+    - plus
+  title: "Hello, world"
+- actor:
+    displayName: Sergey
+  id: a2
+  title: "Say \"hi\"\tnow"
+`},
+	RenderTest{"yaml", nil, map[string]interface{}{"empty": []string{}, "n": 3, "ok": true, "s": "true"}, `empty: []
+n: 3
+ok: true
+s: "true"
+`},
+	RenderTest{"csv", nil, activities, `id,actor/displayName
+a1,Larry Page
+a2,Sergey
+`},
+	RenderTest{"csv", []string{"title", "tags"}, activities, `title,tags
+"Hello, world","go, plus"
+"Say ""hi""	now",
+`},
+	RenderTest{"tsv", []string{"id", "title"}, activities, "id\ttitle\na1\tHello, world\na2\tSay \"hi\"\\tnow\n"},
+	RenderTest{"table", nil, activities, `id  actor/displayName
+a1  Larry Page
+a2  Sergey
+`},
+	RenderTest{"table", nil, activities[0], `id  actor/displayName
+a1  Larry Page
+`},
+}
+
+func TestRender(t *testing.T) {
+	for _, test := range RenderTests {
+		r := &Renderer{Format: test.format, Columns: test.columns}
+		var b bytes.Buffer
+		if err := r.Render(&b, test.value, view); err != nil {
+			t.Errorf("%s: %s", test.format, err)
+			continue
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("%s: expected\n%s\ngot\n%s", test.format, test.expected, got)
+		}
+	}
+}
+
+func TestDefaultColumns(t *testing.T) {
+	r := &Renderer{Format: "csv"}
+	var b bytes.Buffer
+	if err := r.Render(&b, activities, &View{}); err != nil {
+		t.Fatal(err)
+	}
+	expected := `actor,id,tags,title
+"{""displayName"":""Larry Page""}",a1,"go, plus","Hello, world"
+"{""displayName"":""Sergey""}",a2,,"Say ""hi""	now"
+`
+	if got := b.String(); got != expected {
+		t.Errorf("expected\n%s\ngot\n%s", expected, got)
+	}
+}
+
+type feed struct {
+	NextPageToken string      `json:"nextPageToken,omitempty"`
+	Items         []*activity `json:"items"`
+}
+
+var activityFeed = &feed{NextPageToken: "p2", Items: activities}
+
+var feedView = &View{Records: "items", Resource: &feed{}}
+
+type FieldsTest struct {
+	format   string
+	fields   string
+	columns  []string
+	expected string
+}
+
+var FieldsTests = []FieldsTest{
+	FieldsTest{"json", "nextPageToken,items/id", nil, `{
+  "items": [
+    {
+      "id": "a1"
+    },
+    {
+      "id": "a2"
+    }
+  ],
+  "nextPageToken": "p2"
+}
+`},
+	FieldsTest{"ndjson", "items(id,actor/displayName)", nil, `{"actor":{"displayName":"Larry Page"},"id":"a1"}
+{"actor":{"displayName":"Sergey"},"id":"a2"}
+`},
+	// The columns default to the selected fields of the records.
+	FieldsTest{"csv", "items(title,actor/displayName)", nil, `actor/displayName,title
+Larry Page,"Hello, world"
+Sergey,"Say ""hi""	now"
+`},
+	FieldsTest{"csv", "items(id,title)", []string{"id"}, "id\na1\na2\n"},
+	// Unless all the fields of the records are selected.
+	FieldsTest{"tsv", "items(*)", nil, "actor\tid\ttags\ttitle\n" +
+		`{"displayName":"Larry Page"}` + "\ta1\tgo, plus\tHello, world\n" +
+		`{"displayName":"Sergey"}` + "\ta2\t\tSay \"hi\"\\tnow\n"},
+}
+
+func TestFields(t *testing.T) {
+	for _, test := range FieldsTests {
+		s, err := fields.Parse(test.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Renderer{Format: test.format, Columns: test.columns, Fields: s}
+		var b bytes.Buffer
+		if err := r.Render(&b, activityFeed, feedView); err != nil {
+			t.Errorf("%s %s: %s", test.format, test.fields, err)
+			continue
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("%s %s: expected\n%s\ngot\n%s", test.format, test.fields, test.expected, got)
+		}
+	}
+}
+
+// itemsView displays the items of a feed, whose fields are selected in the
+// feed.
+var itemsView = &View{Template: view.Template, Resource: &feed{}, Within: "items"}
+
+var WithinTests = []FieldsTest{
+	FieldsTest{"text", "items(id)", nil, "a1: \na2: \n"},
+	FieldsTest{"json", "nextPageToken,items/id", nil, `[
+  {
+    "id": "a1"
+  },
+  {
+    "id": "a2"
+  }
+]
+`},
+	FieldsTest{"ndjson", "items/title", nil, `{"title":"Hello, world"}
+{"title":"Say \"hi\"\tnow"}
+`},
+	FieldsTest{"csv", "items(id,tags)", nil, "id,tags\na1,\"go, plus\"\na2,\n"},
+	// Without any field of the items, nothing is displayed.
+	FieldsTest{"csv", "nextPageToken", []string{"id"}, "id\n\n\n"},
+}
+
+func TestFieldsWithin(t *testing.T) {
+	for _, test := range WithinTests {
+		s, err := fields.Parse(test.fields)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := &Renderer{Format: test.format, Columns: test.columns, Fields: s}
+		var b bytes.Buffer
+		if err := r.Render(&b, activities, itemsView); err != nil {
+			t.Errorf("%s %s: %s", test.format, test.fields, err)
+			continue
+		}
+		if got := b.String(); got != test.expected {
+			t.Errorf("%s %s: expected\n%s\ngot\n%s", test.format, test.fields, test.expected, got)
+		}
+	}
+	// The results themselves aren't changed.
+	if activities[0].Title != "Hello, world" {
+		t.Error("the results were changed")
+	}
+}
+
+func TestTemplates(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	err = ioutil.WriteFile(filepath.Join(dir, "activities.tmpl"),
+		[]byte(`{{range .}}{{.Title | truncate 8}} by {{.Actor.DisplayName}}
+{{end}}`), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The templates of TemplateDir replace those of the Views they're named
+	// after, and the Template replaces all of them.
+	r := &Renderer{TemplateDir: dir}
+	other := &View{Template: template.Must(template.New("other").Parse("{{len .}} activities\n"))}
+	expected := map[*View]string{
+		view:  "Hello... by Larry Page\nSay \"... by Sergey\n",
+		other: "2 activities\n",
+	}
+	for v, e := range expected {
+		var b bytes.Buffer
+		if err := r.Render(&b, activities, v); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != e {
+			t.Errorf("%s: expected %q, got %q", v.Template.Name(), e, got)
+		}
+	}
+	r.Template, err = Parse("flag", `{{range .}}{{.Id}} {{end}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range []*View{view, other} {
+		var b bytes.Buffer
+		if err := r.Render(&b, activities, v); err != nil {
+			t.Fatal(err)
+		}
+		if got := b.String(); got != "a1 a2 " {
+			t.Errorf("%s: expected the Template to be used, got %q", v.Template.Name(), got)
+		}
+	}
+
+	// Broken templates are reported with their path.
+	ioutil.WriteFile(filepath.Join(dir, "other.tmpl"), []byte("{{.Id"), 0600)
+	r.Template = nil
+	if err := r.Render(ioutil.Discard, activities, other); err == nil {
+		t.Error("expected an error for a broken template")
+	}
+}
+
+type CheckTest struct {
+	format   string
+	columns  []string
+	expected string
+}
+
+var CheckTests = []CheckTest{
+	CheckTest{"", nil, ""},
+	CheckTest{"table", []string{"id"}, ""},
+	CheckTest{"json", []string{"id"}, "Columns can only be selected for the csv, tsv and table formats."},
+	CheckTest{"yaml", nil, ""},
+	CheckTest{"xml", nil, `Unknown format "xml". Use one of: text, json, ndjson, yaml, csv, tsv, table`},
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range CheckTests {
+		got := ""
+		if err := (&Renderer{Format: test.format, Columns: test.columns}).Check(); err != nil {
+			got = err.String()
+		}
+		if got != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.format, test.expected, got)
+		}
+	}
+}
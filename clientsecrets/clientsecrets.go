@@ -0,0 +1,126 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The clientsecrets package reads the client secrets files which the API
+// console downloads for OAuth clients ("client_secret.json"), so that their
+// values don't have to be copied into a config file by hand:
+//
+// 	f := &clientsecrets.File{}
+// 	json.Unmarshal(data, f)
+// 	if c, err := f.Client(); err == nil && c != nil {
+// 		c.Apply(&oauthConfig)
+// 		oauthConfig.RedirectURL = c.LocalRedirectURI()
+// 	}
+package clientsecrets
+
+import (
+	"os"
+	"strings"
+	"url"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+// OOBRedirectURI is the redirect URI of installed applications which display
+// the authorization code for the user to copy instead of redirecting.
+const OOBRedirectURI = "urn:ietf:wg:oauth:2.0:oob"
+
+// File is the content of a client secrets file. It holds either an installed
+// application client or a web application client.
+type File struct {
+	Installed *Client `json:"installed"`
+	Web       *Client `json:"web"`
+}
+
+// Client is an OAuth client of a client secrets file.
+type Client struct {
+	ClientId     string   `json:"client_id"`
+	ClientSecret string   `json:"client_secret"`
+	AuthURI      string   `json:"auth_uri"`
+	TokenURI     string   `json:"token_uri"`
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// Client returns the client of f, or nil if f holds none, e.g. because the
+// file it was read from isn't a client secrets file.
+func (f *File) Client() (*Client, os.Error) {
+	switch {
+	case f.Installed != nil && f.Web != nil:
+		return nil, os.NewError(`a client secrets file can't have both "installed" and "web" clients`)
+	case f.Installed != nil:
+		return f.Installed, nil
+	}
+	return f.Web, nil
+}
+
+// Apply sets the client ID, client secret, and authorization and token URLs of
+// config from c, unless they are set already.
+func (c *Client) Apply(config *oauth.Config) {
+	set := func(field *string, value string) {
+		if len(*field) == 0 {
+			*field = value
+		}
+	}
+	set(&config.ClientId, c.ClientId)
+	set(&config.ClientSecret, c.ClientSecret)
+	set(&config.AuthURL, c.AuthURI)
+	set(&config.TokenURL, c.TokenURI)
+}
+
+// LocalRedirectURI returns the redirect URI to use on the user's machine, e.g.
+// by a command-line tool or a development server: OOBRedirectURI if it is
+// listed, or else the first redirect URI on localhost. It returns "" if there
+// is none.
+func (c *Client) LocalRedirectURI() string {
+	for _, uri := range c.RedirectURIs {
+		if uri == OOBRedirectURI {
+			return uri
+		}
+	}
+	for _, uri := range c.RedirectURIs {
+		if isLocal(uri) {
+			return uri
+		}
+	}
+	return ""
+}
+
+// RemoteRedirectURI returns the first redirect URI which is neither
+// OOBRedirectURI nor on localhost, e.g. for an application in production. It
+// returns "" if there is none.
+func (c *Client) RemoteRedirectURI() string {
+	for _, uri := range c.RedirectURIs {
+		if uri != OOBRedirectURI && !isLocal(uri) {
+			return uri
+		}
+	}
+	return ""
+}
+
+// isLocal reports whether uri is an HTTP URL on the local machine.
+func isLocal(uri string) bool {
+	u, err := url.Parse(uri)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return false
+	}
+	host := u.Host
+	if i := strings.LastIndex(host, ":"); i >= 0 && host[len(host)-1] != ']' {
+		host = host[:i]
+	}
+	switch host {
+	case "localhost", "127.0.0.1", "[::1]":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,102 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package clientsecrets
+
+import (
+	"json"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+)
+
+const installedJSON = `{"installed": {
+	"client_id": "123.apps.googleusercontent.com",
+	"client_secret": "secret",
+	"auth_uri": "https://accounts.google.com/o/oauth2/auth",
+	"token_uri": "https://accounts.google.com/o/oauth2/token",
+	"redirect_uris": ["http://localhost", "urn:ietf:wg:oauth:2.0:oob"]
+}}`
+
+func TestInstalledClient(t *testing.T) {
+	f := &File{}
+	if err := json.Unmarshal([]byte(installedJSON), f); err != nil {
+		t.Fatal(err)
+	}
+	c, err := f.Client()
+	if err != nil || c == nil {
+		t.Fatalf("expected the installed client, got %v, %v", c, err)
+	}
+
+	// Values already in the config are kept.
+	config := &oauth.Config{ClientSecret: "other", Scope: "plus.me"}
+	c.Apply(config)
+	if config.ClientId != "123.apps.googleusercontent.com" || config.ClientSecret != "other" ||
+		config.AuthURL != "https://accounts.google.com/o/oauth2/auth" ||
+		config.TokenURL != "https://accounts.google.com/o/oauth2/token" || config.Scope != "plus.me" {
+		t.Errorf("unexpected config %+v", config)
+	}
+	if uri := c.LocalRedirectURI(); uri != OOBRedirectURI {
+		t.Errorf("expected the OOB redirect URI, got %q", uri)
+	}
+	if uri := c.RemoteRedirectURI(); uri != "" {
+		t.Errorf("expected no remote redirect URI, got %q", uri)
+	}
+}
+
+type RedirectURITest struct {
+	uris          []string
+	local, remote string
+}
+
+var RedirectURITests = []RedirectURITest{
+	RedirectURITest{nil, "", ""},
+	RedirectURITest{
+		[]string{"https://example.appspot.com/oauth2callback", "http://localhost:8080/oauth2callback"},
+		"http://localhost:8080/oauth2callback", "https://example.appspot.com/oauth2callback",
+	},
+	RedirectURITest{
+		[]string{"http://127.0.0.1:8080/cb", "http://[::1]:8080/cb", "http://localhost.example.com/cb"},
+		"http://127.0.0.1:8080/cb", "http://localhost.example.com/cb",
+	},
+	RedirectURITest{[]string{"http://[::1]/cb"}, "http://[::1]/cb", ""},
+}
+
+func TestRedirectURIs(t *testing.T) {
+	for _, test := range RedirectURITests {
+		c := &Client{RedirectURIs: test.uris}
+		if local := c.LocalRedirectURI(); local != test.local {
+			t.Errorf("%v: expected the local redirect URI %q but got %q", test.uris, test.local, local)
+		}
+		if remote := c.RemoteRedirectURI(); remote != test.remote {
+			t.Errorf("%v: expected the remote redirect URI %q but got %q", test.uris, test.remote, remote)
+		}
+	}
+}
+
+func TestFileClient(t *testing.T) {
+	for _, data := range []string{`{}`, `{"APIKey": "key"}`} {
+		f := &File{}
+		if err := json.Unmarshal([]byte(data), f); err != nil {
+			t.Fatal(err)
+		}
+		if c, err := f.Client(); c != nil || err != nil {
+			t.Errorf("%s: expected no client, got %v, %v", data, c, err)
+		}
+	}
+	f := &File{Installed: &Client{}, Web: &Client{}}
+	if _, err := f.Client(); err == nil {
+		t.Error("expected an error for both clients")
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The configcheck package validates config files, collecting every problem
+// so that they can all be fixed at once instead of one per run:
+//
+// 	var problems configcheck.Problems
+// 	problems.Required("APIKey", config.APIKey)
+// 	problems.URL("OAuthConfig.TokenURL", config.OAuthConfig.TokenURL)
+// 	problems.Scopes("OAuthConfig.Scope", config.OAuthConfig.Scope)
+// 	if err := problems.Err("config.json"); err != nil {
+// 		return err
+// 	}
+package configcheck
+
+import (
+	"fmt"
+	"json"
+	"os"
+	"strings"
+	"url"
+)
+
+// GoogleScopePrefix is the prefix of the OAuth scopes of Google APIs.
+const GoogleScopePrefix = "https://www.googleapis.com/auth/"
+
+// Problems lists the problems found in a config file.
+type Problems []string
+
+// Add adds a problem, formatted like fmt.Sprintf.
+func (p *Problems) Add(format string, args ...interface{}) {
+	*p = append(*p, fmt.Sprintf(format, args...))
+}
+
+// IsPlaceholder reports whether value is a placeholder of the sample config
+// files, like "YOUR_API_KEY", which must be replaced with an actual value.
+func IsPlaceholder(value string) bool {
+	return strings.HasPrefix(value, "YOUR_")
+}
+
+// Required adds a problem if value is missing or is a placeholder.
+func (p *Problems) Required(name, value string) {
+	if len(value) == 0 {
+		p.Add("%s is missing", name)
+	} else {
+		p.NotPlaceholder(name, value)
+	}
+}
+
+// NotPlaceholder adds a problem if value is a placeholder.
+func (p *Problems) NotPlaceholder(name, value string) {
+	if IsPlaceholder(value) {
+		p.Add("%s is still the placeholder %q", name, value)
+	}
+}
+
+// URL adds a problem if value is set but isn't an absolute http or https URL.
+func (p *Problems) URL(name, value string) {
+	if len(value) == 0 {
+		return
+	}
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		p.Add("%s %q isn't an absolute http or https URL", name, value)
+	}
+}
+
+// Scopes adds a problem for each scope of value, a list of OAuth scopes
+// separated by spaces, which isn't a Google API scope.
+func (p *Problems) Scopes(name, value string) {
+	for _, scope := range strings.Fields(value) {
+		if !IsGoogleScope(scope) {
+			p.Add("%s: unsupported scope %q (Google API scopes start with %s)", name, scope, GoogleScopePrefix)
+		}
+	}
+}
+
+// IsGoogleScope reports whether scope is the OAuth scope of a Google API, or
+// one of the OpenID Connect scopes.
+func IsGoogleScope(scope string) bool {
+	switch scope {
+	case "openid", "email", "profile":
+		return true
+	}
+	return strings.HasPrefix(scope, GoogleScopePrefix) && len(scope) > len(GoogleScopePrefix)
+}
+
+// Err returns an error listing the problems of the config file at path, or
+// nil if there are none.
+func (p Problems) Err(path string) os.Error {
+	if len(p) == 0 {
+		return nil
+	}
+	return &Error{Path: path, Problems: p}
+}
+
+// Error is the error returned by Problems.Err.
+type Error struct {
+	Path     string
+	Problems Problems
+}
+
+func (e *Error) String() string {
+	return fmt.Sprintf("invalid config %s:\n  - %s", e.Path, strings.Join(e.Problems, "\n  - "))
+}
+
+// Unmarshal parses the JSON config file data into v, like json.Unmarshal.
+// Syntax errors report their line and column.
+func Unmarshal(data []byte, v interface{}) os.Error {
+	err := json.Unmarshal(data, v)
+	if e, ok := err.(*json.SyntaxError); ok {
+		// The offending byte is the last one read.
+		line, column := position(data, e.Offset-1)
+		return fmt.Errorf("line %d, column %d: %s", line, column, e.String())
+	}
+	return err
+}
+
+// position returns the line and column, starting at 1, of the byte at offset
+// in data.
+func position(data []byte, offset int64) (line, column int) {
+	line, column = 1, 1
+	for i := int64(0); i < offset && i < int64(len(data)); i++ {
+		if data[i] == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	return line, column
+}
@@ -0,0 +1,68 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package configcheck
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestProblems(t *testing.T) {
+	var p Problems
+	p.Required("APIKey", "")
+	p.Required("ClientId", "YOUR_CLIENT_ID")
+	p.Required("ClientSecret", "secret")
+	p.NotPlaceholder("Key", "AIza")
+	p.URL("BaseURL", "")
+	p.URL("TokenURL", "https://accounts.google.com/o/oauth2/token")
+	p.URL("AuthURL", "accounts.google.com/o/oauth2/auth")
+	p.URL("DeviceCodeURL", "ftp://example.com/")
+	p.Scopes("Scope", "https://www.googleapis.com/auth/plus.me openid plus.me https://www.googleapis.com/auth/")
+
+	expected := []string{
+		`APIKey is missing`,
+		`ClientId is still the placeholder "YOUR_CLIENT_ID"`,
+		`AuthURL "accounts.google.com/o/oauth2/auth" isn't an absolute http or https URL`,
+		`DeviceCodeURL "ftp://example.com/" isn't an absolute http or https URL`,
+		`Scope: unsupported scope "plus.me" (Google API scopes start with https://www.googleapis.com/auth/)`,
+		`Scope: unsupported scope "https://www.googleapis.com/auth/" (Google API scopes start with https://www.googleapis.com/auth/)`,
+	}
+	if len(p) != len(expected) {
+		t.Fatalf("expected %d problems, got %d: %q", len(expected), len(p), p)
+	}
+	for i := range expected {
+		if p[i] != expected[i] {
+			t.Errorf("expected %s\n but got %s", expected[i], p[i])
+		}
+	}
+
+	err := p.Err("config.json")
+	if err == nil || !strings.HasPrefix(err.String(), "invalid config config.json:\n  - APIKey is missing\n  - ClientId") {
+		t.Errorf("unexpected error %v", err)
+	}
+	if err := Problems(nil).Err("config.json"); err != nil {
+		t.Errorf("expected no error, got %v", err)
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	v := make(map[string]string)
+	if err := Unmarshal([]byte("{\n  \"APIKey\": \"key\",\n}"), &v); err == nil || !strings.HasPrefix(err.String(), "line 3, column 1: ") {
+		t.Errorf("expected an error at line 3, column 1, got %v", err)
+	}
+	if err := Unmarshal([]byte(`{"APIKey": "key"}`), &v); err != nil || v["APIKey"] != "key" {
+		t.Errorf("unexpected result %v, %v", v, err)
+	}
+}
@@ -0,0 +1,352 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"http"
+	"os"
+	"sync"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+	"google-plus-go-starter.googlecode.com/hg/httpcache"
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+	"google-plus-go-starter.googlecode.com/hg/ratelimit"
+)
+
+// TransportFactory makes the HTTP transports which send the requests of the
+// Google+ API, e.g. a URL Fetch transport bound to the current request on App
+// Engine.
+type TransportFactory interface {
+	NewTransport() http.RoundTripper
+}
+
+// TransportFunc adapts a function to the TransportFactory interface.
+type TransportFunc func() http.RoundTripper
+
+func (f TransportFunc) NewTransport() http.RoundTripper {
+	return f()
+}
+
+// CacheFactory may be implemented by a TransportFactory whose environment
+// has its own response cache, e.g. memcache on App Engine. If NewCache returns
+// a cache, it is used instead of the one configured by Config.Cache.
+type CacheFactory interface {
+	NewCache() httpcache.Cache
+}
+
+// TokenStore stores the OAuth tokens of a user.
+type TokenStore interface {
+	// ReadToken returns the stored token, or nil if there is none.
+	ReadToken() (*oauth.Token, os.Error)
+	// WriteToken stores token, replacing the stored one.
+	WriteToken(token *oauth.Token) os.Error
+	// DeleteToken deletes the stored token.
+	DeleteToken() os.Error
+}
+
+// LockingTokenStore is a TokenStore shared by several processes, e.g. a file
+// used by concurrent runs of the command-line tool. TokenSaver holds its lock
+// from reading the token to writing the refreshed one, so that the processes
+// don't refresh the token at once and lose a rotated refresh token.
+type LockingTokenStore interface {
+	TokenStore
+	// Lock waits until the store is locked exclusively, and returns a
+	// function that unlocks it. WriteToken can be called while it is held.
+	Lock() (unlock func(), err os.Error)
+}
+
+// Identity tells who the current user is, e.g. the Google account signed in
+// to an App Engine app.
+type Identity interface {
+	// UserId returns the ID of the current user, or "" if no user is signed
+	// in.
+	UserId() string
+}
+
+var (
+	// ErrNoUser is returned by OAuthPlus when no user is signed in.
+	ErrNoUser = os.NewError("no user is signed in")
+	// ErrNoToken is returned when a TokenStore holds no OAuth tokens.
+	ErrNoToken = os.NewError("no OAuth tokens are stored")
+)
+
+// Client builds the transports and *plus.Services of one config. The key
+// pool, rate limiter and in-process cache of the config are shared by all of
+// them, so that benched keys stay benched and the rate limit applies to the
+// whole process.
+type Client struct {
+	config  *Config
+	keyPool *noauth.KeyPool
+	limiter *ratelimit.Limiter
+	cache   httpcache.Cache
+	stats   *httpcache.Stats
+}
+
+// NewClient returns a Client for config, which must have been checked. Its
+// BaseURL is normalized.
+func NewClient(config *Config) (*Client, os.Error) {
+	var err os.Error
+	if config.BaseURL, err = endpoint.Normalize(config.BaseURL); err != nil {
+		return nil, err
+	}
+	c := &Client{config: config, stats: &httpcache.Stats{}}
+	if len(config.APIKeys) > 0 {
+		c.keyPool = noauth.NewKeyPool(config.APIKeys...)
+	}
+	if config.RateLimit.RequestsPerSecond > 0 {
+		burst := config.RateLimit.Burst
+		if burst == 0 {
+			burst = 1
+		}
+		if c.limiter, err = ratelimit.NewLimiter(config.RateLimit.RequestsPerSecond, burst); err != nil {
+			return nil, err
+		}
+	}
+	if len(config.Cache.Dir) > 0 {
+		if c.cache, err = httpcache.NewDiskCache(config.Cache.Dir); err != nil {
+			return nil, err
+		}
+	} else if !config.Cache.Memcache && config.Cache.MaxEntries > 0 {
+		c.cache = httpcache.NewMemoryCache(config.Cache.MaxEntries)
+	}
+	return c, nil
+}
+
+// Config returns the config of c.
+func (c *Client) Config() *Config {
+	return c.config
+}
+
+// CacheStats returns how many API requests were served from the response
+// cache so far.
+func (c *Client) CacheStats() httpcache.Stats {
+	return c.stats.Snapshot()
+}
+
+// KeyStats returns the usage counters of each key in the APIKeys pool, or nil
+// if the config doesn't list any.
+func (c *Client) KeyStats() []noauth.KeyStats {
+	if c.keyPool == nil {
+		return nil
+	}
+	return c.keyPool.Stats()
+}
+
+// Transport returns the HTTP transport underlying the noauth and oauth
+// transports: a transport of f, redirected to BaseURL, rate limited and
+// cached. Cached responses are served before the rate limiter is consulted,
+// so they don't count against the limit.
+func (c *Client) Transport(f TransportFactory) http.RoundTripper {
+	t := f.NewTransport()
+	if len(c.config.BaseURL) > 0 {
+		t = &endpoint.Transport{BaseURL: c.config.BaseURL, Transport: t}
+	}
+	if c.limiter != nil {
+		t = &ratelimit.Transport{Limiter: c.limiter, Transport: t}
+	}
+	cache := c.cache
+	if cf, ok := f.(CacheFactory); ok {
+		if fc := cf.NewCache(); fc != nil {
+			cache = fc
+		}
+	}
+	if cache != nil {
+		t = &httpcache.Transport{Cache: cache, Transport: t, Stats: c.stats}
+	}
+	return t
+}
+
+// NoAuthPlus returns a *plus.Service which provides unauthenticated (simple)
+// access to the Google+ API through t, a transport returned by Transport.
+func (c *Client) NoAuthPlus(t http.RoundTripper) (*plus.Service, os.Error) {
+	if len(c.config.APIKey) == 0 && c.keyPool == nil {
+		return nil, os.NewError("APIKey missing")
+	}
+	nt := &noauth.Transport{
+		APIKey:    c.config.APIKey,
+		Keys:      c.keyPool,
+		Transport: t,
+		Retry:     noauth.DefaultRetryPolicy,
+	}
+	return plus.New(nt.Client())
+}
+
+// AuthTransport returns the HTTP transport underlying OAuth requests, which
+// retries the requests of t that fail transiently, and forwards CancelRequest
+// to t.
+func AuthTransport(t http.RoundTripper) http.RoundTripper {
+	return &noauth.RetryTransport{
+		Policy:    noauth.DefaultRetryPolicy,
+		Transport: t,
+	}
+}
+
+// OAuthTransport returns an oauth.Transport without a token which sends
+// requests through t, a transport returned by Transport. If scope isn't
+// empty, it replaces the Scope of the config.
+func (c *Client) OAuthTransport(t http.RoundTripper, scope string) *oauth.Transport {
+	config := c.config.OAuthConfig
+	if len(scope) > 0 {
+		config.Scope = scope
+	}
+	return &oauth.Transport{
+		Config:    &config,
+		Transport: AuthTransport(t),
+	}
+}
+
+// OAuthPlus returns a *plus.Service which provides authenticated (OAuth)
+// access to the Google+ API as user, through t, a transport returned by
+// Transport. The tokens of the user are read from store, and written back to
+// it when they are refreshed; logf receives the warnings about tokens that
+// couldn't be written.
+//
+// OAuthPlus doesn't guide the user through the OAuth dance, which depends on
+// the environment: it returns ErrNoUser if no user is signed in, and
+// ErrNoToken if store holds no tokens.
+func (c *Client) OAuthPlus(t http.RoundTripper, user Identity, store TokenStore, logf func(format string, args ...interface{})) (*plus.Service, os.Error) {
+	if len(user.UserId()) == 0 {
+		return nil, ErrNoUser
+	}
+	token, err := store.ReadToken()
+	if err != nil {
+		return nil, err
+	}
+	if token == nil {
+		return nil, ErrNoToken
+	}
+	transport := c.OAuthTransport(t, "")
+	transport.Token = token
+	saver := NewTokenSaver(transport, store)
+	saver.Logf = logf
+	return plus.New(saver.Client())
+}
+
+// TokenSaver is an http.RoundTripper which saves the token of its
+// oauth.Transport to a TokenStore whenever it changes, e.g. when the
+// oauth.Transport refreshes an expired access token, so that the token doesn't
+// have to be refreshed again and a rotated refresh token isn't lost.
+type TokenSaver struct {
+	Transport *oauth.Transport
+	Store     TokenStore
+	// Logf receives the warnings about tokens that couldn't be saved. They
+	// are dropped if it is nil.
+	Logf func(format string, args ...interface{})
+
+	mu sync.Mutex
+	// saved is a copy of the token last read from or written to Store.
+	saved oauth.Token
+}
+
+// NewTokenSaver returns a TokenSaver for transport, whose current token, if
+// any, is the one in store.
+func NewTokenSaver(transport *oauth.Transport, store TokenStore) *TokenSaver {
+	t := &TokenSaver{Transport: transport, Store: store}
+	if transport.Token != nil {
+		t.saved = *transport.Token
+	}
+	return t
+}
+
+func (t *TokenSaver) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	if _, err := t.RefreshIfExpired(); err != nil {
+		return nil, err
+	}
+	resp, err := t.Transport.RoundTrip(req)
+	t.SaveIfChanged()
+	return resp, err
+}
+
+// CancelRequest cancels req, e.g. while it waits for a ratelimit.Transport.
+// oauth.Transport sends requests on to its Transport with the Authorization
+// header set, so req is canceled there unless the oauth.Transport can cancel
+// it itself.
+func (t *TokenSaver) CancelRequest(req *http.Request) {
+	var transport interface{} = t.Transport
+	if _, ok := transport.(noauth.Canceler); !ok {
+		transport = t.Transport.Transport
+	}
+	if c, ok := transport.(noauth.Canceler); ok {
+		c.CancelRequest(req)
+	}
+}
+
+// Client returns an *http.Client that makes OAuth-authenticated requests and
+// saves the token when it changes.
+func (t *TokenSaver) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+// RefreshIfExpired refreshes the access token of Transport if it has expired
+// and there is a refresh token, and saves the new token. refreshed reports
+// whether the token was replaced.
+//
+// If Store is a LockingTokenStore, its lock is held while the token is read
+// again, refreshed and written. A token that another process refreshed
+// meanwhile is used instead of refreshing it again.
+func (t *TokenSaver) RefreshIfExpired() (refreshed bool, err os.Error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	token := t.Transport.Token
+	if token == nil || !token.Expired() || len(token.RefreshToken) == 0 {
+		return false, nil
+	}
+	if store, ok := t.Store.(LockingTokenStore); ok {
+		unlock, err := store.Lock()
+		if err != nil {
+			return false, err
+		}
+		defer unlock()
+		if stored, err := store.ReadToken(); err == nil && stored != nil && !stored.Expired() {
+			t.Transport.Token = stored
+			t.saved = *stored
+			return true, nil
+		}
+	}
+	if err := t.Transport.Refresh(); err != nil {
+		return false, err
+	}
+	t.save()
+	return true, nil
+}
+
+// SaveIfChanged writes the token to the store if it differs from the token
+// saved last. Errors are reported as warnings, since the requests can go on.
+func (t *TokenSaver) SaveIfChanged() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.save()
+}
+
+// save implements SaveIfChanged, with t.mu held. There is nothing to save to
+// without a Store.
+func (t *TokenSaver) save() {
+	token := t.Transport.Token
+	if t.Store == nil || token == nil || (token.AccessToken == t.saved.AccessToken &&
+		token.RefreshToken == t.saved.RefreshToken &&
+		token.TokenExpiry == t.saved.TokenExpiry) {
+		return
+	}
+	if err := t.Store.WriteToken(token); err != nil {
+		if t.Logf != nil {
+			t.Logf("Couldn't save oauth.Token: %s", err.String())
+		}
+		return
+	}
+	t.saved = *token
+}
@@ -0,0 +1,180 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"http"
+	"http/httptest"
+	"io"
+	"os"
+	"testing"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/httpcache"
+	"google-plus-go-starter.googlecode.com/hg/plustest"
+)
+
+// memoryTokenStore is a TokenStore for tests.
+type memoryTokenStore struct {
+	token  *oauth.Token
+	writes int
+}
+
+func (s *memoryTokenStore) ReadToken() (*oauth.Token, os.Error) {
+	return s.token, nil
+}
+
+func (s *memoryTokenStore) WriteToken(token *oauth.Token) os.Error {
+	t := *token
+	s.token = &t
+	s.writes++
+	return nil
+}
+
+func (s *memoryTokenStore) DeleteToken() os.Error {
+	s.token = nil
+	return nil
+}
+
+// userId is an Identity for tests.
+type userId string
+
+func (id userId) UserId() string {
+	return string(id)
+}
+
+// countingCache is an httpcache.Cache which counts lookups and never hits.
+type countingCache struct {
+	gets int
+}
+
+func (c *countingCache) Get(key string) ([]byte, bool) {
+	c.gets++
+	return nil, false
+}
+
+func (c *countingCache) Set(key string, value []byte) {}
+
+func (c *countingCache) Delete(key string) {}
+
+// cachingTransports is a TransportFactory with its own cache, like memcache
+// on App Engine.
+type cachingTransports struct {
+	s     *plustest.Server
+	cache *countingCache
+}
+
+func (f *cachingTransports) NewTransport() http.RoundTripper {
+	return f.s.Transport(nil)
+}
+
+func (f *cachingTransports) NewCache() httpcache.Cache {
+	return f.cache
+}
+
+func TestNoAuthPlus(t *testing.T) {
+	s := plustest.NewServer()
+	defer s.Close()
+	s.AddKey("key")
+	s.AddPerson(&plus.Person{Id: "1", DisplayName: "Larry Page"})
+
+	// BaseURL redirects the requests of the transports of the factory.
+	config := &Config{APIKey: "key", BaseURL: s.BaseURL()}
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := c.NoAuthPlus(c.Transport(TransportFunc(func() http.RoundTripper { return http.DefaultTransport })))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if me, err := p.People.Get("1").Do(); err != nil || me.DisplayName != "Larry Page" {
+		t.Errorf("unexpected person %v, %v", me, err)
+	}
+
+	// The cache of a CacheFactory replaces the in-process cache.
+	config = &Config{APIKey: "key"}
+	config.Cache.MaxEntries = 10
+	if c, err = NewClient(config); err != nil {
+		t.Fatal(err)
+	}
+	f := &cachingTransports{s, &countingCache{}}
+	if p, err = c.NoAuthPlus(c.Transport(f)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.People.Get("1").Do(); err != nil {
+		t.Fatal(err)
+	}
+	if f.cache.gets != 1 {
+		t.Errorf("expected 1 lookup in the cache of the factory but got %d", f.cache.gets)
+	}
+
+	if c, err = NewClient(&Config{}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NoAuthPlus(s.Transport(nil)); err == nil {
+		t.Error("expected an error without an API key")
+	}
+}
+
+func TestOAuthPlus(t *testing.T) {
+	s := plustest.NewServer()
+	defer s.Close()
+	s.AddToken("new", "1")
+	s.AddPerson(&plus.Person{Id: "1", DisplayName: "Larry Page"})
+
+	tokenServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.FormValue("refresh_token") != "refresh" {
+			http.Error(w, `{"error": "invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, `{"access_token": "new", "expires_in": 3600}`)
+	}))
+	defer tokenServer.Close()
+
+	config := &Config{}
+	config.OAuthConfig.ClientId = "client"
+	config.OAuthConfig.TokenURL = tokenServer.URL
+	c, err := NewClient(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := &memoryTokenStore{}
+	f := TransportFunc(func() http.RoundTripper { return s.Transport(nil) })
+
+	if _, err := c.OAuthPlus(c.Transport(f), userId(""), store, t.Logf); err != ErrNoUser {
+		t.Errorf("expected ErrNoUser but got %v", err)
+	}
+	if _, err := c.OAuthPlus(c.Transport(f), userId("1"), store, t.Logf); err != ErrNoToken {
+		t.Errorf("expected ErrNoToken but got %v", err)
+	}
+
+	// An expired access token is refreshed by the first request, and saved.
+	store.token = &oauth.Token{AccessToken: "old", RefreshToken: "refresh", TokenExpiry: 1}
+	p, err := c.OAuthPlus(c.Transport(f), userId("1"), store, t.Logf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		if me, err := p.People.Get("me").Do(); err != nil || me.DisplayName != "Larry Page" {
+			t.Fatalf("unexpected person %v, %v", me, err)
+		}
+	}
+	if store.writes != 1 || store.token.AccessToken != "new" || store.token.RefreshToken != "refresh" {
+		t.Errorf("expected the refreshed token to be saved once, got %d writes of %v", store.writes, store.token)
+	}
+}
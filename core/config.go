@@ -0,0 +1,147 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The core package holds what the command-line tool and the App Engine app
+// have in common: the API config file, the construction of the HTTP transports
+// of the Google+ API and the handling of OAuth tokens. What differs between
+// environments is behind small interfaces: TransportFactory makes the HTTP
+// transports, TokenStore stores the OAuth tokens of a user, and Identity tells
+// who the user is.
+//
+// 	config, _, err := core.Parse(data)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	c, err := core.NewClient(config)
+// 	if err != nil {
+// 		return err
+// 	}
+// 	p, err := c.NoAuthPlus(c.Transport(core.TransportFunc(newTransport)))
+package core
+
+import (
+	"fmt"
+	"os"
+
+	"goauth2.googlecode.com/hg/oauth"
+	"google-plus-go-starter.googlecode.com/hg/clientsecrets"
+	"google-plus-go-starter.googlecode.com/hg/configcheck"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+// PlusMeScope is the OAuth scope which gives access to the user's Google+
+// identity, e.g. for People.Get("me").
+const PlusMeScope = "https://www.googleapis.com/auth/plus.me"
+
+// Config contains configuration values used to access the Google+ Platform
+// APIs, as found in the config.json files. Some values are only used in some
+// environments.
+type Config struct {
+	// Optional base URL of the Google+ API, e.g. of a proxy or a local
+	// stand-in server. It will default to the public Google+ API.
+	BaseURL string
+	// Your unique Google API Key for simple API Access.
+	APIKey string
+	// Optional pool of API keys to use instead of APIKey. Requests rotate
+	// between the keys, and fail over to another key when one runs out of
+	// quota.
+	APIKeys []noauth.Key
+	// Your OAuth configuration information for protected user data access.
+	OAuthConfig oauth.Config
+	// Optional URL of the OAuth device authorization endpoint, used by the
+	// device flow of the command-line tool. It will default to Google's.
+	DeviceCodeURL string
+	// Optional URLs of the OAuth token information and revocation endpoints,
+	// used by the auth actions of the command-line tool. They will default to
+	// Google's.
+	TokenInfoURL string
+	RevokeURL    string
+	// Optional client-side limit on the rate of API requests. Requests beyond
+	// the limit wait instead of failing with rateLimitExceeded errors. Burst
+	// defaults to 1.
+	RateLimit struct {
+		RequestsPerSecond float64
+		Burst             int
+	}
+	// Optional cache for API responses. If Dir is set, responses are cached in
+	// that directory across runs; if Memcache is set, they are cached in
+	// memcache on App Engine; otherwise, if MaxEntries is positive, up to that
+	// many responses are cached in memory by each process.
+	Cache struct {
+		Dir        string
+		Memcache   bool
+		MaxEntries int
+	}
+	// The path in your App Engine application to which users will be
+	// redirected after they allow or deny permission for your application to
+	// access their data.
+	OAuthRedirectPath string
+	// The scheme, hostname and port at which your App Engine application can
+	// be accessed when running on the local development server, and on App
+	// Engine.
+	DevRootURL  string
+	ProdRootURL string
+}
+
+// Parse parses a config file. The file may also be a client secrets file
+// downloaded from the API console, or hold its "installed" or "web" client,
+// whose values fill in the missing OAuthConfig values. The client is returned
+// too, or nil if there is none, so that the caller can pick its redirect URI.
+func Parse(data []byte) (*Config, *clientsecrets.Client, os.Error) {
+	config := &Config{}
+	if err := configcheck.Unmarshal(data, config); err != nil {
+		return nil, nil, err
+	}
+	secrets := &clientsecrets.File{}
+	if err := configcheck.Unmarshal(data, secrets); err != nil {
+		return nil, nil, err
+	}
+	client, err := secrets.Client()
+	if err != nil {
+		return nil, nil, err
+	}
+	if client != nil {
+		client.Apply(&config.OAuthConfig)
+	}
+	return config, client, nil
+}
+
+// Check adds the problems of the values which have the same meaning in every
+// environment to p: APIKeys, BaseURL, RateLimit and Cache.MaxEntries. APIKey
+// is checked by RequireAPIKey, as only simple API access needs it.
+func (c *Config) Check(p *configcheck.Problems) {
+	for i, key := range c.APIKeys {
+		p.Required(fmt.Sprintf("APIKeys[%d].Key", i), key.Key)
+	}
+	if _, err := endpoint.Normalize(c.BaseURL); err != nil {
+		p.Add("BaseURL %q isn't an absolute http or https URL", c.BaseURL)
+	}
+	if c.RateLimit.RequestsPerSecond < 0 || c.RateLimit.Burst < 0 {
+		p.Add("RateLimit values can't be negative")
+	}
+	if c.Cache.MaxEntries < 0 {
+		p.Add("Cache.MaxEntries can't be negative")
+	}
+}
+
+// RequireAPIKey adds a problem to p if c has neither APIKey nor APIKeys, which
+// simple API access needs, or if APIKey is a placeholder.
+func (c *Config) RequireAPIKey(p *configcheck.Problems) {
+	if len(c.APIKeys) == 0 {
+		p.Required("APIKey", c.APIKey)
+	} else {
+		p.NotPlaceholder("APIKey", c.APIKey)
+	}
+}
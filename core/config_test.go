@@ -0,0 +1,99 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"google-plus-go-starter.googlecode.com/hg/configcheck"
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+type ParseTest struct {
+	name     string
+	data     string
+	clientId string
+	client   bool
+	err      string
+}
+
+var ParseTests = []ParseTest{
+	ParseTest{"config", `{"APIKey": "key", "OAuthConfig": {"ClientId": "config"}}`, "config", false, ""},
+	ParseTest{"client secrets", `{"APIKey": "key", "installed": {"client_id": "secrets"}}`, "secrets", true, ""},
+	ParseTest{"config over client secrets", `{"OAuthConfig": {"ClientId": "config"}, "web": {"client_id": "secrets"}}`, "config", true, ""},
+	ParseTest{"both clients", `{"installed": {"client_id": "a"}, "web": {"client_id": "b"}}`, "", false, "installed"},
+	ParseTest{"syntax error", "{\n\t\"APIKey\": \"key\",\n}", "", false, "line 3"},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range ParseTests {
+		config, client, err := Parse([]byte(test.data))
+		if len(test.err) > 0 {
+			if err == nil || !strings.Contains(err.String(), test.err) {
+				t.Errorf("%s: expected an error mentioning %q, got %v", test.name, test.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %s", test.name, err)
+			continue
+		}
+		if config.OAuthConfig.ClientId != test.clientId {
+			t.Errorf("%s: expected ClientId %q but got %q", test.name, test.clientId, config.OAuthConfig.ClientId)
+		}
+		if (client != nil) != test.client {
+			t.Errorf("%s: expected a client %v but got %v", test.name, test.client, client)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	config := &Config{BaseURL: "localhost/plus/v1/"}
+	config.RateLimit.Burst = -1
+	config.Cache.MaxEntries = -1
+	var p configcheck.Problems
+	config.Check(&p)
+	config.RequireAPIKey(&p)
+	err := p.Err("config.json")
+	if err == nil {
+		t.Fatal("expected an error")
+	}
+	for _, problem := range []string{"APIKey", "BaseURL", "RateLimit", "Cache.MaxEntries"} {
+		if !strings.Contains(err.String(), problem) {
+			t.Errorf("expected the error to mention %s: %s", problem, err)
+		}
+	}
+
+	config = &Config{APIKey: "key", BaseURL: "http://localhost:8081/plus/v1"}
+	p = nil
+	config.Check(&p)
+	if err := p.Err("config.json"); err != nil {
+		t.Error(err)
+	}
+
+	// The API key is only required by RequireAPIKey.
+	config = &Config{}
+	p = nil
+	config.Check(&p)
+	if err := p.Err("config.json"); err != nil {
+		t.Error(err)
+	}
+	config.APIKeys = []noauth.Key{noauth.Key{Key: "key"}}
+	config.RequireAPIKey(&p)
+	if err := p.Err("config.json"); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,100 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The endpoint package redirects Google+ API requests to another base URL,
+// such as a corporate egress proxy, a recording proxy or a local stand-in
+// server. The plus client library always builds URLs under PlusBaseURL, so the
+// redirection is done by an HTTP transport:
+//
+// 	t := &noauth.Transport{
+// 		APIKey:    YOUR_API_KEY,
+// 		Transport: &endpoint.Transport{BaseURL: "http://localhost:8081/plus/v1/"},
+// 	}
+// 	p, _ := plus.New(t.Client())
+package endpoint
+
+import (
+	"fmt"
+	"http"
+	"os"
+	"strings"
+	"url"
+)
+
+// PlusBaseURL is the base URL of the public Google+ API.
+const PlusBaseURL = "https://www.googleapis.com/plus/v1/"
+
+// Google's OAuth 2.0 endpoints.
+const (
+	GoogleAuthURL       = "https://accounts.google.com/o/oauth2/auth"
+	GoogleTokenURL      = "https://accounts.google.com/o/oauth2/token"
+	GoogleDeviceCodeURL = "https://accounts.google.com/o/oauth2/device/code"
+	GoogleTokenInfoURL  = "https://www.googleapis.com/oauth2/v1/tokeninfo"
+	GoogleRevokeURL     = "https://accounts.google.com/o/oauth2/revoke"
+)
+
+// Transport implements http.RoundTripper. It sends requests whose URL starts
+// with PlusBaseURL to the same path under its BaseURL instead. Other requests
+// are sent unchanged.
+type Transport struct {
+	// BaseURL replaces PlusBaseURL. If empty, requests are sent unchanged.
+	BaseURL string
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip executes a single HTTP transaction, redirecting it to BaseURL if
+// it is a Google+ API request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	s := req.URL.String()
+	if len(t.BaseURL) == 0 || !strings.HasPrefix(s, PlusBaseURL) {
+		return t.transport().RoundTrip(req)
+	}
+
+	u, err := url.Parse(t.BaseURL + s[len(PlusBaseURL):])
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.URL = u
+	newReq.Host = u.Host
+	return t.transport().RoundTrip(&newReq)
+}
+
+// Normalize checks that baseURL is an absolute http or https URL and returns
+// it with a trailing slash. An empty baseURL is returned unchanged.
+func Normalize(baseURL string) (string, os.Error) {
+	if len(baseURL) == 0 {
+		return "", nil
+	}
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return "", err
+	}
+	if (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) == 0 {
+		return "", fmt.Errorf("base URL %q must be an absolute http or https URL", baseURL)
+	}
+	if !strings.HasSuffix(baseURL, "/") {
+		baseURL += "/"
+	}
+	return baseURL, nil
+}
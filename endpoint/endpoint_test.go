@@ -0,0 +1,87 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package endpoint
+
+import (
+	"http"
+	"os"
+	"testing"
+)
+
+type urlRoundTripper struct{ url, host string }
+
+func (t *urlRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	t.url = req.URL.String()
+	t.host = req.Host
+	return &http.Response{StatusCode: 200}, nil
+}
+
+type RoundTripTest struct {
+	base, in, out string
+}
+
+var RoundTripTests = []RoundTripTest{
+	// No BaseURL: unchanged.
+	RoundTripTest{base: "", in: PlusBaseURL + "people/me", out: PlusBaseURL + "people/me"},
+	// Google+ API requests are redirected, keeping the path and querystring.
+	RoundTripTest{base: "http://localhost:8081/plus/v1/", in: PlusBaseURL + "people?query=Larry&key=abc", out: "http://localhost:8081/plus/v1/people?query=Larry&key=abc"},
+	RoundTripTest{base: "https://proxy.example.com/google/plus/", in: PlusBaseURL + "activities/z12", out: "https://proxy.example.com/google/plus/activities/z12"},
+	// Other requests are unchanged.
+	RoundTripTest{base: "http://localhost:8081/plus/v1/", in: GoogleTokenURL, out: GoogleTokenURL},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, r := range RoundTripTests {
+		fake := &urlRoundTripper{}
+		transport := &Transport{BaseURL: r.base, Transport: fake}
+
+		req, err := http.NewRequest("GET", r.in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Error(err)
+			continue
+		}
+		if fake.url != r.out {
+			t.Errorf("base %q and URL %q expected %q but got %q", r.base, r.in, r.out, fake.url)
+		}
+		if req.URL.String() != r.in {
+			t.Errorf("the original request was modified: %q", req.URL.String())
+		}
+	}
+}
+
+func TestNormalize(t *testing.T) {
+	tests := []struct{ in, out string }{
+		{"", ""},
+		{"http://localhost:8081/plus/v1", "http://localhost:8081/plus/v1/"},
+		{"https://proxy.example.com/plus/v1/", "https://proxy.example.com/plus/v1/"},
+		{"localhost:8081/plus/v1/", ""},
+		{"ftp://example.com/", ""},
+	}
+	for _, test := range tests {
+		out, err := Normalize(test.in)
+		if len(test.out) == 0 && len(test.in) > 0 {
+			if err == nil {
+				t.Errorf("%q: expected an error", test.in)
+			}
+			continue
+		}
+		if err != nil || out != test.out {
+			t.Errorf("%q: expected %q but got %q, %v", test.in, test.out, out, err)
+		}
+	}
+}
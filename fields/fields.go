@@ -0,0 +1,363 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The fields package handles the selectors of partial responses, which make
+// Google APIs return only some fields of a resource, e.g.
+// 	items(id,actor/displayName),nextPageToken
+// Selectors are checked against the types of the client library, and sent in
+// the "fields" parameter by an HTTP transport:
+//
+// 	s, err := fields.Parse("items(id,displayName)")
+// 	if err == nil {
+// 		err = s.Check(reflect.TypeOf(plus.PeopleFeed{}))
+// 	}
+// 	...
+// 	t := &noauth.Transport{
+// 		APIKey:    YOUR_API_KEY,
+// 		Transport: &fields.Transport{Fields: "items(id,displayName)"},
+// 	}
+// 	p, _ := plus.New(t.Client())
+//
+// Project applies a selector to a decoded JSON value, e.g. to responses from
+// servers which ignore the parameter.
+package fields
+
+import (
+	"fmt"
+	"http"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"url"
+
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+// A Selection maps the names of the selected fields of an object to the
+// selections of their own fields, which are nil for whole fields. The name
+// "*" selects all the fields.
+type Selection map[string]Selection
+
+// Parse parses a selector: a list of field paths separated by commas. Paths
+// name nested fields with slashes, and can end with a list of sub-selectors
+// in parentheses.
+func Parse(selector string) (Selection, os.Error) {
+	p := &parser{s: selector}
+	s, err := p.list()
+	if err == nil && p.pos < len(p.s) {
+		err = p.errorf("unexpected %q", p.s[p.pos])
+	}
+	if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+type parser struct {
+	s   string
+	pos int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) os.Error {
+	return fmt.Errorf("Invalid fields %q: %s at position %d", p.s, fmt.Sprintf(format, args...), p.pos+1)
+}
+
+// list parses paths separated by commas.
+func (p *parser) list() (Selection, os.Error) {
+	s := make(Selection)
+	if err := p.path(s); err != nil {
+		return nil, err
+	}
+	for p.pos < len(p.s) && p.s[p.pos] == ',' {
+		p.pos++
+		if err := p.path(s); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// path parses a path, with its sub-selectors, and adds it to s.
+func (p *parser) path(s Selection) os.Error {
+	var names []string
+	for {
+		name := p.name()
+		if len(name) == 0 {
+			if p.pos == len(p.s) {
+				return p.errorf("missing field name")
+			}
+			return p.errorf("unexpected %q", p.s[p.pos])
+		}
+		names = append(names, name)
+		if p.pos == len(p.s) || p.s[p.pos] != '/' {
+			break
+		}
+		p.pos++
+	}
+
+	var sub Selection
+	if p.pos < len(p.s) && p.s[p.pos] == '(' {
+		p.pos++
+		var err os.Error
+		if sub, err = p.list(); err != nil {
+			return err
+		}
+		if p.pos == len(p.s) || p.s[p.pos] != ')' {
+			return p.errorf("missing ')'")
+		}
+		p.pos++
+	}
+	for i := len(names) - 1; i > 0; i-- {
+		sub = Selection{names[i]: sub}
+	}
+	s.add(names[0], sub)
+	return nil
+}
+
+// name parses a field name, or "*".
+func (p *parser) name() string {
+	start := p.pos
+	if p.pos < len(p.s) && p.s[p.pos] == '*' {
+		p.pos++
+		return "*"
+	}
+	for p.pos < len(p.s) {
+		c := p.s[p.pos]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_' || c == '-') {
+			break
+		}
+		p.pos++
+	}
+	return p.s[start:p.pos]
+}
+
+// add merges the selection sub of the field name into s. Whole fields stay
+// whole.
+func (s Selection) add(name string, sub Selection) {
+	old, ok := s[name]
+	switch {
+	case !ok:
+		s[name] = sub
+	case old == nil || sub == nil:
+		s[name] = nil
+	default:
+		for n, ss := range sub {
+			old.add(n, ss)
+		}
+	}
+}
+
+// names returns the selected names in increasing order.
+func (s Selection) names() []string {
+	names := make([]string, 0, len(s))
+	for name, _ := range s {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Check returns an error if s selects fields which t doesn't have, given the
+// JSON names of the fields of structs. Pointers, slices and arrays are checked
+// against their elements, and maps and interfaces accept any field.
+func (s Selection) Check(t reflect.Type) os.Error {
+	return s.check(t, "")
+}
+
+func (s Selection) check(t reflect.Type, prefix string) os.Error {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Map, reflect.Interface:
+		return nil
+	case reflect.Struct:
+	default:
+		return fmt.Errorf("Field %q has no fields to select.", strings.TrimRight(prefix, "/"))
+	}
+
+	fields := jsonFields(t)
+	for _, name := range s.names() {
+		if name == "*" {
+			continue
+		}
+		f, ok := fields[name]
+		if !ok {
+			known := make([]string, 0, len(fields))
+			for n, _ := range fields {
+				known = append(known, n)
+			}
+			sort.Strings(known)
+			return fmt.Errorf("Unknown field %q in %s. Its fields are: %s",
+				prefix+name, t.Name(), strings.Join(known, ", "))
+		}
+		if sub := s[name]; sub != nil {
+			if err := sub.check(f.Type, prefix+name+"/"); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// jsonFields maps the JSON names of the fields of the struct type t to the
+// fields.
+func jsonFields(t reflect.Type) map[string]reflect.StructField {
+	fields := make(map[string]reflect.StructField)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name := strings.Split(f.Tag.Get("json"), ",")[0]
+		if name == "-" || len(f.PkgPath) > 0 {
+			continue
+		}
+		if len(name) == 0 {
+			name = f.Name
+		}
+		fields[name] = f
+	}
+	return fields
+}
+
+// Project returns the selected fields of v, a value decoded from JSON into
+// maps, slices and scalars. Selections apply to each element of slices.
+func (s Selection) Project(v interface{}) interface{} {
+	if s == nil {
+		return v
+	}
+	switch t := v.(type) {
+	case []interface{}:
+		values := make([]interface{}, len(t))
+		for i, e := range t {
+			values[i] = s.Project(e)
+		}
+		return values
+	case map[string]interface{}:
+		m := make(map[string]interface{})
+		for name, value := range t {
+			if sub, ok := s[name]; ok {
+				m[name] = sub.Project(value)
+			} else if sub, ok := s["*"]; ok {
+				m[name] = sub.Project(value)
+			}
+		}
+		return m
+	}
+	return v
+}
+
+// Paths returns the paths of the selected fields, in increasing order, e.g.
+// "actor/displayName" and "id" for "id,actor(displayName)".
+func (s Selection) Paths() []string {
+	var paths []string
+	for _, name := range s.names() {
+		sub := s[name]
+		if sub == nil {
+			paths = append(paths, name)
+			continue
+		}
+		for _, p := range sub.Paths() {
+			paths = append(paths, name+"/"+p)
+		}
+	}
+	return paths
+}
+
+// Sub returns the selection of the fields under path, e.g. "items", or nil if
+// they're all selected. The second result is false if path isn't selected.
+func (s Selection) Sub(path string) (Selection, bool) {
+	for _, name := range strings.Split(path, "/") {
+		if s == nil {
+			return nil, true
+		}
+		sub, ok := s[name]
+		if !ok {
+			if sub, ok = s["*"]; !ok {
+				return nil, false
+			}
+		}
+		s = sub
+	}
+	return s, true
+}
+
+// Transport implements http.RoundTripper. It adds the "fields" parameter to
+// the requests whose URL starts with endpoint.PlusBaseURL. Other requests are
+// sent unchanged.
+type Transport struct {
+	// Fields is the selector sent. If empty, requests are sent unchanged.
+	Fields string
+
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	mu   sync.Mutex
+	sent map[*http.Request]*http.Request
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip executes a single HTTP transaction, asking for the selected fields
+// only if it is a Google+ API request.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	s := req.URL.String()
+	if len(t.Fields) == 0 || !strings.HasPrefix(s, endpoint.PlusBaseURL) {
+		return t.transport().RoundTrip(req)
+	}
+	sep := "?"
+	if strings.Contains(s, "?") {
+		sep = "&"
+	}
+	u, err := url.Parse(s + sep + "fields=" + url.QueryEscape(t.Fields))
+	if err != nil {
+		return nil, err
+	}
+	newReq := *req
+	newReq.URL = u
+
+	t.mu.Lock()
+	if t.sent == nil {
+		t.sent = make(map[*http.Request]*http.Request)
+	}
+	t.sent[req] = &newReq
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		t.sent[req] = nil, false
+		t.mu.Unlock()
+	}()
+	return t.transport().RoundTrip(&newReq)
+}
+
+// CancelRequest cancels req if the Transport can cancel the request sent for
+// it, e.g. while it waits for a ratelimit.Transport.
+func (t *Transport) CancelRequest(req *http.Request) {
+	t.mu.Lock()
+	sent, ok := t.sent[req]
+	t.mu.Unlock()
+	if !ok {
+		sent = req
+	}
+	if c, isCanceler := t.transport().(noauth.Canceler); isCanceler {
+		c.CancelRequest(sent)
+	}
+}
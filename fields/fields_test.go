@@ -0,0 +1,220 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package fields
+
+import (
+	"http"
+	"json"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+)
+
+type ParseTest struct {
+	selector string
+	expected string // The paths of the selection, or the error.
+}
+
+var ParseTests = []ParseTest{
+	ParseTest{"id", "id"},
+	ParseTest{"id,displayName", "displayName id"},
+	ParseTest{"items(id,actor/displayName)", "items/actor/displayName items/id"},
+	ParseTest{"items(id,actor(displayName,url)),nextPageToken", "items/actor/displayName items/actor/url items/id nextPageToken"},
+	ParseTest{"items/id,items/title", "items/id items/title"},
+	// Whole fields stay whole.
+	ParseTest{"items,items/id", "items"},
+	ParseTest{"items/id,items", "items"},
+	ParseTest{"items(*)", "items/*"},
+	ParseTest{"", `Invalid fields "": missing field name at position 1`},
+	ParseTest{"id,", `Invalid fields "id,": missing field name at position 4`},
+	ParseTest{"items(id", `Invalid fields "items(id": missing ')' at position 9`},
+	ParseTest{"items()", `Invalid fields "items()": unexpected ')' at position 7`},
+	ParseTest{"id)", `Invalid fields "id)": unexpected ')' at position 3`},
+	ParseTest{"actor//id", `Invalid fields "actor//id": unexpected '/' at position 7`},
+}
+
+func TestParse(t *testing.T) {
+	for _, test := range ParseTests {
+		got := ""
+		if s, err := Parse(test.selector); err != nil {
+			got = err.String()
+		} else {
+			got = strings.Join(s.Paths(), " ")
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.selector, test.expected, got)
+		}
+	}
+}
+
+type link struct {
+	Href string `json:"href"`
+}
+
+type resource struct {
+	Id       string `json:"id,omitempty"`
+	Links    []*link
+	Extra    map[string]interface{} `json:"extra"`
+	internal string
+}
+
+type CheckTest struct {
+	selector string
+	typ      reflect.Type
+	expected string
+}
+
+var CheckTests = []CheckTest{
+	CheckTest{"id,Links(href),extra/anything", reflect.TypeOf(resource{}), ""},
+	CheckTest{"*", reflect.TypeOf(&resource{}), ""},
+	CheckTest{"Links/title", reflect.TypeOf([]*resource{}), `Unknown field "Links/title" in link. Its fields are: href`},
+	CheckTest{"internal", reflect.TypeOf(resource{}), `Unknown field "internal" in resource. Its fields are: Links, extra, id`},
+	CheckTest{"id/value", reflect.TypeOf(resource{}), `Field "id" has no fields to select.`},
+	CheckTest{"items(id,actor/displayName),nextPageToken", reflect.TypeOf(plus.ActivityFeed{}), ""},
+	CheckTest{"items(id,displayName,url)", reflect.TypeOf(plus.PeopleFeed{}), ""},
+	CheckTest{"id,displayName,aboutMe", reflect.TypeOf(plus.Person{}), ""},
+	CheckTest{"items(id,actor/name)", reflect.TypeOf(plus.ActivityFeed{}), "error"},
+	CheckTest{"displayname", reflect.TypeOf(plus.Person{}), "error"},
+}
+
+func TestCheck(t *testing.T) {
+	for _, test := range CheckTests {
+		s, err := Parse(test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := ""
+		if err := s.Check(test.typ); err != nil {
+			got = err.String()
+			if test.expected == "error" {
+				continue
+			}
+		}
+		if got != test.expected {
+			t.Errorf("%q: expected %q, got %q", test.selector, test.expected, got)
+		}
+	}
+}
+
+type ProjectTest struct {
+	selector string
+	expected string
+}
+
+const projectInput = `{"kind":"plus#activityFeed","nextPageToken":"p2","items":[
+	{"id":"a1","title":"Hello","actor":{"id":"1","displayName":"Larry Page"}},
+	{"id":"a2","actor":{"id":"4"}}
+]}`
+
+var ProjectTests = []ProjectTest{
+	ProjectTest{"nextPageToken", `{"nextPageToken":"p2"}`},
+	ProjectTest{"items(id,actor/displayName)", `{"items":[{"actor":{"displayName":"Larry Page"},"id":"a1"},{"actor":{},"id":"a2"}]}`},
+	ProjectTest{"items/actor", `{"items":[{"actor":{"displayName":"Larry Page","id":"1"}},{"actor":{"id":"4"}}]}`},
+	ProjectTest{"items(*),kind", `{"items":[{"actor":{"displayName":"Larry Page","id":"1"},"id":"a1","title":"Hello"},{"actor":{"id":"4"},"id":"a2"}],"kind":"plus#activityFeed"}`},
+	ProjectTest{"missing", `{}`},
+}
+
+func TestProject(t *testing.T) {
+	var v interface{}
+	if err := json.Unmarshal([]byte(projectInput), &v); err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range ProjectTests {
+		s, err := Parse(test.selector)
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := json.Marshal(s.Project(v))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := string(data); got != test.expected {
+			t.Errorf("%q: expected %s, got %s", test.selector, test.expected, got)
+		}
+	}
+}
+
+func TestSub(t *testing.T) {
+	s, err := Parse("items(id,actor/displayName),nextPageToken,object")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{
+		"items":         "actor/displayName id",
+		"items/actor":   "displayName",
+		"nextPageToken": "",
+		"object":        "",
+		"object/id":     "",
+	}
+	for path, paths := range expected {
+		sub, ok := s.Sub(path)
+		if !ok {
+			t.Errorf("%q: expected it to be selected", path)
+		}
+		if got := strings.Join(sub.Paths(), " "); got != paths {
+			t.Errorf("%q: expected the paths %q, got %q", path, paths, got)
+		}
+	}
+	if _, ok := s.Sub("kind"); ok {
+		t.Error("expected kind not to be selected")
+	}
+}
+
+type urlRoundTripper struct{ url string }
+
+func (t *urlRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	t.url = req.URL.String()
+	return &http.Response{StatusCode: 200}, nil
+}
+
+type RoundTripTest struct {
+	fields, in, out string
+}
+
+var RoundTripTests = []RoundTripTest{
+	// No Fields: unchanged.
+	RoundTripTest{fields: "", in: endpoint.PlusBaseURL + "people/me", out: endpoint.PlusBaseURL + "people/me"},
+	// Google+ API requests get the fields parameter.
+	RoundTripTest{fields: "id,displayName", in: endpoint.PlusBaseURL + "people/me", out: endpoint.PlusBaseURL + "people/me?fields=id%2CdisplayName"},
+	RoundTripTest{fields: "nextPageToken", in: endpoint.PlusBaseURL + "people?query=Larry", out: endpoint.PlusBaseURL + "people?query=Larry&fields=nextPageToken"},
+	// Other requests are unchanged.
+	RoundTripTest{fields: "id", in: endpoint.GoogleTokenInfoURL, out: endpoint.GoogleTokenInfoURL},
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, r := range RoundTripTests {
+		fake := &urlRoundTripper{}
+		transport := &Transport{Fields: r.fields, Transport: fake}
+
+		req, err := http.NewRequest("GET", r.in, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Error(err)
+			continue
+		}
+		if fake.url != r.out {
+			t.Errorf("fields %q and URL %q expected %q but got %q", r.fields, r.in, r.out, fake.url)
+		}
+		if req.URL.String() != r.in {
+			t.Errorf("the original request was modified: %q", req.URL.String())
+		}
+	}
+}
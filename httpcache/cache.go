@@ -0,0 +1,148 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpcache
+
+import (
+	"container/list"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Cache is the storage used by a Transport. Keys are hex strings of at most 40
+// characters, so they are safe to use as file names or memcache keys. Values
+// are opaque.
+//
+// Implementations must be safe for use by multiple goroutines. Errors should
+// be treated as cache misses, which is why the methods don't return them.
+type Cache interface {
+	// Get returns the value stored under key, and whether it was found.
+	Get(key string) ([]byte, bool)
+	// Set stores value under key.
+	Set(key string, value []byte)
+	// Delete removes the value stored under key, if any.
+	Delete(key string)
+}
+
+// MemoryCache is a Cache that keeps up to a fixed number of values in memory,
+// evicting the least recently used ones.
+type MemoryCache struct {
+	maxEntries int
+
+	mu      sync.Mutex
+	lru     *list.List // of *memoryEntry, most recently used first
+	entries map[string]*list.Element
+}
+
+type memoryEntry struct {
+	key   string
+	value []byte
+}
+
+// NewMemoryCache returns a MemoryCache holding at most maxEntries values.
+func NewMemoryCache(maxEntries int) *MemoryCache {
+	return &MemoryCache{
+		maxEntries: maxEntries,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+	}
+}
+
+func (c *MemoryCache) Get(key string) ([]byte, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	e, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.lru.MoveToFront(e)
+	return e.Value.(*memoryEntry).value, true
+}
+
+func (c *MemoryCache) Set(key string, value []byte) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		e.Value.(*memoryEntry).value = value
+		c.lru.MoveToFront(e)
+		return
+	}
+	c.entries[key] = c.lru.PushFront(&memoryEntry{key, value})
+
+	for c.maxEntries > 0 && c.lru.Len() > c.maxEntries {
+		e := c.lru.Back()
+		c.lru.Remove(e)
+		c.entries[e.Value.(*memoryEntry).key] = nil, false
+	}
+}
+
+func (c *MemoryCache) Delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if e, ok := c.entries[key]; ok {
+		c.lru.Remove(e)
+		c.entries[key] = nil, false
+	}
+}
+
+// DiskCache is a Cache that stores each value in a file in a directory, so
+// that it survives across runs of a command-line program.
+type DiskCache struct {
+	dir string
+}
+
+// NewDiskCache returns a DiskCache storing its files in dir, which is created
+// if necessary.
+func NewDiskCache(dir string) (*DiskCache, os.Error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	return &DiskCache{dir}, nil
+}
+
+func (c *DiskCache) Get(key string) ([]byte, bool) {
+	value, err := ioutil.ReadFile(filepath.Join(c.dir, key))
+	if err != nil {
+		return nil, false
+	}
+	return value, true
+}
+
+// Set writes value to a temporary file and renames it, so that concurrent
+// readers never see a partially written value.
+func (c *DiskCache) Set(key string, value []byte) {
+	f, err := ioutil.TempFile(c.dir, "tmp")
+	if err != nil {
+		return
+	}
+	_, err = f.Write(value)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filepath.Join(c.dir, key))
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+}
+
+func (c *DiskCache) Delete(key string) {
+	os.Remove(filepath.Join(c.dir, key))
+}
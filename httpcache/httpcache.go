@@ -0,0 +1,353 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The httpcache package provides an HTTP transport that caches responses from
+// Google APIs, honoring their ETag and Cache-Control headers.
+//
+// Example usage:
+// 	t := &noauth.Transport{
+// 		APIKey:    YOUR_API_KEY,
+// 		Transport: &httpcache.Transport{Cache: httpcache.NewMemoryCache(100)},
+// 	}
+// 	c := t.Client()
+//
+// The Transport should be placed underneath the noauth or oauth transport, so
+// that it sees the final request. The "key" querystring parameter is ignored
+// when computing cache keys, while the Authorization header is taken into
+// account, so users never see each other's cached resources.
+package httpcache
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"http"
+	"io/ioutil"
+	"json"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+	"url"
+
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+// now returns the current time in nanoseconds. It is replaced in tests.
+var now = time.Nanoseconds
+
+// Stats counts how requests were served by one or more Transports. It is safe
+// for use by multiple goroutines.
+type Stats struct {
+	// Hits is the number of requests served from the cache without contacting
+	// the server.
+	Hits int64
+	// Revalidations is the number of requests served from the cache after
+	// the server answered 304 Not Modified.
+	Revalidations int64
+	// Misses is the number of cacheable requests for which the server sent a
+	// full response.
+	Misses int64
+}
+
+// Snapshot returns a copy of s that is safe to read.
+func (s *Stats) Snapshot() Stats {
+	return Stats{
+		Hits:          atomic.AddInt64(&s.Hits, 0),
+		Revalidations: atomic.AddInt64(&s.Revalidations, 0),
+		Misses:        atomic.AddInt64(&s.Misses, 0),
+	}
+}
+
+// hit, revalidated and missed may be called on a nil *Stats.
+func (s *Stats) hit() {
+	if s != nil {
+		atomic.AddInt64(&s.Hits, 1)
+	}
+}
+
+func (s *Stats) revalidated() {
+	if s != nil {
+		atomic.AddInt64(&s.Revalidations, 1)
+	}
+}
+
+func (s *Stats) missed() {
+	if s != nil {
+		atomic.AddInt64(&s.Misses, 1)
+	}
+}
+
+func (s Stats) String() string {
+	total := s.Hits + s.Revalidations + s.Misses
+	ratio := 0.0
+	if total > 0 {
+		ratio = 100 * float64(s.Hits+s.Revalidations) / float64(total)
+	}
+	return fmt.Sprintf("%d hits, %d revalidations, %d misses (%.0f%% served from cache)",
+		s.Hits, s.Revalidations, s.Misses, ratio)
+}
+
+// Transport implements http.RoundTripper. It serves GET requests from its
+// Cache while the cached response is fresh according to its max-age, and
+// revalidates stale responses with an If-None-Match request, serving the
+// cached copy when the server answers 304 Not Modified.
+//
+// Responses served from the cache have an "X-From-Cache: 1" header.
+type Transport struct {
+	// Cache stores the responses. If nil, requests are not cached.
+	Cache Cache
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+	// Stats, if not nil, counts cache hits and misses. It can be shared by
+	// many Transports.
+	Stats *Stats
+
+	mu   sync.Mutex
+	sent map[*http.Request]*http.Request // The requests being revalidated.
+}
+
+// Client returns an *http.Client that caches responses.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// entry is the cached form of a response.
+type entry struct {
+	Status     string
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// Expires is the time in nanoseconds until which the entry is fresh.
+	Expires int64
+}
+
+func (e *entry) response(req *http.Request) *http.Response {
+	header := make(http.Header)
+	for k, v := range e.Header {
+		header[k] = v
+	}
+	header.Set("X-From-Cache", "1")
+	return &http.Response{
+		Status:        e.Status,
+		StatusCode:    e.StatusCode,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          ioutil.NopCloser(bytes.NewBuffer(e.Body)),
+		ContentLength: int64(len(e.Body)),
+		Request:       req,
+	}
+}
+
+// RoundTrip executes a single HTTP transaction, unless a fresh response is
+// available in the Cache.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	if t.Cache == nil || req.Method != "GET" || len(req.Header.Get("Range")) > 0 {
+		return t.transport().RoundTrip(req)
+	}
+
+	key := cacheKey(req)
+	var cached *entry
+	if data, ok := t.Cache.Get(key); ok {
+		cached = &entry{}
+		if json.Unmarshal(data, cached) != nil {
+			cached = nil
+		}
+	}
+
+	if cached != nil && now() < cached.Expires && !noCache(req.Header) {
+		t.Stats.hit()
+		return cached.response(req), nil
+	}
+
+	// Ask the server whether the cached response is still valid.
+	newReq := req
+	if etag := cachedHeader(cached, "Etag"); len(etag) > 0 {
+		newReq = new(http.Request)
+		*newReq = *req
+		newReq.Header = make(http.Header)
+		for k, v := range req.Header {
+			newReq.Header[k] = v
+		}
+		newReq.Header.Set("If-None-Match", etag)
+	}
+
+	t.mu.Lock()
+	if t.sent == nil {
+		t.sent = make(map[*http.Request]*http.Request)
+	}
+	t.sent[req] = newReq
+	t.mu.Unlock()
+	resp, err := t.transport().RoundTrip(newReq)
+	t.mu.Lock()
+	t.sent[req] = nil, false
+	t.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusNotModified && cached != nil && newReq != req {
+		resp.Body.Close()
+		t.Stats.revalidated()
+
+		// Refresh the cached response with the new validators and freshness.
+		for _, h := range []string{"Cache-Control", "Date", "Etag", "Expires"} {
+			if v := resp.Header.Get(h); len(v) > 0 {
+				cached.Header.Set(h, v)
+			}
+		}
+		cached.Expires = expires(cached.Header)
+		t.store(key, cached)
+		return cached.response(req), nil
+	}
+
+	t.Stats.missed()
+	if resp.StatusCode != http.StatusOK || !storable(resp.Header) {
+		if cached != nil && resp.StatusCode == http.StatusOK {
+			t.Cache.Delete(key)
+		}
+		return resp, nil
+	}
+
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+
+	t.store(key, &entry{
+		Status:     resp.Status,
+		StatusCode: resp.StatusCode,
+		Header:     resp.Header,
+		Body:       body,
+		Expires:    expires(resp.Header),
+	})
+	return resp, nil
+}
+
+// CancelRequest cancels req if the Transport can cancel the request sent for
+// it, e.g. while it waits for a ratelimit.Transport.
+func (t *Transport) CancelRequest(req *http.Request) {
+	t.mu.Lock()
+	sent, ok := t.sent[req]
+	t.mu.Unlock()
+	if !ok {
+		sent = req
+	}
+	if c, isCanceler := t.transport().(noauth.Canceler); isCanceler {
+		c.CancelRequest(sent)
+	}
+}
+
+func (t *Transport) store(key string, e *entry) {
+	if data, err := json.Marshal(e); err == nil {
+		t.Cache.Set(key, data)
+	}
+}
+
+// cacheKey returns the key under which the response to req is cached. It is
+// derived from the URL, minus the API key and with the querystring sorted, and
+// from the Authorization header.
+func cacheKey(req *http.Request) string {
+	u := *req.URL
+	q := u.Query()
+	q.Del("key")
+	u.RawQuery = sortedQuery(q)
+
+	h := sha1.New()
+	fmt.Fprintf(h, "%s\n%s\n%s", req.Method, u.String(), req.Header.Get("Authorization"))
+	return hex.EncodeToString(h.Sum())
+}
+
+func sortedQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, url.QueryEscape(k)+"="+url.QueryEscape(v))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+func cachedHeader(e *entry, name string) string {
+	if e == nil {
+		return ""
+	}
+	return e.Header.Get(name)
+}
+
+// cacheControl parses the Cache-Control header into a map of directives.
+func cacheControl(h http.Header) map[string]string {
+	directives := make(map[string]string)
+	for _, part := range strings.Split(h.Get("Cache-Control"), ",") {
+		part = strings.TrimSpace(part)
+		if len(part) == 0 {
+			continue
+		}
+		if i := strings.Index(part, "="); i >= 0 {
+			directives[strings.ToLower(part[:i])] = strings.Trim(part[i+1:], `"`)
+		} else {
+			directives[strings.ToLower(part)] = ""
+		}
+	}
+	return directives
+}
+
+// noCache reports whether the request asks not to be served from the cache.
+func noCache(h http.Header) bool {
+	_, ok := cacheControl(h)["no-cache"]
+	return ok
+}
+
+// storable reports whether a response with header h may be cached.
+func storable(h http.Header) bool {
+	_, ok := cacheControl(h)["no-store"]
+	return !ok
+}
+
+// expires returns the time in nanoseconds until which a response with header
+// h is fresh.
+func expires(h http.Header) int64 {
+	cc := cacheControl(h)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if v, ok := cc["max-age"]; ok {
+		if secs, err := strconv.Atoi64(v); err == nil && secs > 0 {
+			return now() + secs*1e9
+		}
+	}
+	return 0
+}
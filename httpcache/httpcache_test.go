@@ -0,0 +1,172 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package httpcache
+
+import (
+	"http"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// etagServer answers like the Google+ API: with an ETag, and with 304 Not
+// Modified when the request's If-None-Match matches it.
+type etagServer struct {
+	etag, cacheControl, body string
+	requests                 []*http.Request
+}
+
+func (s *etagServer) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	s.requests = append(s.requests, req)
+	resp := &http.Response{
+		StatusCode: 200,
+		Status:     "200 OK",
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(s.body)),
+	}
+	resp.Header.Set("ETag", s.etag)
+	resp.Header.Set("Cache-Control", s.cacheControl)
+	if req.Header.Get("If-None-Match") == s.etag {
+		resp.StatusCode = http.StatusNotModified
+		resp.Status = "304 Not Modified"
+		resp.Body = ioutil.NopCloser(strings.NewReader(""))
+	}
+	return resp, nil
+}
+
+func fetch(t *testing.T, transport http.RoundTripper, rawurl, authorization string) (string, bool) {
+	req, err := http.NewRequest("GET", rawurl, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(authorization) > 0 {
+		req.Header.Set("Authorization", authorization)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(body), resp.Header.Get("X-From-Cache") == "1"
+}
+
+func TestTransport(t *testing.T) {
+	var clock int64
+	now = func() int64 { return clock }
+	defer func() { now = time.Nanoseconds }()
+
+	server := &etagServer{etag: `"v1"`, cacheControl: "private, max-age=60", body: "one"}
+	stats := &Stats{}
+	transport := &Transport{
+		Cache:     NewMemoryCache(10),
+		Transport: server,
+		Stats:     stats,
+	}
+	const u = "https://www.googleapis.com/plus/v1/people/me?alt=json&key=abc"
+
+	// Miss.
+	if body, cached := fetch(t, transport, u, ""); body != "one" || cached {
+		t.Errorf("first request: got %q (cached: %v)", body, cached)
+	}
+
+	// Fresh hit, even with a different API key and querystring order.
+	clock += 30e9
+	if body, cached := fetch(t, transport, "https://www.googleapis.com/plus/v1/people/me?key=def&alt=json", ""); body != "one" || !cached {
+		t.Errorf("fresh request: got %q (cached: %v)", body, cached)
+	}
+	if len(server.requests) != 1 {
+		t.Errorf("expected the fresh request to be served from cache, sent %d requests", len(server.requests))
+	}
+
+	// Stale: revalidated with If-None-Match, server answers 304.
+	clock += 60e9
+	if body, cached := fetch(t, transport, u, ""); body != "one" || !cached {
+		t.Errorf("revalidated request: got %q (cached: %v)", body, cached)
+	}
+	if got := server.requests[1].Header.Get("If-None-Match"); got != `"v1"` {
+		t.Errorf("expected If-None-Match %q but got %q", `"v1"`, got)
+	}
+
+	// Stale and changed: the new response replaces the cached one.
+	clock += 120e9
+	server.etag, server.body = `"v2"`, "two"
+	if body, cached := fetch(t, transport, u, ""); body != "two" || cached {
+		t.Errorf("changed request: got %q (cached: %v)", body, cached)
+	}
+
+	// Other users don't see the cached response.
+	if body, cached := fetch(t, transport, u, "Bearer xyz"); body != "two" || cached {
+		t.Errorf("other user's request: got %q (cached: %v)", body, cached)
+	}
+
+	got := stats.Snapshot()
+	if got.Hits != 1 || got.Revalidations != 1 || got.Misses != 3 {
+		t.Errorf("expected 1 hit, 1 revalidation and 3 misses but got %+v", got)
+	}
+}
+
+func TestNoStore(t *testing.T) {
+	server := &etagServer{etag: `"v1"`, cacheControl: "no-store", body: "one"}
+	transport := &Transport{Cache: NewMemoryCache(10), Transport: server}
+
+	fetch(t, transport, "https://www.example.com/", "")
+	fetch(t, transport, "https://www.example.com/", "")
+	if got := server.requests[1].Header.Get("If-None-Match"); len(got) > 0 {
+		t.Errorf("expected no-store response not to be cached, got If-None-Match %q", got)
+	}
+}
+
+func TestMemoryCacheEviction(t *testing.T) {
+	c := NewMemoryCache(2)
+	c.Set("a", []byte("1"))
+	c.Set("b", []byte("2"))
+	c.Get("a")
+	c.Set("c", []byte("3"))
+
+	if _, ok := c.Get("b"); ok {
+		t.Error("expected least recently used entry b to be evicted")
+	}
+	for _, key := range []string{"a", "c"} {
+		if _, ok := c.Get(key); !ok {
+			t.Errorf("expected entry %s to be cached", key)
+		}
+	}
+}
+
+func TestDiskCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "httpcache")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	c, err := NewDiskCache(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Set("a", []byte("1"))
+	if v, ok := c.Get("a"); !ok || string(v) != "1" {
+		t.Errorf("expected %q but got %q (found: %v)", "1", v, ok)
+	}
+	c.Delete("a")
+	if _, ok := c.Get("a"); ok {
+		t.Error("expected entry to be deleted")
+	}
+}
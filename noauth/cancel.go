@@ -0,0 +1,86 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package noauth
+
+import (
+	"http"
+	"os"
+	"sync"
+)
+
+// ErrCanceled is returned when a request is canceled between two attempts.
+var ErrCanceled = os.NewError("noauth: request canceled")
+
+// Canceler is implemented by transports which can cancel the requests they
+// are sending, such as ratelimit.Transport. Transports which wrap another
+// transport forward CancelRequest to it when it is a Canceler.
+type Canceler interface {
+	CancelRequest(req *http.Request)
+}
+
+// inflight tracks the requests a transport is sending, so that they can be
+// canceled. Each request is mapped to the request actually sent for it, which
+// is a copy when the transport changes it.
+type inflight struct {
+	mu       sync.Mutex
+	sent     map[*http.Request]*http.Request
+	canceled map[*http.Request]bool
+}
+
+// start records that sent is being sent for req.
+func (f *inflight) start(req, sent *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.sent == nil {
+		f.sent = make(map[*http.Request]*http.Request)
+		f.canceled = make(map[*http.Request]bool)
+	}
+	f.sent[req] = sent
+}
+
+// done forgets req once it has been sent.
+func (f *inflight) done(req *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sent[req] = nil, false
+	f.canceled[req] = false, false
+}
+
+// isCanceled reports whether req was canceled while it was being sent, in
+// which case it mustn't be sent again.
+func (f *inflight) isCanceled(req *http.Request) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.canceled[req]
+}
+
+// cancel marks req as canceled and cancels the request sent for it in
+// transport, if transport can cancel requests. It has no effect if req isn't
+// being sent.
+func (f *inflight) cancel(req *http.Request, transport http.RoundTripper) {
+	f.mu.Lock()
+	sent, ok := f.sent[req]
+	if ok {
+		f.canceled[req] = true
+	}
+	f.mu.Unlock()
+
+	if c, isCanceler := transport.(Canceler); ok && isCanceler {
+		c.CancelRequest(sent)
+	}
+}
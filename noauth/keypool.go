@@ -0,0 +1,178 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package noauth
+
+import (
+	"http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrNoKeys is returned by Transport.RoundTrip when every key in its KeyPool
+// is benched because it exhausted its quota.
+var ErrNoKeys = os.NewError("all API keys have exhausted their quota")
+
+// quotaReasons are the error reasons of 403 responses for which a KeyPool
+// benches the key.
+var quotaReasons = []string{"dailyLimitExceeded", "userRateLimitExceeded"}
+
+// Key describes one API key in a KeyPool.
+type Key struct {
+	// Key is the simple API access key.
+	Key string
+	// Weight is the relative share of requests sent with this key. It will
+	// default to 1 if not positive.
+	Weight int
+}
+
+// KeyStats reports the usage of one key in a KeyPool.
+type KeyStats struct {
+	Key    string
+	Weight int
+	// Requests is the number of requests sent with the key.
+	Requests int64
+	// Errors is the number of requests that failed, either with a transport
+	// error or with a non-2xx response.
+	Errors int64
+	// QuotaErrors is the number of requests rejected because the key's quota
+	// was exhausted.
+	QuotaErrors int64
+	// BenchedUntil is the time (in seconds since the epoch) until which the
+	// key won't be used, or 0 if it is available.
+	BenchedUntil int64
+}
+
+type pooledKey struct {
+	KeyStats
+	// current is the key's running weight for smooth weighted round robin.
+	current int
+}
+
+// KeyPool is a set of API keys that a Transport rotates between. Keys are used
+// in weighted round robin order; with equal weights, this is plain round
+// robin. A key whose quota is exhausted (a 403 response with the
+// dailyLimitExceeded or userRateLimitExceeded reason) is benched until its
+// quota window resets, and the request is sent again with another key.
+//
+// A KeyPool is safe for use by multiple goroutines, so it can be shared by
+// many Transports.
+type KeyPool struct {
+	// RateLimitWindow is how long (in nanoseconds) a key is benched after a
+	// userRateLimitExceeded error. It will default to 100 seconds, the
+	// Google APIs per-user quota window, if zero.
+	RateLimitWindow int64
+
+	mu   sync.Mutex
+	keys []*pooledKey
+}
+
+// NewKeyPool returns a KeyPool that rotates between keys.
+func NewKeyPool(keys ...Key) *KeyPool {
+	p := &KeyPool{}
+	for _, k := range keys {
+		if k.Weight <= 0 {
+			k.Weight = 1
+		}
+		p.keys = append(p.keys, &pooledKey{KeyStats: KeyStats{Key: k.Key, Weight: k.Weight}})
+	}
+	return p
+}
+
+// Stats returns a snapshot of the usage counters of every key in the pool, in
+// the order the keys were given to NewKeyPool.
+func (p *KeyPool) Stats() []KeyStats {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Seconds()
+	stats := make([]KeyStats, len(p.keys))
+	for i, k := range p.keys {
+		stats[i] = k.KeyStats
+		if stats[i].BenchedUntil <= now {
+			stats[i].BenchedUntil = 0
+		}
+	}
+	return stats
+}
+
+// pick returns the next key to use, or ErrNoKeys if all keys are benched.
+func (p *KeyPool) pick() (*pooledKey, os.Error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Seconds()
+	var best *pooledKey
+	total := 0
+	for _, k := range p.keys {
+		if k.BenchedUntil > now {
+			continue
+		}
+		k.current += k.Weight
+		total += k.Weight
+		if best == nil || k.current > best.current {
+			best = k
+		}
+	}
+	if best == nil {
+		return nil, ErrNoKeys
+	}
+	best.current -= total
+	best.Requests++
+	return best, nil
+}
+
+// record updates k's counters with the outcome of a request and benches k if
+// its quota is exhausted. It reports whether k was benched, in which case the
+// request should be sent again with another key.
+func (p *KeyPool) record(k *pooledKey, resp *http.Response, err os.Error) bool {
+	var reason string
+	if err == nil && resp != nil && resp.StatusCode == http.StatusForbidden {
+		reason = errorReason(resp)
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if err != nil || resp == nil || resp.StatusCode/100 != 2 {
+		k.Errors++
+	}
+
+	switch reason {
+	case "dailyLimitExceeded":
+		k.BenchedUntil = nextQuotaDay(time.Seconds())
+	case "userRateLimitExceeded":
+		window := p.RateLimitWindow
+		if window == 0 {
+			window = 100e9
+		}
+		k.BenchedUntil = time.Seconds() + (window+1e9-1)/1e9
+	default:
+		return false
+	}
+	k.QuotaErrors++
+	return true
+}
+
+// nextQuotaDay returns the time (in seconds since the epoch) at which daily
+// quotas next reset. Google API daily quotas reset at midnight Pacific Time;
+// this uses Pacific Standard Time, so during daylight saving time keys are
+// benched an hour longer than necessary.
+func nextQuotaDay(now int64) int64 {
+	const offset = -8 * 60 * 60
+	const day = 24 * 60 * 60
+	local := now + offset
+	return (local/day+1)*day - offset
+}
@@ -0,0 +1,169 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package noauth
+
+import (
+	"http"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// quotaRoundTripper rejects requests made with an over-quota key.
+type quotaRoundTripper struct {
+	// reasons maps keys to the quota error reason returned for them.
+	reasons map[string]string
+	// keys records the key used by each request.
+	keys []string
+}
+
+func (t *quotaRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	key := req.URL.Query().Get("key")
+	t.keys = append(t.keys, key)
+
+	code, body := 200, "{}"
+	if reason, ok := t.reasons[key]; ok {
+		code = 403
+		body = `{"error":{"errors":[{"reason":"` + reason + `"}],"code":403}}`
+	}
+	return &http.Response{
+		StatusCode: code,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+	}, nil
+}
+
+func get(t *testing.T, transport http.RoundTripper) *http.Response {
+	req, err := http.NewRequest("GET", "https://www.example.com/?query=foo", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resp
+}
+
+func TestKeyPoolRoundRobin(t *testing.T) {
+	fake := &quotaRoundTripper{}
+	transport := &Transport{
+		Keys:      NewKeyPool(Key{Key: "a"}, Key{Key: "b"}, Key{Key: "c", Weight: 2}),
+		Transport: fake,
+	}
+	for i := 0; i < 8; i++ {
+		get(t, transport)
+	}
+
+	expected := "c,a,b,c,c,a,b,c"
+	if got := strings.Join(fake.keys, ","); got != expected {
+		t.Errorf("expected keys %s but got %s", expected, got)
+	}
+
+	stats := transport.Keys.Stats()
+	for i, requests := range []int64{2, 2, 4} {
+		if stats[i].Requests != requests {
+			t.Errorf("key %s: expected %d requests but got %d", stats[i].Key, requests, stats[i].Requests)
+		}
+	}
+}
+
+func TestKeyPoolFailover(t *testing.T) {
+	fake := &quotaRoundTripper{reasons: map[string]string{
+		"a": "dailyLimitExceeded",
+		"b": "userRateLimitExceeded",
+	}}
+	transport := &Transport{
+		Keys:      NewKeyPool(Key{Key: "a"}, Key{Key: "b"}, Key{Key: "c"}),
+		Transport: fake,
+	}
+
+	// The first request fails over from a to b to c.
+	if resp := get(t, transport); resp.StatusCode != 200 {
+		t.Errorf("expected status 200 but got %d", resp.StatusCode)
+	}
+	// a and b are benched, so only c is used from now on.
+	get(t, transport)
+	expected := "a,b,c,c"
+	if got := strings.Join(fake.keys, ","); got != expected {
+		t.Errorf("expected keys %s but got %s", expected, got)
+	}
+
+	stats := transport.Keys.Stats()
+	for i, s := range stats[:2] {
+		if s.QuotaErrors != 1 || s.BenchedUntil == 0 {
+			t.Errorf("key %d: expected to be benched after 1 quota error, got %+v", i, s)
+		}
+	}
+	if stats[2].BenchedUntil != 0 || stats[2].Requests != 2 {
+		t.Errorf("key 2: expected 2 requests and no bench, got %+v", stats[2])
+	}
+}
+
+func TestKeyPoolFailoverWithRetry(t *testing.T) {
+	var sleeps []int64
+	sleep = func(ns int64) { sleeps = append(sleeps, ns) }
+
+	fake := &quotaRoundTripper{reasons: map[string]string{"a": "userRateLimitExceeded"}}
+	transport := &Transport{
+		Keys:      NewKeyPool(Key{Key: "a"}, Key{Key: "b"}),
+		Transport: fake,
+		Retry:     DefaultRetryPolicy,
+	}
+
+	// The quota error switches to b on the second attempt, without backing off
+	// and retrying with a.
+	if resp := get(t, transport); resp.StatusCode != 200 {
+		t.Errorf("expected status 200 but got %d", resp.StatusCode)
+	}
+	expected := "a,b"
+	if got := strings.Join(fake.keys, ","); got != expected {
+		t.Errorf("expected keys %s but got %s", expected, got)
+	}
+	if len(sleeps) != 0 {
+		t.Errorf("expected no sleeps but got %v", sleeps)
+	}
+}
+
+func TestKeyPoolExhausted(t *testing.T) {
+	fake := &quotaRoundTripper{reasons: map[string]string{"a": "dailyLimitExceeded"}}
+	transport := &Transport{
+		Keys:      NewKeyPool(Key{Key: "a"}),
+		Transport: fake,
+	}
+
+	// The API's quota error is returned when the last key is benched...
+	if resp := get(t, transport); resp.StatusCode != 403 {
+		t.Errorf("expected status 403 but got %d", resp.StatusCode)
+	}
+
+	// ...and ErrNoKeys afterwards, without sending the request.
+	req, _ := http.NewRequest("GET", "https://www.example.com/", nil)
+	if _, err := transport.RoundTrip(req); err != ErrNoKeys {
+		t.Errorf("expected ErrNoKeys but got %v", err)
+	}
+	if len(fake.keys) != 1 {
+		t.Errorf("expected 1 request but sent %d", len(fake.keys))
+	}
+}
+
+func TestNextQuotaDay(t *testing.T) {
+	// 2011-10-01 12:00:00 PDT is 2011-10-01 19:00:00 UTC (1317495600). The next
+	// reset is at 2011-10-02 00:00:00 PST, i.e. 08:00:00 UTC (1317542400).
+	if got := nextQuotaDay(1317495600); got != 1317542400 {
+		t.Errorf("expected 1317542400 but got %d", got)
+	}
+}
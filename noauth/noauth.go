@@ -25,6 +25,7 @@ package noauth
 import (
 	"http"
 	"os"
+	"url"
 )
 
 // Transport implements http.RoundTripper. When configured with a valid API key,
@@ -39,10 +40,20 @@ type Transport struct {
 	// APIKey is your unique simple API access key from
 	// https://code.google.com/apis/console > API Access > Simple API Access
 	APIKey string
+	// Keys, if not nil, is a pool of API keys used instead of APIKey. The
+	// Transport rotates between the keys and fails over to another key when
+	// one exhausts its quota.
+	Keys *KeyPool
 	// Transport is the HTTP transport to use when making requests.
 	// It will default to http.DefaultTransport if nil.
 	// (It should never be a noauth.Transport.)
 	Transport http.RoundTripper
+	// Retry is the policy used to retry failed requests, e.g. when the API
+	// returns a 5xx response or a rateLimitExceeded error. If nil, every
+	// request is sent exactly once.
+	Retry *RetryPolicy
+
+	pending inflight
 }
 
 // Client returns an *http.Client that can make unauthenticated requests to
@@ -60,18 +71,81 @@ func (t *Transport) transport() http.RoundTripper {
 	return http.DefaultTransport
 }
 
-// RoundTrip executes a single HTTP transaction appending the Transport's API
-// key as a querystring parameter.
+// RoundTrip executes an HTTP transaction appending the Transport's API key as a
+// querystring parameter. Failed transactions are retried according to the
+// Transport's Retry policy.
+//
+// If the Transport has a KeyPool, the key is picked from the pool and the
+// transaction is sent again with the next key whenever a key turns out to be
+// over quota. Quota errors then fail over right away instead of being retried
+// with the same key.
 func (t *Transport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	if t.Keys != nil {
+		return t.roundTripPool(req)
+	}
 	if t.APIKey == "" {
 		return nil, os.NewError("No APIKey supplied")
 	}
 
 	newReq := *req
 	u := newReq.URL
-	q := u.Query()
-	q.Add("key", t.APIKey)
-	u.RawQuery = q.Encode()
+	u.RawQuery = addKey(u.RawQuery, t.APIKey)
+
+	t.pending.start(req, &newReq)
+	defer t.pending.done(req)
+	return roundTrip(t.Retry, t.transport(), &newReq, func() bool {
+		return t.pending.isCanceled(req)
+	})
+}
+
+func (t *Transport) roundTripPool(req *http.Request) (*http.Response, os.Error) {
+	newReq := *req
+	u := newReq.URL
+	query := u.RawQuery
+	policy := t.Retry.without(quotaReasons)
+	canceled := func() bool {
+		return t.pending.isCanceled(req)
+	}
+	t.pending.start(req, &newReq)
+	defer t.pending.done(req)
+
+	var lastResp *http.Response
+	for {
+		k, err := t.Keys.pick()
+		if err != nil {
+			// Every key is benched. Return the last quota error from the API, if
+			// any, so the caller sees the real reason.
+			if lastResp != nil {
+				return lastResp, nil
+			}
+			return nil, err
+		}
+
+		u.RawQuery = addKey(query, k.Key)
+		resp, err := roundTrip(policy, t.transport(), &newReq, canceled)
+		if !t.Keys.record(k, resp, err) || !idempotent(req) || canceled() {
+			return resp, err
+		}
+
+		// The key is over quota; discard the response and try the next key.
+		if lastResp != nil {
+			lastResp.Body.Close()
+		}
+		lastResp = resp
+	}
+	panic("unreachable")
+}
+
+// CancelRequest cancels req if the transport of t can cancel the request sent
+// for it, e.g. while it waits for a ratelimit.Transport. req isn't retried
+// afterwards.
+func (t *Transport) CancelRequest(req *http.Request) {
+	t.pending.cancel(req, t.transport())
+}
 
-	return t.transport().RoundTrip(&newReq)
+// addKey appends the API key to the encoded query string.
+func addKey(rawQuery, key string) string {
+	q, _ := url.ParseQuery(rawQuery)
+	q.Add("key", key)
+	return q.Encode()
 }
@@ -84,3 +84,77 @@ func TestRoundTrip(t *testing.T) {
 		}
 	}
 }
+
+// blockingRoundTripper blocks every request until CancelRequest is called.
+type blockingRoundTripper struct {
+	started  chan *http.Request
+	cancel   chan bool
+	canceled *http.Request
+	calls    int
+}
+
+func (t *blockingRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	t.calls++
+	t.started <- req
+	<-t.cancel
+	return nil, os.NewError("canceled")
+}
+
+func (t *blockingRoundTripper) CancelRequest(req *http.Request) {
+	t.canceled = req
+	close(t.cancel)
+}
+
+func TestCancelRequest(t *testing.T) {
+	fake := &blockingRoundTripper{started: make(chan *http.Request), cancel: make(chan bool)}
+	transport := &Transport{
+		APIKey:    "abc",
+		Transport: fake,
+		Retry:     DefaultRetryPolicy,
+	}
+
+	req, err := http.NewRequest("GET", "https://www.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan os.Error)
+	go func() {
+		_, err := transport.RoundTrip(req)
+		done <- err
+	}()
+
+	// The copy of req that was sent is canceled, and isn't retried.
+	sent := <-fake.started
+	transport.CancelRequest(req)
+	if err := <-done; err == nil {
+		t.Error("expected an error")
+	}
+	if fake.canceled != sent || sent == req {
+		t.Errorf("expected the sent copy of the request to be canceled, got %v", fake.canceled)
+	}
+	if fake.calls != 1 {
+		t.Errorf("expected 1 request but sent %d", fake.calls)
+	}
+}
+
+func TestRoundTripReusesTransport(t *testing.T) {
+	transport := &Transport{
+		APIKey:    "abc",
+		Transport: &fakeRoundTripper{},
+		Retry:     DefaultRetryPolicy,
+	}
+
+	// Requests which aren't canceled are forgotten once they have been sent.
+	for i := 0; i < 3; i++ {
+		req, err := http.NewRequest("GET", "https://www.example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := transport.RoundTrip(req); err != nil {
+			t.Errorf("request %d: %v", i, err)
+		}
+	}
+	if n := len(transport.pending.sent); n != 0 {
+		t.Errorf("expected no pending requests but got %d", n)
+	}
+}
@@ -0,0 +1,284 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package noauth
+
+import (
+	"bytes"
+	"http"
+	"io/ioutil"
+	"json"
+	"os"
+	"rand"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RetryPolicy describes when and how often a failed request to a Google API is
+// retried. All durations are in nanoseconds.
+//
+// Only requests using an idempotent method (GET, HEAD, PUT, DELETE, OPTIONS)
+// and without a body are retried, since a consumed body cannot be replayed.
+// A request is retried if the underlying transport returned an error, if the
+// response has a 5xx or 429 status code, or if it is a 403 response whose
+// error reason is listed in RetryableReasons.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of times a request is sent, including
+	// the first attempt. Values less than 2 disable retrying.
+	MaxAttempts int
+	// InitialBackoff is the delay before the first retry.
+	InitialBackoff int64
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff int64
+	// Multiplier is the factor by which the delay grows after each attempt.
+	// It will default to 2 if not positive.
+	Multiplier float64
+	// Jitter is the fraction (between 0 and 1) of each delay that is
+	// randomized, so that many clients failing at once don't retry in
+	// lockstep.
+	Jitter float64
+	// MaxRetryAfter is the longest Retry-After delay that will be honored.
+	// If the server asks for a longer wait, the response is returned as is.
+	// Zero means any Retry-After delay is honored.
+	MaxRetryAfter int64
+	// RetryableReasons lists the googleapi error reasons (the "reason" field
+	// in the JSON error body) of 403 responses that should be retried.
+	RetryableReasons []string
+}
+
+// DefaultRetryPolicy is a reasonable RetryPolicy for the Google+ API.
+var DefaultRetryPolicy = &RetryPolicy{
+	MaxAttempts:      5,
+	InitialBackoff:   500e6,
+	MaxBackoff:       30e9,
+	Multiplier:       2,
+	Jitter:           0.5,
+	MaxRetryAfter:    60e9,
+	RetryableReasons: []string{"rateLimitExceeded", "userRateLimitExceeded", "backendError"},
+}
+
+// Backoff returns the delay before retry number attempt (starting at 1),
+// including jitter.
+func (p *RetryPolicy) Backoff(attempt int) int64 {
+	multiplier := p.Multiplier
+	if multiplier <= 0 {
+		multiplier = 2
+	}
+	d := float64(p.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+			break
+		}
+	}
+	if p.MaxBackoff > 0 && d > float64(p.MaxBackoff) {
+		d = float64(p.MaxBackoff)
+	}
+	if p.Jitter > 0 {
+		d -= d * p.Jitter * rand.Float64()
+	}
+	return int64(d)
+}
+
+// without returns a copy of p whose RetryableReasons leave out reasons, or nil
+// if p is nil.
+func (p *RetryPolicy) without(reasons []string) *RetryPolicy {
+	if p == nil {
+		return nil
+	}
+	q := *p
+	q.RetryableReasons = nil
+	for _, r := range p.RetryableReasons {
+		if !contains(reasons, r) {
+			q.RetryableReasons = append(q.RetryableReasons, r)
+		}
+	}
+	return &q
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
+
+// retryable reports whether resp (or err) describes a failure worth retrying.
+// If resp is a 403 response, its body is read and replaced so that the caller
+// can still consume it.
+func (p *RetryPolicy) retryable(resp *http.Response, err os.Error) bool {
+	if err != nil {
+		return true
+	}
+	if resp == nil {
+		return false
+	}
+	switch {
+	case resp.StatusCode >= 500, resp.StatusCode == 429:
+		return true
+	case resp.StatusCode == http.StatusForbidden:
+		return contains(p.RetryableReasons, errorReason(resp))
+	}
+	return false
+}
+
+// retryAfter returns the delay requested by resp's Retry-After header, or -1
+// if there is none.
+func retryAfter(resp *http.Response) int64 {
+	if resp == nil {
+		return -1
+	}
+	v := resp.Header.Get("Retry-After")
+	if len(v) == 0 {
+		return -1
+	}
+	if secs, err := strconv.Atoi64(v); err == nil {
+		if secs < 0 {
+			return -1
+		}
+		return secs * 1e9
+	}
+	if t, err := time.Parse(http.TimeFormat, v); err == nil {
+		if d := t.Seconds() - time.Seconds(); d > 0 {
+			return d * 1e9
+		}
+		return 0
+	}
+	return -1
+}
+
+// errorReason returns the reason of the first error in a googleapi JSON error
+// response. resp.Body is replaced with an equivalent unread body.
+func errorReason(resp *http.Response) string {
+	if resp.Body == nil {
+		return ""
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	resp.Body = ioutil.NopCloser(bytes.NewBuffer(body))
+	if err != nil {
+		return ""
+	}
+
+	var e struct {
+		Error struct {
+			Errors []struct {
+				Reason string
+			}
+		}
+	}
+	if json.Unmarshal(body, &e) != nil || len(e.Error.Errors) == 0 {
+		return ""
+	}
+	return e.Error.Errors[0].Reason
+}
+
+// idempotent reports whether req can safely be sent more than once.
+func idempotent(req *http.Request) bool {
+	if req.Body != nil {
+		return false
+	}
+	switch strings.ToUpper(req.Method) {
+	case "", "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+// sleep is replaced in tests so that they don't have to wait.
+var sleep = func(ns int64) { time.Sleep(ns) }
+
+// roundTrip sends req using transport, retrying according to policy until
+// canceled returns true. A nil policy sends the request exactly once.
+func roundTrip(policy *RetryPolicy, transport http.RoundTripper, req *http.Request, canceled func() bool) (*http.Response, os.Error) {
+	if policy == nil || policy.MaxAttempts < 2 || !idempotent(req) {
+		return transport.RoundTrip(req)
+	}
+
+	for attempt := 1; ; attempt++ {
+		resp, err := transport.RoundTrip(req)
+		if attempt >= policy.MaxAttempts || !policy.retryable(resp, err) || canceled() {
+			return resp, err
+		}
+
+		delay := retryAfter(resp)
+		if delay < 0 {
+			delay = policy.Backoff(attempt)
+		} else if policy.MaxRetryAfter > 0 && delay > policy.MaxRetryAfter {
+			return resp, err
+		}
+
+		// Discard the failed response before trying again.
+		if resp != nil && resp.Body != nil {
+			resp.Body.Close()
+		}
+		sleep(delay)
+		if canceled() {
+			return nil, ErrCanceled
+		}
+	}
+	panic("unreachable")
+}
+
+// RetryTransport implements http.RoundTripper. It retries failed requests
+// according to its Policy. It can be used to add retries to transports other
+// than noauth.Transport, such as goauth2's oauth.Transport:
+//
+// 	t := &oauth.Transport{
+// 		Config:    config,
+// 		Transport: &noauth.RetryTransport{Policy: noauth.DefaultRetryPolicy},
+// 	}
+type RetryTransport struct {
+	// Policy describes when and how often requests are retried.
+	// It will default to DefaultRetryPolicy if nil.
+	Policy *RetryPolicy
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	pending inflight
+}
+
+func (t *RetryTransport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+func (t *RetryTransport) policy() *RetryPolicy {
+	if t.Policy != nil {
+		return t.Policy
+	}
+	return DefaultRetryPolicy
+}
+
+// RoundTrip executes an HTTP transaction, retrying it according to the
+// Transport's Policy.
+func (t *RetryTransport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	t.pending.start(req, req)
+	defer t.pending.done(req)
+	return roundTrip(t.policy(), t.transport(), req, func() bool {
+		return t.pending.isCanceled(req)
+	})
+}
+
+// CancelRequest cancels req if the Transport can cancel it, e.g. while it
+// waits for a ratelimit.Transport. req isn't retried afterwards.
+func (t *RetryTransport) CancelRequest(req *http.Request) {
+	t.pending.cancel(req, t.transport())
+}
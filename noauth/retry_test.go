@@ -0,0 +1,180 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package noauth
+
+import (
+	"http"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+)
+
+// scriptedRoundTripper returns the responses in its script, one per request.
+type scriptedRoundTripper struct {
+	script []scriptedResponse
+	calls  int
+}
+
+type scriptedResponse struct {
+	code       int
+	retryAfter string
+	body       string
+	err        os.Error
+}
+
+func (t *scriptedRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	s := t.script[t.calls]
+	t.calls++
+	if s.err != nil {
+		return nil, s.err
+	}
+	resp := &http.Response{
+		StatusCode: s.code,
+		Header:     http.Header{},
+		Body:       ioutil.NopCloser(strings.NewReader(s.body)),
+	}
+	if len(s.retryAfter) > 0 {
+		resp.Header.Set("Retry-After", s.retryAfter)
+	}
+	return resp, nil
+}
+
+const rateLimitBody = `{"error":{"errors":[{"reason":"rateLimitExceeded"}],"code":403}}`
+const forbiddenBody = `{"error":{"errors":[{"reason":"forbidden"}],"code":403}}`
+
+type RetryTest struct {
+	method string
+	script []scriptedResponse
+	// The expected number of requests sent and final status code.
+	calls, code int
+	// The expected sleeps between attempts, or nil to not check them.
+	sleeps []int64
+}
+
+var RetryTests = []RetryTest{
+	// Success on the first attempt.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 200}}, calls: 1, code: 200},
+	// 5xx responses are retried.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 503}, {code: 500}, {code: 200}}, calls: 3, code: 200},
+	// Transport errors are retried.
+	RetryTest{method: "GET", script: []scriptedResponse{{err: os.NewError("reset")}, {code: 200}}, calls: 2, code: 200},
+	// Retryable 403 reasons are retried, other 403s aren't.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 403, body: rateLimitBody}, {code: 200}}, calls: 2, code: 200},
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 403, body: forbiddenBody}}, calls: 1, code: 403},
+	// Other 4xx responses are not retried.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 404}}, calls: 1, code: 404},
+	// Non-idempotent methods are never retried.
+	RetryTest{method: "POST", script: []scriptedResponse{{code: 503}}, calls: 1, code: 503},
+	// Give up after MaxAttempts.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 503}, {code: 503}, {code: 503}}, calls: 3, code: 503},
+	// Retry-After is honored...
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 503, retryAfter: "2"}, {code: 200}}, calls: 2, code: 200, sleeps: []int64{2e9}},
+	// ...unless it asks for a longer wait than MaxRetryAfter.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 503, retryAfter: "120"}}, calls: 1, code: 503},
+	// Exponential backoff without jitter.
+	RetryTest{method: "GET", script: []scriptedResponse{{code: 500}, {code: 500}, {code: 200}}, calls: 3, code: 200, sleeps: []int64{1e9, 2e9}},
+}
+
+func TestRetry(t *testing.T) {
+	policy := &RetryPolicy{
+		MaxAttempts:      3,
+		InitialBackoff:   1e9,
+		MaxBackoff:       10e9,
+		Multiplier:       2,
+		MaxRetryAfter:    60e9,
+		RetryableReasons: []string{"rateLimitExceeded"},
+	}
+
+	var sleeps []int64
+	sleep = func(ns int64) { sleeps = append(sleeps, ns) }
+
+	for i, r := range RetryTests {
+		sleeps = nil
+		fake := &scriptedRoundTripper{script: r.script}
+		transport := &Transport{
+			APIKey:    "abc",
+			Transport: fake,
+			Retry:     policy,
+		}
+
+		req, err := http.NewRequest(r.method, "https://www.example.com/", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		resp, err := transport.RoundTrip(req)
+		if err != nil {
+			t.Errorf("test %d: unexpected error: %s", i, err)
+			continue
+		}
+		if fake.calls != r.calls {
+			t.Errorf("test %d: expected %d requests but sent %d", i, r.calls, fake.calls)
+		}
+		if resp.StatusCode != r.code {
+			t.Errorf("test %d: expected status %d but got %d", i, r.code, resp.StatusCode)
+		}
+		if r.sleeps != nil {
+			if len(sleeps) != len(r.sleeps) {
+				t.Errorf("test %d: expected sleeps %v but got %v", i, r.sleeps, sleeps)
+				continue
+			}
+			for j := range sleeps {
+				if sleeps[j] != r.sleeps[j] {
+					t.Errorf("test %d: expected sleeps %v but got %v", i, r.sleeps, sleeps)
+					break
+				}
+			}
+		}
+	}
+}
+
+func TestRetryKeepsErrorBody(t *testing.T) {
+	sleep = func(ns int64) {}
+	fake := &scriptedRoundTripper{script: []scriptedResponse{{code: 403, body: forbiddenBody}}}
+	transport := &RetryTransport{Transport: fake}
+
+	req, err := http.NewRequest("GET", "https://www.example.com/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp, err := transport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The body must still be readable after the reason has been inspected.
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != forbiddenBody {
+		t.Errorf("expected body %q but got %q", forbiddenBody, body)
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	policy := &RetryPolicy{InitialBackoff: 1e9, MaxBackoff: 5e9, Jitter: 0.5}
+	for attempt := 1; attempt <= 10; attempt++ {
+		d := policy.Backoff(attempt)
+		max := int64(1e9) << uint(attempt-1)
+		if max > 5e9 {
+			max = 5e9
+		}
+		if d > max || d < max/2 {
+			t.Errorf("attempt %d: backoff %d not in [%d, %d]", attempt, d, max/2, max)
+		}
+	}
+}
@@ -0,0 +1,360 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plustest
+
+import (
+	"fmt"
+	"http"
+	"json"
+	"strconv"
+	"strings"
+
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+)
+
+// call describes the API request being served.
+type call struct {
+	w http.ResponseWriter
+	r *http.Request
+	// userId is the ID of the user authorized by the request's OAuth token,
+	// if any.
+	userId string
+}
+
+// route maps a request path (relative to /plus/v1/) to an API method name and
+// its path parameters.
+func route(method, path string) (string, []string) {
+	if method != "GET" {
+		return "", nil
+	}
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "people":
+		return "people.search", nil
+	case len(parts) == 2 && parts[0] == "people":
+		return "people.get", parts[1:]
+	case len(parts) == 4 && parts[0] == "people" && parts[2] == "activities":
+		return "activities.list", []string{parts[1], parts[3]}
+	case len(parts) == 1 && parts[0] == "activities":
+		return "activities.search", nil
+	case len(parts) == 2 && parts[0] == "activities":
+		return "activities.get", parts[1:]
+	case len(parts) == 4 && parts[0] == "activities" && parts[2] == "people":
+		return "people.listByActivity", []string{parts[1], parts[3]}
+	case len(parts) == 3 && parts[0] == "activities" && parts[2] == "comments":
+		return "comments.list", parts[1:2]
+	case len(parts) == 2 && parts[0] == "comments":
+		return "comments.get", parts[1:]
+	}
+	return "", nil
+}
+
+func (s *Server) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	const prefix = "/plus/v1/"
+	if !strings.HasPrefix(r.URL.Path, prefix) {
+		writeError(w, Error{Code: http.StatusNotFound, Reason: "notFound"})
+		return
+	}
+	method, params := route(r.Method, r.URL.Path[len(prefix):])
+	if len(method) == 0 {
+		writeError(w, Error{Code: http.StatusNotFound, Reason: "notFound"})
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.calls[method]++
+
+	if errors := s.errors[method]; len(errors) > 0 {
+		s.errors[method] = errors[1:]
+		writeError(w, errors[0])
+		return
+	}
+
+	c := &call{w: w, r: r}
+	if !s.authorize(c) {
+		return
+	}
+
+	switch method {
+	case "people.search":
+		s.peopleSearch(c)
+	case "people.get":
+		s.peopleGet(c, params[0])
+	case "people.listByActivity":
+		s.peopleListByActivity(c, params[0], params[1])
+	case "activities.list":
+		s.activitiesList(c, params[0], params[1])
+	case "activities.search":
+		s.activitiesSearch(c)
+	case "activities.get":
+		s.activitiesGet(c, params[0])
+	case "comments.list":
+		s.commentsList(c, params[0])
+	case "comments.get":
+		s.commentsGet(c, params[0])
+	}
+}
+
+// authorize checks the request's API key or OAuth token, like the real API:
+// either is enough, but an invalid one is always an error. It writes an error
+// response and returns false if the request isn't authorized.
+func (s *Server) authorize(c *call) bool {
+	if auth := c.r.Header.Get("Authorization"); len(auth) > 0 {
+		token := auth
+		for _, scheme := range []string{"Bearer ", "OAuth "} {
+			if strings.HasPrefix(auth, scheme) {
+				token = auth[len(scheme):]
+			}
+		}
+		userId, ok := s.tokens[token]
+		if !ok {
+			writeError(c.w, Error{Code: http.StatusUnauthorized, Reason: "authError", Message: "Invalid Credentials"})
+			return false
+		}
+		c.userId = userId
+	}
+
+	if key := c.r.URL.Query().Get("key"); len(key) > 0 {
+		if !s.keys[key] {
+			writeError(c.w, Error{Code: http.StatusBadRequest, Reason: "keyInvalid", Message: "Bad Request"})
+			return false
+		}
+	} else if len(c.userId) == 0 {
+		writeError(c.w, Error{Code: http.StatusForbidden, Reason: "dailyLimitExceededUnreg",
+			Message: "Daily Limit Exceeded. Please sign up"})
+		return false
+	}
+	return true
+}
+
+// resolve returns the ID of the user referred to by userId, replacing "me"
+// with the authorized user. It writes an error response and returns false if
+// "me" is used without an OAuth token.
+func (s *Server) resolve(c *call, userId string) (string, bool) {
+	if userId != "me" {
+		return userId, true
+	}
+	if len(c.userId) == 0 {
+		writeError(c.w, Error{Code: http.StatusUnauthorized, Reason: "required", Message: "Login Required"})
+		return "", false
+	}
+	return c.userId, true
+}
+
+func (s *Server) peopleGet(c *call, userId string) {
+	userId, ok := s.resolve(c, userId)
+	if !ok {
+		return
+	}
+	for _, p := range s.people {
+		if p.Id == userId {
+			writeJSON(c.w, p)
+			return
+		}
+	}
+	writeError(c.w, Error{Code: http.StatusNotFound, Reason: "notFound", Message: "Not Found"})
+}
+
+func (s *Server) peopleSearch(c *call) {
+	query, ok := requireQuery(c)
+	if !ok {
+		return
+	}
+	var matches []*plus.Person
+	for _, p := range s.people {
+		if contains(p.DisplayName, query) {
+			matches = append(matches, p)
+		}
+	}
+	start, end, next, ok := paginate(c, len(matches), 10, 50)
+	if !ok {
+		return
+	}
+	writeJSON(c.w, &plus.PeopleFeed{Kind: "plus#peopleFeed", Items: matches[start:end], NextPageToken: next})
+}
+
+func (s *Server) peopleListByActivity(c *call, activityId, collection string) {
+	if _, ok := s.owners[activityId]; !ok {
+		writeError(c.w, Error{Code: http.StatusNotFound, Reason: "notFound", Message: "Not Found"})
+		return
+	}
+	if collection != "plusoners" && collection != "resharers" {
+		writeError(c.w, Error{Code: http.StatusBadRequest, Reason: "invalid", Message: "Invalid collection"})
+		return
+	}
+	people := s.audiences[activityId+"/"+collection]
+	start, end, next, ok := paginate(c, len(people), 20, 100)
+	if !ok {
+		return
+	}
+	writeJSON(c.w, &plus.PeopleFeed{Kind: "plus#peopleFeed", Items: people[start:end], NextPageToken: next})
+}
+
+func (s *Server) activitiesList(c *call, userId, collection string) {
+	userId, ok := s.resolve(c, userId)
+	if !ok {
+		return
+	}
+	if collection != "public" {
+		writeError(c.w, Error{Code: http.StatusBadRequest, Reason: "invalid", Message: "Invalid collection"})
+		return
+	}
+	var activities []*plus.Activity
+	for _, a := range s.activities {
+		if s.owners[a.Id] == userId {
+			activities = append(activities, a)
+		}
+	}
+	start, end, next, ok := paginate(c, len(activities), 20, 100)
+	if !ok {
+		return
+	}
+	writeJSON(c.w, &plus.ActivityFeed{Kind: "plus#activityFeed", Items: activities[start:end], NextPageToken: next})
+}
+
+func (s *Server) activitiesSearch(c *call) {
+	query, ok := requireQuery(c)
+	if !ok {
+		return
+	}
+	var matches []*plus.Activity
+	for _, a := range s.activities {
+		if contains(a.Title, query) || (a.Object != nil && contains(a.Object.Content, query)) {
+			matches = append(matches, a)
+		}
+	}
+	start, end, next, ok := paginate(c, len(matches), 10, 20)
+	if !ok {
+		return
+	}
+	writeJSON(c.w, &plus.ActivityFeed{Kind: "plus#activityFeed", Items: matches[start:end], NextPageToken: next})
+}
+
+func (s *Server) activitiesGet(c *call, activityId string) {
+	for _, a := range s.activities {
+		if a.Id == activityId {
+			writeJSON(c.w, a)
+			return
+		}
+	}
+	writeError(c.w, Error{Code: http.StatusNotFound, Reason: "notFound", Message: "Not Found"})
+}
+
+func (s *Server) commentsList(c *call, activityId string) {
+	if _, ok := s.owners[activityId]; !ok {
+		writeError(c.w, Error{Code: http.StatusNotFound, Reason: "notFound", Message: "Not Found"})
+		return
+	}
+	comments := s.comments[activityId]
+	start, end, next, ok := paginate(c, len(comments), 20, 100)
+	if !ok {
+		return
+	}
+	writeJSON(c.w, &plus.CommentFeed{Kind: "plus#commentFeed", Items: comments[start:end], NextPageToken: next})
+}
+
+func (s *Server) commentsGet(c *call, commentId string) {
+	for _, comments := range s.comments {
+		for _, comment := range comments {
+			if comment.Id == commentId {
+				writeJSON(c.w, comment)
+				return
+			}
+		}
+	}
+	writeError(c.w, Error{Code: http.StatusNotFound, Reason: "notFound", Message: "Not Found"})
+}
+
+// requireQuery returns the "query" parameter. It writes an error response
+// and returns false if it is missing.
+func requireQuery(c *call) (string, bool) {
+	query := c.r.URL.Query().Get("query")
+	if len(query) == 0 {
+		writeError(c.w, Error{Code: http.StatusBadRequest, Reason: "required", Message: "Required parameter: query"})
+		return "", false
+	}
+	return query, true
+}
+
+// paginate returns the bounds of the page of a list of n items requested by
+// the "maxResults" and "pageToken" parameters, and the token of the next page.
+// Page tokens are simply offsets. It writes an error response and returns
+// false if the parameters are invalid.
+func paginate(c *call, n, defaultMax, limit int) (start, end int, next string, ok bool) {
+	q := c.r.URL.Query()
+
+	max := defaultMax
+	if v := q.Get("maxResults"); len(v) > 0 {
+		m, err := strconv.Atoi(v)
+		if err != nil || m < 1 || m > limit {
+			writeError(c.w, Error{Code: http.StatusBadRequest, Reason: "invalid",
+				Message: fmt.Sprintf("Invalid value '%s'. Values must be within the range: [1, %d]", v, limit)})
+			return 0, 0, "", false
+		}
+		max = m
+	}
+
+	if v := q.Get("pageToken"); len(v) > 0 {
+		offset, err := strconv.Atoi(v)
+		if err != nil || offset < 0 || offset > n {
+			writeError(c.w, Error{Code: http.StatusBadRequest, Reason: "invalid", Message: "Invalid page token"})
+			return 0, 0, "", false
+		}
+		start = offset
+	}
+
+	end = start + max
+	if end < n {
+		next = strconv.Itoa(end)
+	} else {
+		end = n
+	}
+	return start, end, next, true
+}
+
+func contains(s, substr string) bool {
+	return strings.Contains(strings.ToLower(s), strings.ToLower(substr))
+}
+
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	json.NewEncoder(w).Encode(v)
+}
+
+// writeError writes e in the googleapi JSON error format.
+func writeError(w http.ResponseWriter, e Error) {
+	if len(e.Message) == 0 {
+		e.Message = e.Reason
+	}
+	if len(e.RetryAfter) > 0 {
+		w.Header().Set("Retry-After", e.RetryAfter)
+	}
+	w.Header().Set("Content-Type", "application/json; charset=UTF-8")
+	w.WriteHeader(e.Code)
+
+	body := map[string]interface{}{
+		"error": map[string]interface{}{
+			"errors": []map[string]string{{
+				"domain":  "global",
+				"reason":  e.Reason,
+				"message": e.Message,
+			}},
+			"code":    e.Code,
+			"message": e.Message,
+		},
+	}
+	json.NewEncoder(w).Encode(body)
+}
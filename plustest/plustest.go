@@ -0,0 +1,184 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The plustest package provides an in-memory fake of the Google+ API for
+// tests. It serves people.get, people.search, people.listByActivity,
+// activities.get, activities.list, activities.search, comments.list and
+// comments.get from fixtures seeded by the test, with pagination, API key and
+// OAuth token checking, and injectable errors.
+//
+// Example usage:
+// 	s := plustest.NewServer()
+// 	defer s.Close()
+// 	s.AddKey("test-key")
+// 	s.AddPerson(&plus.Person{Id: "1", DisplayName: "Larry"})
+//
+// 	t := &noauth.Transport{APIKey: "test-key", Transport: s.Transport(nil)}
+// 	p, _ := plus.New(t.Client())
+// 	feed, _ := p.People.Search("larry").Do()
+//
+// Requests to the public Google+ API base URL are redirected to the fake
+// server by the transport returned by Transport; BaseURL returns the server's
+// equivalent of that base URL for code that can be configured with one, such
+// as the BaseURL setting of the command-line and App Engine apps.
+package plustest
+
+import (
+	"http"
+	"http/httptest"
+	"sync"
+
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/endpoint"
+)
+
+// Error is an error response served instead of the next call to an API
+// method. See Server.InjectError.
+type Error struct {
+	// Code is the HTTP status code, e.g. 403.
+	Code int
+	// Reason is the googleapi error reason, e.g. "rateLimitExceeded".
+	Reason string
+	// Message is a human-readable description. It will default to Reason.
+	Message string
+	// RetryAfter, if not empty, is sent as the Retry-After header.
+	RetryAfter string
+}
+
+// Server is a fake Google+ API server. Its methods are safe for use by
+// multiple goroutines, so fixtures can be changed while requests are served.
+type Server struct {
+	// URL is the base URL of the server, of the form http://ipaddr:port with
+	// no trailing slash.
+	URL string
+
+	server *httptest.Server
+
+	mu         sync.Mutex
+	keys       map[string]bool
+	tokens     map[string]string // access token -> user ID
+	people     []*plus.Person
+	activities []*plus.Activity
+	owners     map[string]string          // activity ID -> user ID
+	comments   map[string][]*plus.Comment // activity ID -> comments
+	audiences  map[string][]*plus.Person  // activity ID + "/" + collection -> people
+	errors     map[string][]Error         // API method -> injected errors
+	calls      map[string]int             // API method -> number of calls
+}
+
+// NewServer starts and returns a new Server with no fixtures. The caller
+// should call Close when finished, to shut it down.
+func NewServer() *Server {
+	s := &Server{
+		keys:      make(map[string]bool),
+		tokens:    make(map[string]string),
+		owners:    make(map[string]string),
+		comments:  make(map[string][]*plus.Comment),
+		audiences: make(map[string][]*plus.Person),
+		errors:    make(map[string][]Error),
+		calls:     make(map[string]int),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	s.URL = s.server.URL
+	return s
+}
+
+// Close shuts down the server.
+func (s *Server) Close() {
+	s.server.Close()
+}
+
+// BaseURL returns the server's equivalent of endpoint.PlusBaseURL.
+func (s *Server) BaseURL() string {
+	return s.URL + "/plus/v1/"
+}
+
+// Transport returns an http.RoundTripper that sends requests for
+// endpoint.PlusBaseURL to the server instead, using t (or
+// http.DefaultTransport if t is nil). Other requests are sent unchanged.
+func (s *Server) Transport(t http.RoundTripper) http.RoundTripper {
+	return &endpoint.Transport{BaseURL: s.BaseURL(), Transport: t}
+}
+
+// Client returns an *http.Client using Transport(nil). It makes requests
+// without an API key or OAuth token, so it is mostly useful to test error
+// handling.
+func (s *Server) Client() *http.Client {
+	return &http.Client{Transport: s.Transport(nil)}
+}
+
+// AddKey makes key a valid API key.
+func (s *Server) AddKey(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys[key] = true
+}
+
+// AddToken makes token a valid OAuth access token for the user with ID
+// userId, who is then known as "me" in requests made with the token.
+func (s *Server) AddToken(token, userId string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = userId
+}
+
+// AddPerson adds a profile, returned by people.get and people.search.
+func (s *Server) AddPerson(p *plus.Person) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.people = append(s.people, p)
+}
+
+// AddActivity adds an activity by the user with ID userId, returned by
+// activities.get, activities.list and activities.search. Activities are
+// listed in the order they are added, so add the most recent ones first.
+func (s *Server) AddActivity(userId string, a *plus.Activity) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.activities = append(s.activities, a)
+	s.owners[a.Id] = userId
+}
+
+// AddComment adds a comment on the activity with ID activityId, returned by
+// comments.list and comments.get.
+func (s *Server) AddComment(activityId string, c *plus.Comment) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.comments[activityId] = append(s.comments[activityId], c)
+}
+
+// AddAudience adds a person to the collection ("plusoners" or "resharers")
+// of the activity with ID activityId, returned by people.listByActivity.
+func (s *Server) AddAudience(activityId, collection string, p *plus.Person) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	key := activityId + "/" + collection
+	s.audiences[key] = append(s.audiences[key], p)
+}
+
+// InjectError makes the next call to method (e.g. "people.search") fail
+// with e. Several errors injected for the same method are served in order.
+func (s *Server) InjectError(method string, e Error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.errors[method] = append(s.errors[method], e)
+}
+
+// Calls returns the number of requests served for method (e.g.
+// "people.get"), including failed ones.
+func (s *Server) Calls(method string) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.calls[method]
+}
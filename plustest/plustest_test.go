@@ -0,0 +1,193 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package plustest
+
+import (
+	"http"
+	"os"
+	"strings"
+	"testing"
+
+	"google-api-go-client.googlecode.com/hg/plus/v1"
+	"google-plus-go-starter.googlecode.com/hg/noauth"
+)
+
+// bearerTransport adds an OAuth access token to each request.
+type bearerTransport struct {
+	token     string
+	transport http.RoundTripper
+}
+
+func (t *bearerTransport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	req.Header.Set("Authorization", "Bearer "+t.token)
+	return t.transport.RoundTrip(req)
+}
+
+func newServer() *Server {
+	s := NewServer()
+	s.AddKey("key")
+	s.AddToken("token", "1")
+	for _, p := range []*plus.Person{
+		&plus.Person{Id: "1", DisplayName: "Larry Page"},
+		&plus.Person{Id: "2", DisplayName: "Larry Ellison"},
+		&plus.Person{Id: "3", DisplayName: "Larry Wall"},
+		&plus.Person{Id: "4", DisplayName: "Sergey Brin"},
+	} {
+		s.AddPerson(p)
+	}
+	s.AddActivity("1", &plus.Activity{Id: "a1", Title: "Hello Google+"})
+	s.AddActivity("4", &plus.Activity{Id: "a2", Title: "Hello again"})
+	s.AddComment("a1", &plus.Comment{Id: "c1"})
+	s.AddAudience("a1", "plusoners", &plus.Person{Id: "4", DisplayName: "Sergey Brin"})
+	return s
+}
+
+func noAuthPlus(t *testing.T, s *Server, key string) *plus.Service {
+	transport := &noauth.Transport{APIKey: key, Transport: s.Transport(nil)}
+	p, err := plus.New(transport.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func oauthPlus(t *testing.T, s *Server, token string) *plus.Service {
+	transport := &bearerTransport{token: token, transport: s.Transport(nil)}
+	p, err := plus.New(&http.Client{Transport: transport})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestPeopleSearchPagination(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	p := noAuthPlus(t, s, "key")
+
+	var names []string
+	pageToken := ""
+	for pages := 0; pages < 10; pages++ {
+		call := p.People.Search("larry").MaxResults(2)
+		if len(pageToken) > 0 {
+			call = call.PageToken(pageToken)
+		}
+		feed, err := call.Do()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, person := range feed.Items {
+			names = append(names, person.DisplayName)
+		}
+		if pageToken = feed.NextPageToken; len(pageToken) == 0 {
+			break
+		}
+	}
+
+	expected := "Larry Page,Larry Ellison,Larry Wall"
+	if got := strings.Join(names, ","); got != expected {
+		t.Errorf("expected %s but got %s", expected, got)
+	}
+	if calls := s.Calls("people.search"); calls != 2 {
+		t.Errorf("expected 2 calls but got %d", calls)
+	}
+}
+
+func TestGetters(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	p := noAuthPlus(t, s, "key")
+
+	person, err := p.People.Get("3").Do()
+	if err != nil || person.DisplayName != "Larry Wall" {
+		t.Errorf("people.get: got %v, %v", person, err)
+	}
+	activity, err := p.Activities.Get("a2").Do()
+	if err != nil || activity.Title != "Hello again" {
+		t.Errorf("activities.get: got %v, %v", activity, err)
+	}
+	activities, err := p.Activities.List("1", "public").Do()
+	if err != nil || len(activities.Items) != 1 || activities.Items[0].Id != "a1" {
+		t.Errorf("activities.list: got %v, %v", activities, err)
+	}
+	activities, err = p.Activities.Search("hello").Do()
+	if err != nil || len(activities.Items) != 2 {
+		t.Errorf("activities.search: got %v, %v", activities, err)
+	}
+	comments, err := p.Comments.List("a1").Do()
+	if err != nil || len(comments.Items) != 1 {
+		t.Errorf("comments.list: got %v, %v", comments, err)
+	}
+	comment, err := p.Comments.Get("c1").Do()
+	if err != nil || comment.Id != "c1" {
+		t.Errorf("comments.get: got %v, %v", comment, err)
+	}
+	people, err := p.People.ListByActivity("a1", "plusoners").Do()
+	if err != nil || len(people.Items) != 1 || people.Items[0].Id != "4" {
+		t.Errorf("people.listByActivity: got %v, %v", people, err)
+	}
+	if _, err := p.People.Get("404").Do(); err == nil {
+		t.Error("people.get: expected an error for an unknown person")
+	}
+}
+
+func TestAuthorization(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+
+	// "me" is the user associated with the OAuth token.
+	me, err := oauthPlus(t, s, "token").People.Get("me").Do()
+	if err != nil || me.Id != "1" {
+		t.Errorf("expected me to be user 1, got %v, %v", me, err)
+	}
+
+	// Invalid credentials are rejected.
+	if _, err := oauthPlus(t, s, "bad-token").People.Get("me").Do(); err == nil {
+		t.Error("expected an error for an invalid token")
+	}
+	if _, err := noAuthPlus(t, s, "bad-key").People.Get("1").Do(); err == nil {
+		t.Error("expected an error for an invalid key")
+	}
+	if _, err := noAuthPlus(t, s, "key").People.Get("me").Do(); err == nil {
+		t.Error("expected an error for me without a token")
+	}
+	p, _ := plus.New(s.Client())
+	if _, err := p.People.Get("1").Do(); err == nil {
+		t.Error("expected an error without a key or token")
+	}
+}
+
+func TestInjectError(t *testing.T) {
+	s := newServer()
+	defer s.Close()
+	s.InjectError("people.get", Error{Code: 503, Reason: "backendError"})
+
+	// The retrying transport recovers from the injected error.
+	transport := &noauth.Transport{
+		APIKey:    "key",
+		Transport: s.Transport(nil),
+		Retry:     &noauth.RetryPolicy{MaxAttempts: 2, InitialBackoff: 1e6},
+	}
+	p, err := plus.New(transport.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.People.Get("1").Do(); err != nil {
+		t.Error(err)
+	}
+	if calls := s.Calls("people.get"); calls != 2 {
+		t.Errorf("expected 2 calls but got %d", calls)
+	}
+}
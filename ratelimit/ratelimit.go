@@ -0,0 +1,192 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The ratelimit package provides a client-side rate limiter for HTTP requests
+// to Google APIs, so that bulk work stays below per-second quotas instead of
+// failing with rateLimitExceeded errors.
+//
+// Example usage:
+// 	l, err := ratelimit.NewLimiter(5, 10)
+// 	if err != nil {
+// 		...
+// 	}
+// 	t := &noauth.Transport{
+// 		APIKey:    YOUR_API_KEY,
+// 		Transport: &ratelimit.Transport{Limiter: l},
+// 	}
+// 	c := t.Client()
+//
+// A single Limiter can be shared by many Transports (and goroutines), for
+// example by the per-request transports of an App Engine application.
+package ratelimit
+
+import (
+	"fmt"
+	"http"
+	"os"
+	"sync"
+	"time"
+)
+
+// ErrCanceled is returned when a request is canceled while it waits for the
+// Limiter.
+var ErrCanceled = os.NewError("ratelimit: request canceled")
+
+// now returns the current time in nanoseconds. It is replaced in tests.
+var now = time.Nanoseconds
+
+// Limiter is a token bucket. Tokens are added at a fixed rate up to a maximum
+// (the burst size), and every request takes one token, waiting for it if the
+// bucket is empty. It is safe for use by multiple goroutines.
+type Limiter struct {
+	rate  float64 // tokens per second
+	burst float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   int64 // time in nanoseconds when tokens was last updated
+}
+
+// NewLimiter returns a Limiter that allows perSecond requests per second on
+// average, and bursts of up to burst requests. The bucket starts full.
+// perSecond must be positive, and burst at least 1.
+func NewLimiter(perSecond float64, burst int) (*Limiter, os.Error) {
+	if !(perSecond > 0) {
+		return nil, fmt.Errorf("ratelimit: the rate must be positive, not %g", perSecond)
+	}
+	if burst < 1 {
+		return nil, fmt.Errorf("ratelimit: the burst must be at least 1, not %d", burst)
+	}
+	return &Limiter{
+		rate:   perSecond,
+		burst:  float64(burst),
+		tokens: float64(burst),
+		last:   now(),
+	}, nil
+}
+
+// reserve takes a token and returns how long (in nanoseconds) the caller must
+// wait before using it.
+func (l *Limiter) reserve() int64 {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	t := now()
+	l.tokens += float64(t-l.last) * l.rate / 1e9
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+	l.last = t
+
+	l.tokens--
+	if l.tokens >= 0 {
+		return 0
+	}
+	return int64(-l.tokens * 1e9 / l.rate)
+}
+
+// unreserve gives back a token taken by reserve but never used.
+func (l *Limiter) unreserve() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.tokens++
+	if l.tokens > l.burst {
+		l.tokens = l.burst
+	}
+}
+
+// Wait blocks until a request may be made. It returns ErrCanceled without
+// taking a token if cancel is closed (or receives a value) first. cancel may
+// be nil.
+func (l *Limiter) Wait(cancel <-chan bool) os.Error {
+	d := l.reserve()
+	if d <= 0 {
+		return nil
+	}
+
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-cancel:
+		l.unreserve()
+		return ErrCanceled
+	}
+	panic("unreachable")
+}
+
+// Transport implements http.RoundTripper. It waits for its Limiter before
+// forwarding each request, so it can wrap the transport of a noauth.Transport
+// or an oauth.Transport to throttle all of their requests.
+type Transport struct {
+	// Limiter throttles the requests. If nil, requests are not throttled.
+	Limiter *Limiter
+	// Transport is the HTTP transport to use when making requests.
+	// It will default to http.DefaultTransport if nil.
+	Transport http.RoundTripper
+
+	mu      sync.Mutex
+	waiting map[*http.Request]chan bool
+}
+
+// Client returns an *http.Client that throttles its requests.
+func (t *Transport) Client() *http.Client {
+	return &http.Client{Transport: t}
+}
+
+func (t *Transport) transport() http.RoundTripper {
+	if t.Transport != nil {
+		return t.Transport
+	}
+	return http.DefaultTransport
+}
+
+// RoundTrip waits for the Limiter, then executes a single HTTP transaction.
+// It returns ErrCanceled if CancelRequest is called for req while it waits.
+func (t *Transport) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	if t.Limiter != nil {
+		cancel := make(chan bool)
+		t.mu.Lock()
+		if t.waiting == nil {
+			t.waiting = make(map[*http.Request]chan bool)
+		}
+		t.waiting[req] = cancel
+		t.mu.Unlock()
+
+		err := t.Limiter.Wait(cancel)
+
+		t.mu.Lock()
+		t.waiting[req] = nil, false
+		t.mu.Unlock()
+
+		if err != nil {
+			return nil, err
+		}
+	}
+	return t.transport().RoundTrip(req)
+}
+
+// CancelRequest cancels req if it is waiting for the Limiter. It has no effect
+// once the request has been forwarded.
+func (t *Transport) CancelRequest(req *http.Request) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if cancel, ok := t.waiting[req]; ok {
+		close(cancel)
+		t.waiting[req] = nil, false
+	}
+}
@@ -0,0 +1,151 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package ratelimit
+
+import (
+	"http"
+	"os"
+	"testing"
+	"time"
+)
+
+func newLimiter(t *testing.T, perSecond float64, burst int) *Limiter {
+	l, err := NewLimiter(perSecond, burst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return l
+}
+
+type NewLimiterTest struct {
+	perSecond float64
+	burst     int
+	ok        bool
+}
+
+var NewLimiterTests = []NewLimiterTest{
+	NewLimiterTest{2, 3, true},
+	NewLimiterTest{0.001, 1, true},
+	NewLimiterTest{0, 1, false},
+	NewLimiterTest{-1, 1, false},
+	NewLimiterTest{2, 0, false},
+}
+
+func TestNewLimiter(t *testing.T) {
+	for _, test := range NewLimiterTests {
+		_, err := NewLimiter(test.perSecond, test.burst)
+		if ok := err == nil; ok != test.ok {
+			t.Errorf("NewLimiter(%g, %d): expected ok %v, got error %v", test.perSecond, test.burst, test.ok, err)
+		}
+	}
+}
+
+func TestReserve(t *testing.T) {
+	var clock int64
+	now = func() int64 { return clock }
+	defer func() { now = time.Nanoseconds }()
+
+	// 2 requests per second, bursts of 3.
+	l := newLimiter(t, 2, 3)
+
+	// The first 3 requests are free, then each must wait 0.5s more.
+	for i, expected := range []int64{0, 0, 0, 500e6, 1000e6} {
+		if d := l.reserve(); d != expected {
+			t.Errorf("request %d: expected delay %d but got %d", i, expected, d)
+		}
+	}
+
+	// After 10 seconds the bucket is full again, but not fuller than burst.
+	clock += 10e9
+	for i, expected := range []int64{0, 0, 0, 500e6} {
+		if d := l.reserve(); d != expected {
+			t.Errorf("request %d after refill: expected delay %d but got %d", i, expected, d)
+		}
+	}
+}
+
+func TestWaitCanceled(t *testing.T) {
+	l := newLimiter(t, 0.001, 1)
+	if err := l.Wait(nil); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := make(chan bool)
+	done := make(chan os.Error)
+	go func() { done <- l.Wait(cancel) }()
+	close(cancel)
+	if err := <-done; err != ErrCanceled {
+		t.Errorf("expected ErrCanceled but got %v", err)
+	}
+}
+
+type countingRoundTripper struct{ n int }
+
+func (t *countingRoundTripper) RoundTrip(req *http.Request) (*http.Response, os.Error) {
+	t.n++
+	return &http.Response{StatusCode: 200}, nil
+}
+
+func TestCancelRequest(t *testing.T) {
+	fake := &countingRoundTripper{}
+	transport := &Transport{
+		Limiter:   newLimiter(t, 0.001, 1),
+		Transport: fake,
+	}
+
+	first, _ := http.NewRequest("GET", "https://www.example.com/1", nil)
+	if _, err := transport.RoundTrip(first); err != nil {
+		t.Fatal(err)
+	}
+
+	// The second request has to wait ~1000 seconds, so cancel it.
+	second, _ := http.NewRequest("GET", "https://www.example.com/2", nil)
+	done := make(chan os.Error)
+	go func() {
+		_, err := transport.RoundTrip(second)
+		done <- err
+	}()
+	for {
+		transport.mu.Lock()
+		_, waiting := transport.waiting[second]
+		transport.mu.Unlock()
+		if waiting {
+			break
+		}
+		time.Sleep(1e6)
+	}
+	transport.CancelRequest(second)
+
+	if err := <-done; err != ErrCanceled {
+		t.Errorf("expected ErrCanceled but got %v", err)
+	}
+	if fake.n != 1 {
+		t.Errorf("expected 1 forwarded request but got %d", fake.n)
+	}
+}
+
+func TestConcurrentWait(t *testing.T) {
+	l := newLimiter(t, 1000, 10)
+	done := make(chan bool)
+	for i := 0; i < 20; i++ {
+		go func() {
+			l.Wait(nil)
+			done <- true
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		<-done
+	}
+}
@@ -0,0 +1,192 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sealed
+
+import (
+	"crypto/cipher"
+	"crypto/subtle"
+)
+
+// gcmNonceSize and gcmTagSize are the sizes, in bytes, of the nonces and
+// authentication tags of gcm.
+const (
+	gcmNonceSize = 12
+	gcmTagSize   = 16
+)
+
+// gcm implements the Galois/Counter Mode of NIST SP 800-38D on a 128-bit block
+// cipher, with 96-bit nonces and 128-bit tags. It favors simplicity over speed,
+// which is fine for the small payloads this package seals.
+type gcm struct {
+	block cipher.Block
+	// h is the hash subkey, the encryption of the zero block.
+	h gcmElement
+}
+
+// gcmElement is an element of GF(2^128) in GCM's bit order: the most
+// significant bit of hi is the coefficient of x^0.
+type gcmElement struct {
+	hi, lo uint64
+}
+
+func newGCM(block cipher.Block) *gcm {
+	var zero, h [16]byte
+	block.Encrypt(h[:], zero[:])
+	return &gcm{block: block, h: gcmElement{getUint64(h[:8]), getUint64(h[8:])}}
+}
+
+// seal encrypts and authenticates plaintext, authenticates data, and returns
+// the ciphertext followed by the tag.
+func (g *gcm) seal(nonce, plaintext, data []byte) []byte {
+	var counter, tagMask [16]byte
+	g.initCounter(&counter, nonce)
+	g.block.Encrypt(tagMask[:], counter[:])
+
+	out := make([]byte, len(plaintext)+gcmTagSize)
+	incCounter(&counter)
+	g.counterCrypt(out, plaintext, &counter)
+
+	tag := out[len(plaintext):]
+	g.auth(tag, out[:len(plaintext)], data)
+	for i := range tag {
+		tag[i] ^= tagMask[i]
+	}
+	return out
+}
+
+// open authenticates ciphertext (followed by its tag) and data, and returns
+// the decrypted plaintext. ok is false if authentication fails.
+func (g *gcm) open(nonce, ciphertext, data []byte) (plaintext []byte, ok bool) {
+	if len(ciphertext) < gcmTagSize {
+		return nil, false
+	}
+	tag := ciphertext[len(ciphertext)-gcmTagSize:]
+	ciphertext = ciphertext[:len(ciphertext)-gcmTagSize]
+
+	var counter, expected [16]byte
+	g.initCounter(&counter, nonce)
+	g.block.Encrypt(expected[:], counter[:])
+	var sum [16]byte
+	g.auth(sum[:], ciphertext, data)
+	for i := range expected {
+		expected[i] ^= sum[i]
+	}
+	if subtle.ConstantTimeCompare(expected[:], tag) != 1 {
+		return nil, false
+	}
+
+	plaintext = make([]byte, len(ciphertext))
+	incCounter(&counter)
+	g.counterCrypt(plaintext, ciphertext, &counter)
+	return plaintext, true
+}
+
+// initCounter sets counter to the pre-counter block of a 96-bit nonce.
+func (g *gcm) initCounter(counter *[16]byte, nonce []byte) {
+	copy(counter[:], nonce)
+	counter[15] = 1
+}
+
+// incCounter increments the last 32 bits of counter.
+func incCounter(counter *[16]byte) {
+	for i := 15; i >= 12; i-- {
+		counter[i]++
+		if counter[i] != 0 {
+			break
+		}
+	}
+}
+
+// counterCrypt XORs in with the key stream starting at counter into out.
+func (g *gcm) counterCrypt(out, in []byte, counter *[16]byte) {
+	var mask [16]byte
+	for len(in) > 0 {
+		g.block.Encrypt(mask[:], counter[:])
+		incCounter(counter)
+		n := len(in)
+		if n > 16 {
+			n = 16
+		}
+		for i := 0; i < n; i++ {
+			out[i] = in[i] ^ mask[i]
+		}
+		out, in = out[n:], in[n:]
+	}
+}
+
+// auth writes the GHASH of data and ciphertext to out.
+func (g *gcm) auth(out, ciphertext, data []byte) {
+	var y gcmElement
+	g.update(&y, data)
+	g.update(&y, ciphertext)
+	y.hi ^= uint64(len(data)) * 8
+	y.lo ^= uint64(len(ciphertext)) * 8
+	y = g.mul(y)
+	putUint64(out[:8], y.hi)
+	putUint64(out[8:], y.lo)
+}
+
+// update absorbs b, padded with zeros to a multiple of 16 bytes, into y.
+func (g *gcm) update(y *gcmElement, b []byte) {
+	for len(b) > 0 {
+		var block [16]byte
+		n := copy(block[:], b)
+		b = b[n:]
+		y.hi ^= getUint64(block[:8])
+		y.lo ^= getUint64(block[8:])
+		*y = g.mul(*y)
+	}
+}
+
+// mul returns x·h in GF(2^128).
+func (g *gcm) mul(x gcmElement) gcmElement {
+	var z gcmElement
+	v := g.h
+	for i := 0; i < 128; i++ {
+		var bit uint64
+		if i < 64 {
+			bit = x.hi >> uint(63-i) & 1
+		} else {
+			bit = x.lo >> uint(127-i) & 1
+		}
+		if bit == 1 {
+			z.hi ^= v.hi
+			z.lo ^= v.lo
+		}
+		// Multiply v by x, reducing by x^128 + x^7 + x^2 + x + 1.
+		carry := v.lo & 1
+		v.lo = v.lo>>1 | v.hi<<63
+		v.hi >>= 1
+		if carry == 1 {
+			v.hi ^= 0xe1 << 56
+		}
+	}
+	return z
+}
+
+func getUint64(b []byte) uint64 {
+	var v uint64
+	for _, c := range b[:8] {
+		v = v<<8 | uint64(c)
+	}
+	return v
+}
+
+func putUint64(b []byte, v uint64) {
+	for i := 7; i >= 0; i-- {
+		b[i] = byte(v)
+		v >>= 8
+	}
+}
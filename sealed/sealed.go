@@ -0,0 +1,161 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// The sealed package encrypts small secrets, such as OAuth token files, under
+// a passphrase. The data is sealed with AES-256-GCM under a key derived from
+// the passphrase with scrypt.
+//
+// Example usage:
+// 	data, err := sealed.Seal(tokenJSON, passphrase, nil)
+// 	...
+// 	if sealed.IsSealed(data) {
+// 		tokenJSON, err = sealed.Open(data, passphrase)
+// 	}
+//
+// Sealed data starts with a versioned header, which records the scrypt
+// parameters, the salt and the nonce, so that the format and the cost can
+// evolve while older files stay readable:
+// 	magic     "GPSEALED" (8 bytes)
+// 	version   1 (1 byte)
+// 	log2(N)   scrypt CPU/memory cost (1 byte)
+// 	r         scrypt block size (1 byte)
+// 	p         scrypt parallelization (1 byte)
+// 	salt      (16 bytes)
+// 	nonce     (12 bytes)
+// followed by the ciphertext and the 16-byte GCM tag. The whole header is
+// authenticated.
+package sealed
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/rand"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrOpen is returned by Open when the passphrase is wrong or the data was
+// modified.
+var ErrOpen = os.NewError("sealed: wrong passphrase or corrupted data")
+
+const (
+	magic      = "GPSEALED"
+	version    = 1
+	saltSize   = 16
+	headerSize = len(magic) + 4 + saltSize + gcmNonceSize
+	keySize    = 32
+	// maxMemory bounds the memory that opening a crafted file can take.
+	maxMemory = 1 << 30
+)
+
+// Params are the scrypt parameters used to derive the key from the
+// passphrase. Higher values make guessing passphrases more expensive, and
+// sealing and opening slower.
+type Params struct {
+	// LogN is the base 2 logarithm of the CPU/memory cost N.
+	LogN int
+	// R is the block size. Memory use is 128*R*N bytes.
+	R int
+	// P is the parallelization.
+	P int
+}
+
+// valid reports whether the parameters are in range, and need at most
+// maxMemory bytes.
+func (p *Params) valid() bool {
+	return p.LogN >= 1 && p.LogN <= 30 && p.R >= 1 && p.R <= 255 && p.P >= 1 && p.P <= 255 &&
+		int64(128*p.R)<<uint(p.LogN) <= maxMemory
+}
+
+// DefaultParams are the scrypt parameters used by Seal when none are given:
+// N = 2^15, r = 8 and p = 1, which use 32MB of memory.
+var DefaultParams = &Params{LogN: 15, R: 8, P: 1}
+
+// IsSealed reports whether data starts with the header of sealed data.
+func IsSealed(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(magic))
+}
+
+// Seal encrypts plaintext under passphrase, with a random salt and nonce. It
+// will use DefaultParams if params is nil.
+func Seal(plaintext, passphrase []byte, params *Params) ([]byte, os.Error) {
+	if params == nil {
+		params = DefaultParams
+	}
+	if !params.valid() {
+		return nil, fmt.Errorf("sealed: invalid scrypt parameters %+v", *params)
+	}
+
+	header := make([]byte, headerSize)
+	copy(header, magic)
+	header[len(magic)] = version
+	header[len(magic)+1] = byte(params.LogN)
+	header[len(magic)+2] = byte(params.R)
+	header[len(magic)+3] = byte(params.P)
+	if _, err := io.ReadFull(rand.Reader, header[len(magic)+4:]); err != nil {
+		return nil, err
+	}
+
+	g, err := newCipher(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	return append(header, g.seal(nonce(header), plaintext, header)...), nil
+}
+
+// Open decrypts data sealed by Seal. It returns ErrOpen if the passphrase is
+// wrong or the data was modified.
+func Open(data, passphrase []byte) ([]byte, os.Error) {
+	if !IsSealed(data) || len(data) < headerSize {
+		return nil, os.NewError("sealed: not sealed data")
+	}
+	if v := data[len(magic)]; v != version {
+		return nil, fmt.Errorf("sealed: unsupported version %d", v)
+	}
+	header := data[:headerSize]
+	g, err := newCipher(header, passphrase)
+	if err != nil {
+		return nil, err
+	}
+	plaintext, ok := g.open(nonce(header), data[headerSize:], header)
+	if !ok {
+		return nil, ErrOpen
+	}
+	return plaintext, nil
+}
+
+// newCipher returns the AES-GCM cipher keyed by passphrase and the scrypt
+// parameters and salt of header.
+func newCipher(header, passphrase []byte) (*gcm, os.Error) {
+	p := &Params{
+		LogN: int(header[len(magic)+1]),
+		R:    int(header[len(magic)+2]),
+		P:    int(header[len(magic)+3]),
+	}
+	if !p.valid() {
+		return nil, os.NewError("sealed: invalid scrypt parameters")
+	}
+	salt := header[len(magic)+4 : len(magic)+4+saltSize]
+	key := scrypt(passphrase, salt, 1<<uint(p.LogN), p.R, p.P, keySize)
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return newGCM(block), nil
+}
+
+func nonce(header []byte) []byte {
+	return header[headerSize-gcmNonceSize:]
+}
@@ -0,0 +1,164 @@
+// Copyright 2011 Google Inc. All Rights Reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package sealed
+
+import (
+	"bytes"
+	"crypto/aes"
+	"encoding/hex"
+	"testing"
+)
+
+func fromHex(s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		panic(err)
+	}
+	return b
+}
+
+type ScryptTest struct {
+	password, salt string
+	n, r, p        int
+	key            string
+}
+
+// The test vectors of RFC 7914, section 12.
+var ScryptTests = []ScryptTest{
+	ScryptTest{"", "", 16, 1, 1, "77d6576238657b203b19ca42c18a0497f16b4844e3074ae8dfdffa3fede21442fcd0069ded0948f8326a753a0fc81f17e8d3e0fb2e0d3628cf35e20c38d18906"},
+	ScryptTest{"password", "NaCl", 1024, 8, 16, "fdbabe1c9d3472007856e7190d01e9fe7c6ad7cbc8237830e77376634b3731622eaf30d92e22a3886ff109279d9830dac727afb94a83ee6d8360cbdfa2cc0640"},
+}
+
+func TestScrypt(t *testing.T) {
+	for _, s := range ScryptTests {
+		key := scrypt([]byte(s.password), []byte(s.salt), s.n, s.r, s.p, len(s.key)/2)
+		if got := hex.EncodeToString(key); got != s.key {
+			t.Errorf("scrypt(%q, %q, %d, %d, %d) = %s, expected %s", s.password, s.salt, s.n, s.r, s.p, got, s.key)
+		}
+	}
+}
+
+type GCMTest struct {
+	key, nonce, plaintext, data, ciphertext string
+}
+
+// Test cases 1, 2 and 4 of the GCM specification.
+var GCMTests = []GCMTest{
+	GCMTest{
+		key:        "00000000000000000000000000000000",
+		nonce:      "000000000000000000000000",
+		ciphertext: "58e2fccefa7e3061367f1d57a4e7455a",
+	},
+	GCMTest{
+		key:        "00000000000000000000000000000000",
+		nonce:      "000000000000000000000000",
+		plaintext:  "00000000000000000000000000000000",
+		ciphertext: "0388dace60b6a392f328c2b971b2fe78ab6e47d42cec13bdf53a67b21257bddf",
+	},
+	GCMTest{
+		key:        "feffe9928665731c6d6a8f9467308308",
+		nonce:      "cafebabefacedbaddecaf888",
+		plaintext:  "d9313225f88406e5a55909c5aff5269a86a7a9531534f7da2e4c303d8a318a721c3c0c95956809532fcf0e2449a6b525b16aedf5aa0de657ba637b39",
+		data:       "feedfacedeadbeeffeedfacedeadbeefabaddad2",
+		ciphertext: "42831ec2217774244b7221b784d0d49ce3aa212f2c02a4e035c17e2329aca12e21d514b25466931c7d8f6a5aac84aa051ba30b396a0aac973d58e0915bc94fbc3221a5db94fae95ae7121a47",
+	},
+}
+
+func TestGCM(t *testing.T) {
+	for i, g := range GCMTests {
+		block, err := aes.NewCipher(fromHex(g.key))
+		if err != nil {
+			t.Fatal(err)
+		}
+		c := newGCM(block)
+		nonce, plaintext, data := fromHex(g.nonce), fromHex(g.plaintext), fromHex(g.data)
+
+		ciphertext := c.seal(nonce, plaintext, data)
+		if got := hex.EncodeToString(ciphertext); got != g.ciphertext {
+			t.Errorf("%d: expected ciphertext %s but got %s", i, g.ciphertext, got)
+		}
+		if got, ok := c.open(nonce, ciphertext, data); !ok || !bytes.Equal(got, plaintext) {
+			t.Errorf("%d: open failed: %x, %v", i, got, ok)
+		}
+		ciphertext[0] ^= 1
+		if _, ok := c.open(nonce, ciphertext, data); ok {
+			t.Errorf("%d: open accepted a modified ciphertext", i)
+		}
+	}
+}
+
+// testParams make the tests fast.
+var testParams = &Params{LogN: 4, R: 1, P: 1}
+
+func TestSealOpen(t *testing.T) {
+	plaintext := []byte(`{"AccessToken":"token","RefreshToken":"refresh"}`)
+	passphrase := []byte("correct horse battery staple")
+
+	data, err := Seal(plaintext, passphrase, testParams)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !IsSealed(data) || IsSealed(plaintext) {
+		t.Error("IsSealed doesn't recognize sealed data")
+	}
+	if bytes.Contains(data, []byte("token")) {
+		t.Error("the sealed data contains the plaintext")
+	}
+	got, err := Open(data, passphrase)
+	if err != nil || !bytes.Equal(got, plaintext) {
+		t.Errorf("expected %s but got %s, %v", plaintext, got, err)
+	}
+
+	// Salts and nonces are random.
+	again, err := Seal(plaintext, passphrase, testParams)
+	if err != nil || bytes.Equal(again, data) {
+		t.Errorf("sealing twice gave the same data, %v", err)
+	}
+
+	if _, err := Open(data, []byte("wrong")); err != ErrOpen {
+		t.Errorf("wrong passphrase: expected ErrOpen but got %v", err)
+	}
+	// Every byte of the header and the ciphertext is authenticated.
+	for _, i := range []int{len(magic) + 3, len(magic) + 4, headerSize - 1, headerSize, len(data) - 1} {
+		modified := append([]byte(nil), data...)
+		modified[i] ^= 1
+		if _, err := Open(modified, passphrase); err == nil {
+			t.Errorf("byte %d modified: expected an error", i)
+		}
+	}
+	modified := append([]byte(nil), data...)
+	modified[len(magic)] = version + 1
+	if _, err := Open(modified, passphrase); err == nil || err == ErrOpen {
+		t.Errorf("unsupported version: expected a version error but got %v", err)
+	}
+	if _, err := Open(data[:headerSize+gcmTagSize-1], passphrase); err == nil {
+		t.Error("truncated data: expected an error")
+	}
+}
+
+func TestParams(t *testing.T) {
+	for _, p := range []*Params{
+		&Params{LogN: 0, R: 8, P: 1},
+		&Params{LogN: 15, R: 0, P: 1},
+		&Params{LogN: 24, R: 8, P: 1},
+	} {
+		if _, err := Seal(nil, []byte("passphrase"), p); err == nil {
+			t.Errorf("expected an error for %+v", *p)
+		}
+	}
+	if !DefaultParams.valid() {
+		t.Error("DefaultParams are invalid")
+	}
+}